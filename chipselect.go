@@ -0,0 +1,170 @@
+package ft232h
+
+import (
+	"fmt"
+)
+
+// ChipSelect defines a strategy for selecting one of many SPI slave devices
+// using GPIO ("C" port) pins, e.g. when there are more slaves than available CS
+// pins. See types CSGPIO, CSDecoder, and CSShiftRegister.
+// A ChipSelect is installed with the Select field of SPIOption, and the slave
+// device is chosen with the Slave field of SPIOption or with methods such as
+// SPI.WriteToSlave.
+type ChipSelect interface {
+	Slaves() uint // number of slave devices addressable
+	// Sequence updates the given GPIO configuration cfg to assert (if assert is
+	// true) or de-assert (if assert is false) the CS line of the given slave
+	// index, and returns the sequence of GPIO pin values that must be written,
+	// in order, to do so. The SPI interface writes the entire sequence to the
+	// MPSSE engine in a single USB transfer.
+	Sequence(cfg *GPIOConfig, slave uint, assert bool) ([]uint8, error)
+}
+
+// validSlave returns a non-nil error if the given slave index is not
+// addressable with the given ChipSelect cs.
+func validSlave(cs ChipSelect, slave uint) error {
+	if slave >= cs.Slaves() {
+		return fmt.Errorf("invalid slave: %d (%d slaves)", slave, cs.Slaves())
+	}
+	return nil
+}
+
+// CSGPIO selects slave devices using a dedicated GPIO pin for each slave, i.e.
+// slave i is selected with pin Pins[i].
+type CSGPIO struct {
+	Pins      []CPin // CS pin of each slave
+	ActiveLow bool   // CS asserted "active" by driving pin LOW or HIGH
+}
+
+// Slaves returns the number of CS pins.
+func (cs *CSGPIO) Slaves() uint { return uint(len(cs.Pins)) }
+
+// Sequence asserts or de-asserts the CS pin of the given slave. All other CS
+// pins are de-asserted.
+func (cs *CSGPIO) Sequence(cfg *GPIOConfig, slave uint, assert bool) ([]uint8, error) {
+	if err := cs.config(cfg, slave, assert); nil != err {
+		return nil, err
+	}
+	return []uint8{cfg.Val}, nil
+}
+
+// config updates the given GPIO configuration cfg to select the given slave.
+func (cs *CSGPIO) config(cfg *GPIOConfig, slave uint, assert bool) error {
+	if err := validSlave(cs, slave); nil != err {
+		return err
+	}
+	for i, pin := range cs.Pins {
+		sel := assert && uint(i) == slave
+		if err := cfg.Set(pin, Output, sel != cs.ActiveLow); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+// CSDecoder selects slave devices using a binary decoder/demultiplexer (e.g.,
+// 74HC138 or 74HC154), whose address inputs are connected to GPIO pins Addr,
+// least significant bit first, and whose enable input is connected to GPIO pin
+// Enable. Slave i is connected to decoder output i.
+// The decoder address is set while its outputs are disabled, so that no other
+// slave is selected momentarily.
+type CSDecoder struct {
+	Addr            []CPin // address inputs, LSB first
+	Enable          CPin   // enable input
+	EnableActiveLow bool   // enable asserted by driving pin LOW or HIGH
+}
+
+// Slaves returns the number of decoder outputs, 2^len(Addr).
+func (cs *CSDecoder) Slaves() uint { return 1 << uint(len(cs.Addr)) }
+
+// Sequence asserts or de-asserts the decoder output of the given slave.
+func (cs *CSDecoder) Sequence(cfg *GPIOConfig, slave uint, assert bool) ([]uint8, error) {
+
+	if err := validSlave(cs, slave); nil != err {
+		return nil, err
+	}
+
+	var seq []uint8
+
+	// always disable first
+	if err := cfg.Set(cs.Enable, Output, cs.EnableActiveLow); nil != err {
+		return nil, err
+	}
+	seq = append(seq, cfg.Val)
+	if !assert {
+		return seq, nil
+	}
+
+	for i, pin := range cs.Addr {
+		if err := cfg.Set(pin, Output, 0 != slave&(1<<uint(i))); nil != err {
+			return nil, err
+		}
+	}
+	seq = append(seq, cfg.Val)
+
+	// then enable the decoder once the address is stable
+	if err := cfg.Set(cs.Enable, Output, !cs.EnableActiveLow); nil != err {
+		return nil, err
+	}
+	return append(seq, cfg.Val), nil
+}
+
+// CSShiftRegister selects slave devices using a serial-in, parallel-out shift
+// register with output latch (e.g., 74HC595), whose serial data, shift clock,
+// and latch clock inputs are connected to GPIO pins Data, Clock, and Latch,
+// respectively. Slave i is connected to parallel output i, which may extend
+// across several daisy-chained registers (Outputs total).
+// Data is shifted on the rising edge of Clock, and latched on the rising edge
+// of Latch, so that all outputs change simultaneously.
+type CSShiftRegister struct {
+	Data      CPin // serial data input
+	Clock     CPin // shift register clock input
+	Latch     CPin // storage register (latch) clock input
+	Outputs   uint // number of parallel outputs (e.g., 8 per 74HC595)
+	ActiveLow bool // CS asserted "active" by driving output LOW or HIGH
+}
+
+// Slaves returns the number of parallel outputs.
+func (cs *CSShiftRegister) Slaves() uint { return cs.Outputs }
+
+// Sequence asserts or de-asserts the parallel output of the given slave. All
+// other outputs are de-asserted.
+func (cs *CSShiftRegister) Sequence(cfg *GPIOConfig, slave uint, assert bool) ([]uint8, error) {
+
+	if err := validSlave(cs, slave); nil != err {
+		return nil, err
+	}
+
+	set := func(pin CPin, val bool) error { return cfg.Set(pin, Output, val) }
+
+	seq := make([]uint8, 0, 2*cs.Outputs+2)
+
+	if err := set(cs.Latch, false); nil != err {
+		return nil, err
+	}
+
+	// the first bit shifted in ends up on the last output
+	for i := cs.Outputs; i > 0; i-- {
+		sel := assert && i-1 == slave
+		if err := set(cs.Clock, false); nil != err {
+			return nil, err
+		}
+		if err := set(cs.Data, sel != cs.ActiveLow); nil != err {
+			return nil, err
+		}
+		seq = append(seq, cfg.Val)
+		if err := set(cs.Clock, true); nil != err {
+			return nil, err
+		}
+		seq = append(seq, cfg.Val)
+	}
+
+	if err := set(cs.Clock, false); nil != err {
+		return nil, err
+	}
+	seq = append(seq, cfg.Val)
+	if err := set(cs.Latch, true); nil != err {
+		return nil, err
+	}
+	return append(seq, cfg.Val), nil
+}
@@ -0,0 +1,124 @@
+package ft232h
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCSGPIO(t *testing.T) {
+
+	cs := &CSGPIO{Pins: []CPin{C(5), C(6), C(7)}, ActiveLow: true}
+
+	for _, test := range []struct {
+		slave  uint
+		assert bool
+		val    uint8
+		ok     bool
+	}{
+		{slave: 0, assert: true, val: 0xC0, ok: true},
+		{slave: 2, assert: true, val: 0x60, ok: true},
+		{slave: 2, assert: false, val: 0xE0, ok: true},
+		{slave: 3, assert: true, ok: false},
+	} {
+		name := fmt.Sprintf("%d:%t", test.slave, test.assert)
+		t.Run(name, func(s *testing.T) {
+			cfg := GPIOConfigDefault()
+			err := cs.config(cfg, test.slave, test.assert)
+			if test.ok != (nil == err) {
+				s.Fatalf("unexpected result: %v", err)
+			}
+			if !test.ok {
+				return
+			}
+			if 0xE0 != cfg.Dir {
+				s.Fatalf("unexpected direction: %08b", cfg.Dir)
+			}
+			if test.val != cfg.Val {
+				s.Fatalf("unexpected value: %08b != %08b", cfg.Val, test.val)
+			}
+		})
+	}
+}
+
+func TestCSDecoder(t *testing.T) {
+
+	cs := &CSDecoder{
+		Addr:            []CPin{C(0), C(1), C(2), C(3)},
+		Enable:          C(4),
+		EnableActiveLow: true,
+	}
+
+	if 16 != cs.Slaves() {
+		t.Fatalf("unexpected number of slaves: %d", cs.Slaves())
+	}
+
+	for _, test := range []struct {
+		slave  uint
+		assert bool
+		seq    []uint8
+		ok     bool
+	}{
+		{slave: 5, assert: true, seq: []uint8{0x10, 0x15, 0x05}, ok: true},
+		{slave: 15, assert: true, seq: []uint8{0x10, 0x1F, 0x0F}, ok: true},
+		{slave: 5, assert: false, seq: []uint8{0x10}, ok: true},
+		{slave: 16, assert: true, ok: false},
+	} {
+		name := fmt.Sprintf("%d:%t", test.slave, test.assert)
+		t.Run(name, func(s *testing.T) {
+			seq, err := cs.Sequence(GPIOConfigDefault(), test.slave, test.assert)
+			if test.ok != (nil == err) {
+				s.Fatalf("unexpected result: %v", err)
+			}
+			if fmt.Sprint(test.seq) != fmt.Sprint(seq) && test.ok {
+				s.Fatalf("unexpected sequence: %v != %v", seq, test.seq)
+			}
+		})
+	}
+}
+
+func TestCSShiftRegister(t *testing.T) {
+
+	for _, test := range []struct {
+		cs     *CSShiftRegister
+		slave  uint
+		assert bool
+		seq    []uint8
+		ok     bool
+	}{
+		{
+			cs:    &CSShiftRegister{Data: C(0), Clock: C(1), Latch: C(2), Outputs: 4},
+			slave: 1, assert: true,
+			seq: []uint8{0x00, 0x02, 0x00, 0x02, 0x01, 0x03, 0x00, 0x02, 0x00, 0x04},
+			ok:  true,
+		},
+		{
+			cs:    &CSShiftRegister{Data: C(0), Clock: C(1), Latch: C(2), Outputs: 2},
+			slave: 0, assert: false,
+			seq: []uint8{0x00, 0x02, 0x00, 0x02, 0x00, 0x04},
+			ok:  true,
+		},
+		{
+			cs: &CSShiftRegister{Data: C(0), Clock: C(1), Latch: C(2), Outputs: 2,
+				ActiveLow: true},
+			slave: 0, assert: true,
+			seq: []uint8{0x01, 0x03, 0x00, 0x02, 0x00, 0x04},
+			ok:  true,
+		},
+		{
+			cs:    &CSShiftRegister{Data: C(0), Clock: C(1), Latch: C(2), Outputs: 8},
+			slave: 8, assert: true,
+			ok: false,
+		},
+	} {
+		name := fmt.Sprintf("%d/%d:%t", test.slave, test.cs.Outputs, test.assert)
+		t.Run(name, func(s *testing.T) {
+			seq, err := test.cs.Sequence(GPIOConfigDefault(), test.slave, test.assert)
+			if test.ok != (nil == err) {
+				s.Fatalf("unexpected result: %v", err)
+			}
+			if fmt.Sprint(test.seq) != fmt.Sprint(seq) && test.ok {
+				s.Fatalf("unexpected sequence: %v != %v", seq, test.seq)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package ft232h
+
+import (
+	"fmt"
+)
+
+// ClockRounding defines the policy used to select a clock rate that the MPSSE
+// engine can actually generate when the requested clock rate cannot be
+// generated exactly.
+//
+// The MPSSE engine derives its clock from either a 60 MHz or 12 MHz (60 MHz
+// divided by 5) master clock with a 16-bit divisor, so only discrete clock rates
+// are possible: 60 MHz/((1+divisor)*2) or 12 MHz/((1+divisor)*2), or with
+// 3-phase clocking enabled (I²C), 60 MHz/((1+divisor)*3) or
+// 12 MHz/((1+divisor)*3).
+type ClockRounding uint8
+
+// Constants defining the supported clock rate rounding policies.
+const (
+	ClockAtMost  ClockRounding = iota // fastest rate not exceeding request
+	ClockNearest                      // rate nearest to request
+	ClockAtLeast                      // slowest rate not below request
+
+	ClockRoundingDefault = ClockAtMost
+)
+
+// String returns a descriptive string of a ClockRounding.
+func (r ClockRounding) String() string {
+	switch r {
+	case ClockAtMost:
+		return "at most"
+	case ClockNearest:
+		return "nearest"
+	case ClockAtLeast:
+		return "at least"
+	default:
+		return "(invalid rounding)"
+	}
+}
+
+// Constants related to the MPSSE master clock and divisor.
+const (
+	mpsseClockMaster  uint64 = 60000000 // master clock, divide-by-5 disabled
+	mpsseClockDivide5 uint64 = 12000000 // master clock, divide-by-5 enabled
+	mpsseDivisorMax   uint64 = 0xFFFF   // max value of 16-bit clock divisor
+)
+
+// mpsseClock holds the MPSSE clock settings used to generate a clock rate.
+type mpsseClock struct {
+	divisor uint16 // value of the 16-bit clock divisor
+	divide5 bool   // 12 MHz master clock if true, otherwise 60 MHz
+	phases  uint8  // clock phases per data bit (2, or 3 for 3-phase clocking)
+}
+
+// String returns a descriptive string of an mpsseClock.
+func (c mpsseClock) String() string {
+	return fmt.Sprintf("{ Divisor: %d, Divide5: %t, Phases: %d, Rate: %d }",
+		c.divisor, c.divide5, c.phases, c.rate())
+}
+
+// master returns the frequency of the master clock used by the receiver c.
+func (c mpsseClock) master() uint64 {
+	if c.divide5 {
+		return mpsseClockDivide5
+	}
+	return mpsseClockMaster
+}
+
+// rate returns the effective clock rate (in Hz, rounded down) generated by the
+// MPSSE engine using the settings in the receiver c.
+func (c mpsseClock) rate() uint32 {
+	return uint32(c.master() / ((uint64(c.divisor) + 1) * uint64(c.phases)))
+}
+
+// cmd returns the MPSSE command sequence that configures the master clock and
+// clock divisor of the receiver c.
+func (c mpsseClock) cmd() []uint8 {
+	div5 := mpsseDisableClockDivide5
+	if c.divide5 {
+		div5 = mpsseEnableClockDivide5
+	}
+	return []uint8{div5, mpsseSetClockDivisor,
+		uint8(c.divisor & 0xFF), uint8((c.divisor >> 8) & 0xFF)}
+}
+
+// newMPSSEClock selects the MPSSE clock settings used to generate the given
+// clock rate with the given number of clock phases per data bit (2, or 3 for
+// 3-phase clocking) using the given rounding policy.
+// Returns a non-nil error if no clock rate satisfies the rounding policy, i.e.
+// if the requested rate is slower than the slowest possible rate (ClockAtMost)
+// or faster than the fastest possible rate (ClockAtLeast).
+func newMPSSEClock(rate uint32, phases uint8, round ClockRounding) (mpsseClock, error) {
+
+	if 0 == rate {
+		return mpsseClock{}, fmt.Errorf("invalid clock rate: %d", rate)
+	}
+
+	if 2 != phases && 3 != phases {
+		return mpsseClock{}, fmt.Errorf("invalid clock phases: %d", phases)
+	}
+
+	var (
+		sel mpsseClock
+		ok  bool
+	)
+
+	// the actual rate of clock c is master/(n*phases), with n = divisor+1. all
+	// comparisons below are cross-multiplied to avoid rounding errors.
+	req := uint64(rate) * uint64(phases)
+	cmp := func(c mpsseClock) int64 { // sign of (actual - requested)
+		return int64(c.master()) - int64(req*(uint64(c.divisor)+1))
+	}
+	abs := func(c mpsseClock) uint64 { // |actual - requested| * n * phases
+		if d := cmp(c); d < 0 {
+			return uint64(-d)
+		} else {
+			return uint64(d)
+		}
+	}
+	better := func(c mpsseClock) bool {
+		if !ok {
+			return true
+		}
+		switch round {
+		case ClockAtMost: // prefer the fastest rate
+			return c.rate() > sel.rate()
+		case ClockAtLeast: // prefer the slowest rate
+			return c.rate() < sel.rate()
+		default: // prefer the nearest rate
+			// compare |a/na - r| < |b/nb - r| as |a - r*na|*nb < |b - r*nb|*na
+			na := uint64(c.divisor) + 1
+			nb := uint64(sel.divisor) + 1
+			return abs(c)*nb < abs(sel)*na
+		}
+	}
+
+	// check the candidate divisors on either side of the requested rate, using
+	// each of the master clocks. the 60 MHz master clock is checked first so that
+	// it is preferred when both master clocks generate the same rate.
+	for _, div5 := range []bool{false, true} {
+		c := mpsseClock{divide5: div5, phases: phases}
+		n := c.master() / req // floor, rate ≥ requested
+		for _, m := range []uint64{n, n + 1} {
+			if m < 1 || m > mpsseDivisorMax+1 {
+				continue
+			}
+			c.divisor = uint16(m - 1)
+			switch round {
+			case ClockAtMost:
+				if cmp(c) > 0 {
+					continue
+				}
+			case ClockAtLeast:
+				if cmp(c) < 0 {
+					continue
+				}
+			case ClockNearest:
+			default:
+				return mpsseClock{}, fmt.Errorf("invalid clock rounding: %d", round)
+			}
+			if better(c) {
+				sel, ok = c, true
+			}
+		}
+	}
+
+	// if the requested rate is outside the range of possible rates, but the
+	// rounding policy permits, use the fastest or slowest possible rate.
+	if !ok && ClockAtLeast != round {
+		if max := (mpsseClock{divisor: 0, phases: phases}); cmp(max) <= 0 {
+			sel, ok = max, true
+		}
+	}
+	if !ok && ClockAtMost != round {
+		min := mpsseClock{divisor: uint16(mpsseDivisorMax), divide5: true, phases: phases}
+		if cmp(min) >= 0 {
+			sel, ok = min, true
+		}
+	}
+
+	if !ok {
+		return mpsseClock{}, fmt.Errorf("clock rate %d Hz not possible (rounding: %s)",
+			rate, round)
+	}
+
+	return sel, nil
+}
@@ -0,0 +1,105 @@
+package ft232h
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMPSSEClock(t *testing.T) {
+
+	for _, test := range []struct {
+		rate    uint32
+		phases  uint8
+		round   ClockRounding
+		divisor uint16
+		divide5 bool
+		exp     uint32
+		ok      bool // true if expected to find a clock rate
+	}{
+		{
+			rate: 30000000, phases: 2, round: ClockAtMost,
+			divisor: 0, divide5: false, exp: 30000000, ok: true,
+		},
+		{
+			rate: 7000000, phases: 2, round: ClockAtMost,
+			divisor: 4, divide5: false, exp: 6000000, ok: true,
+		},
+		{
+			rate: 7000000, phases: 2, round: ClockAtLeast,
+			divisor: 3, divide5: false, exp: 7500000, ok: true,
+		},
+		{
+			rate: 7000000, phases: 2, round: ClockNearest,
+			divisor: 3, divide5: false, exp: 7500000, ok: true,
+		},
+		{
+			rate: 400000, phases: 2, round: ClockNearest,
+			divisor: 74, divide5: false, exp: 400000, ok: true,
+		},
+		{
+			rate: 400000, phases: 3, round: ClockAtMost,
+			divisor: 49, divide5: false, exp: 400000, ok: true,
+		},
+		{
+			rate: 3400000, phases: 3, round: ClockAtMost,
+			divisor: 5, divide5: false, exp: 3333333, ok: true,
+		},
+		{
+			rate: 3400000, phases: 3, round: ClockAtLeast,
+			divisor: 4, divide5: false, exp: 4000000, ok: true,
+		},
+		{
+			rate: 100, phases: 2, round: ClockAtMost,
+			divisor: 59999, divide5: true, exp: 100, ok: true,
+		},
+		{
+			rate: 50, phases: 2, round: ClockAtLeast,
+			divisor: 65535, divide5: true, exp: 91, ok: true,
+		},
+		{
+			rate: 50, phases: 2, round: ClockNearest,
+			divisor: 65535, divide5: true, exp: 91, ok: true,
+		},
+		{
+			rate: 50, phases: 2, round: ClockAtMost,
+			ok: false,
+		},
+		{
+			rate: 40000000, phases: 2, round: ClockAtMost,
+			divisor: 0, divide5: false, exp: 30000000, ok: true,
+		},
+		{
+			rate: 40000000, phases: 2, round: ClockAtLeast,
+			ok: false,
+		},
+		{
+			rate: 0, phases: 2, round: ClockAtMost,
+			ok: false,
+		},
+		{
+			rate: 1000000, phases: 4, round: ClockAtMost,
+			ok: false,
+		},
+	} {
+		t.Run(fmt.Sprintf("%d/%d/%s", test.rate, test.phases, test.round),
+			func(s *testing.T) {
+				c, err := newMPSSEClock(test.rate, test.phases, test.round)
+				if test.ok {
+					if nil != err {
+						s.Fatalf("could not select clock: %v", err)
+					}
+					if c.divisor != test.divisor || c.divide5 != test.divide5 {
+						s.Fatalf("clock={%s}, expected divisor={%d} divide5={%t}",
+							c, test.divisor, test.divide5)
+					}
+					if c.rate() != test.exp {
+						s.Fatalf("clock={%s}, expected rate={%d}", c, test.exp)
+					}
+				} else {
+					if nil == err {
+						s.Fatalf("selected clock={%s}, expected error", c)
+					}
+				}
+			})
+	}
+}
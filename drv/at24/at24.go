@@ -0,0 +1,217 @@
+package at24
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ardnew/ft232h"
+)
+
+// Model describes the memory organization of a 24Cxx EEPROM.
+// Devices larger than the memory address space (256 bytes with 1-byte memory
+// addresses, 64 KiB with 2-byte memory addresses) are divided into blocks, each
+// selected with bits of the slave address beginning with bit BlockBit.
+type Model struct {
+	Size      uint // total capacity (bytes)
+	PageSize  uint // page write buffer size (bytes)
+	AddrBytes uint // memory address bytes (1 or 2)
+	BlockBit  uint // lowest slave address bit selecting a block
+}
+
+var (
+	AT24C01   = Model{Size: 128, PageSize: 8, AddrBytes: 1}
+	AT24C02   = Model{Size: 256, PageSize: 8, AddrBytes: 1}
+	AT24C04   = Model{Size: 512, PageSize: 16, AddrBytes: 1}
+	AT24C08   = Model{Size: 1024, PageSize: 16, AddrBytes: 1}
+	AT24C16   = Model{Size: 2048, PageSize: 16, AddrBytes: 1}
+	AT24C32   = Model{Size: 4096, PageSize: 32, AddrBytes: 2}
+	AT24C64   = Model{Size: 8192, PageSize: 32, AddrBytes: 2}
+	AT24C128  = Model{Size: 16384, PageSize: 64, AddrBytes: 2}
+	AT24C256  = Model{Size: 32768, PageSize: 64, AddrBytes: 2}
+	AT24C512  = Model{Size: 65536, PageSize: 128, AddrBytes: 2}
+	AT24C1024 = Model{Size: 131072, PageSize: 256, AddrBytes: 2}              // AT24CM01
+	AT24C1025 = Model{Size: 131072, PageSize: 128, AddrBytes: 2, BlockBit: 2} // 24LC1025
+)
+
+func (m Model) blockSize() uint {
+	return 1 << (8 * m.AddrBytes)
+}
+
+func (m Model) validate() error {
+	if 1 != m.AddrBytes && 2 != m.AddrBytes {
+		return fmt.Errorf("invalid memory address size: %d", m.AddrBytes)
+	}
+	if 0 == m.PageSize || 0 != m.PageSize&(m.PageSize-1) {
+		return fmt.Errorf("invalid page size: %d", m.PageSize)
+	}
+	if 0 == m.Size || 0 != m.Size%m.PageSize {
+		return fmt.Errorf("invalid capacity: %d", m.Size)
+	}
+	if blocks := m.Size / m.blockSize(); blocks > 1 &&
+		(blocks-1)<<m.BlockBit > 0x07 {
+		return fmt.Errorf("invalid block select bit: %d (%d blocks)", m.BlockBit, blocks)
+	}
+	return nil
+}
+
+// chunk is a contiguous range of memory that can be transferred in a single
+// I²C transaction.
+type chunk struct {
+	off uint
+	n   uint
+}
+
+// chunks splits the n bytes at offset off into ranges that do not cross a
+// boundary of the given size, which must be a power of 2.
+func chunks(off uint, n uint, boundary uint) []chunk {
+	var c []chunk
+	for n > 0 {
+		k := boundary - off&(boundary-1)
+		if k > n {
+			k = n
+		}
+		c = append(c, chunk{off: off, n: k})
+		off += k
+		n -= k
+	}
+	return c
+}
+
+// Constants defining the default configuration settings.
+const (
+	AddrDefault         ft232h.I2CAddr = 0x50
+	WriteTimeoutDefault                = 25 * time.Millisecond
+)
+
+type Config struct {
+	Model        Model
+	Addr         ft232h.I2CAddr // slave address, including A2-A0 pin strapping
+	WriteTimeout time.Duration  // max write cycle time (ACK polling timeout)
+}
+
+// AT24 implements io.ReaderAt and io.WriterAt for a 24Cxx EEPROM.
+type AT24 struct {
+	i2c    ft232h.I2CBus
+	config *Config
+}
+
+// New returns a driver for the EEPROM described by the given config, using the
+// I²C interface of the given FT232H, which must be initialized.
+func New(ft *ft232h.FT232H, config *Config) (*AT24, error) {
+	return NewBus(ft.I2C, config)
+}
+
+// NewBus returns a driver for the EEPROM described by the given config, using
+// the given I²C bus, e.g., a channel of an I²C multiplexer.
+func NewBus(bus ft232h.I2CBus, config *Config) (*AT24, error) {
+
+	if err := config.Model.validate(); nil != err {
+		return nil, err
+	}
+
+	c := *config
+	if 0 == c.Addr {
+		c.Addr = AddrDefault
+	}
+	if 0 == c.WriteTimeout {
+		c.WriteTimeout = WriteTimeoutDefault
+	}
+
+	return &AT24{i2c: bus, config: &c}, nil
+}
+
+// Size returns the capacity of the EEPROM in bytes.
+func (e *AT24) Size() int64 {
+	return int64(e.config.Model.Size)
+}
+
+// address returns the slave address and memory address bytes used to access
+// the given offset.
+func (e *AT24) address(off uint) (ft232h.I2CAddr, []uint8) {
+	m := e.config.Model
+	block := off / m.blockSize()
+	slave := e.config.Addr | ft232h.I2CAddr(block<<m.BlockBit)
+	return slave, ft232h.MSB.Bytes(m.AddrBytes, uint64(off%m.blockSize()))
+}
+
+// span returns the number of bytes of a transfer of the given length at the
+// given offset that fit in the EEPROM, and io.EOF if it is less than length.
+func (e *AT24) span(off int64, length int) (uint, error) {
+	if off < 0 || off > e.Size() {
+		return 0, fmt.Errorf("invalid offset: %d", off)
+	}
+	if rem := e.Size() - off; int64(length) > rem {
+		return uint(rem), io.EOF
+	}
+	return uint(length), nil
+}
+
+// ReadAt reads len(p) bytes from the EEPROM beginning at offset off.
+// Sequential reads are split only where they cross a block boundary.
+func (e *AT24) ReadAt(p []byte, off int64) (int, error) {
+
+	n, eof := e.span(off, len(p))
+	if nil != eof && io.EOF != eof {
+		return 0, eof
+	}
+
+	var read uint
+	for _, c := range chunks(uint(off), n, e.config.Model.blockSize()) {
+		slave, addr := e.address(c.off)
+		dst := p[c.off-uint(off) : c.off-uint(off)+c.n]
+		if err := e.i2c.Tx(slave, addr, dst); nil != err {
+			return int(read), err
+		}
+		read += c.n
+	}
+
+	return int(read), eof
+}
+
+// WriteAt writes len(p) bytes to the EEPROM beginning at offset off.
+// Writes are split on page boundaries, and each page write waits for the
+// internal write cycle to complete by polling the EEPROM until it acknowledges
+// its address.
+func (e *AT24) WriteAt(p []byte, off int64) (int, error) {
+
+	n, eof := e.span(off, len(p))
+	if nil != eof && io.EOF != eof {
+		return 0, eof
+	}
+
+	var wrote uint
+	for _, c := range chunks(uint(off), n, e.config.Model.PageSize) {
+		slave, addr := e.address(c.off)
+		src := p[c.off-uint(off) : c.off-uint(off)+c.n]
+		if _, err := e.i2c.Write(slave, append(addr, src...), true, true); nil != err {
+			return int(wrote), err
+		}
+		if err := e.poll(slave); nil != err {
+			return int(wrote), err
+		}
+		wrote += c.n
+	}
+
+	if nil != eof {
+		return int(wrote), io.ErrShortWrite
+	}
+	return int(wrote), nil
+}
+
+// poll waits for the write cycle to complete, during which the EEPROM does not
+// acknowledge its slave address (ACK polling).
+func (e *AT24) poll(slave ft232h.I2CAddr) error {
+	for beg := time.Now(); ; {
+		ok, err := e.i2c.Present(slave)
+		if nil != err {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if time.Since(beg) > e.config.WriteTimeout {
+			return fmt.Errorf("write cycle timeout: %s", slave)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package at24
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ardnew/ft232h"
+)
+
+func TestChunks(t *testing.T) {
+
+	for _, test := range []struct {
+		name     string
+		off      uint
+		n        uint
+		boundary uint
+		chunks   []chunk
+	}{
+		{name: "empty", off: 5, n: 0, boundary: 8},
+		{name: "within", off: 1, n: 6, boundary: 8, chunks: []chunk{{1, 6}}},
+		{name: "aligned", off: 8, n: 8, boundary: 8, chunks: []chunk{{8, 8}}},
+		{name: "split", off: 6, n: 12, boundary: 8,
+			chunks: []chunk{{6, 2}, {8, 8}, {16, 2}}},
+		{name: "block", off: 0xFFFE, n: 4, boundary: 0x10000,
+			chunks: []chunk{{0xFFFE, 2}, {0x10000, 2}}},
+	} {
+		t.Run(test.name, func(s *testing.T) {
+			if c := chunks(test.off, test.n, test.boundary); !reflect.DeepEqual(test.chunks, c) {
+				s.Fatalf("unexpected chunks: %v", c)
+			}
+		})
+	}
+}
+
+func TestAddress(t *testing.T) {
+
+	for _, test := range []struct {
+		name  string
+		model Model
+		addr  ft232h.I2CAddr
+		off   uint
+		slave ft232h.I2CAddr
+		mem   []uint8
+	}{
+		{name: "24C02", model: AT24C02, addr: 0x51, off: 0xAB, slave: 0x51, mem: []uint8{0xAB}},
+		{name: "24C04", model: AT24C04, addr: 0x50, off: 0x1AB, slave: 0x51, mem: []uint8{0xAB}},
+		{name: "24C16", model: AT24C16, addr: 0x50, off: 0x7FF, slave: 0x57, mem: []uint8{0xFF}},
+		{name: "24C256", model: AT24C256, addr: 0x52, off: 0x1234, slave: 0x52, mem: []uint8{0x12, 0x34}},
+		{name: "24C1024", model: AT24C1024, addr: 0x50, off: 0x11234, slave: 0x51, mem: []uint8{0x12, 0x34}},
+		{name: "24C1025", model: AT24C1025, addr: 0x50, off: 0x11234, slave: 0x54, mem: []uint8{0x12, 0x34}},
+	} {
+		t.Run(test.name, func(s *testing.T) {
+			if err := test.model.validate(); nil != err {
+				s.Fatalf("invalid model: %v", err)
+			}
+			e := &AT24{config: &Config{Model: test.model, Addr: test.addr}}
+			slave, mem := e.address(test.off)
+			if test.slave != slave || !reflect.DeepEqual(test.mem, mem) {
+				s.Fatalf("unexpected address: %s %v", slave, mem)
+			}
+		})
+	}
+}
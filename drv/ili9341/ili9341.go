@@ -564,18 +564,18 @@ func (lcd *ILI9341) DrawBitmapRect1BPP(fg RGB, bg RGB, x int, y int, w int, h in
 	return lcd.DrawBitmap1BPP(fg, bg, MakeFrame(x, y, w, h), bmp)
 }
 
-func (lcd *ILI9341) DrawBitmap16BPP(frame Frame, bmp []uint16) error {
+func (lcd *ILI9341) bitmap16BPP(frame Frame, bmp []uint16) (Frame, []uint8, error) {
 
 	fr := lcd.Normalize(frame)
 	if 0 == fr.Size.Width || 0 == fr.Size.Height {
-		return nil
+		return fr, nil, nil
 	}
 
 	w, h := fr.Size.Width, fr.Size.Height
 
 	numPx := w * h
 	if numPx > len(bmp) {
-		return fmt.Errorf("not enough data to fill drawing area")
+		return fr, nil, fmt.Errorf("not enough data to fill drawing area")
 	}
 
 	// re-order color data, MSB-first
@@ -585,6 +585,16 @@ func (lcd *ILI9341) DrawBitmap16BPP(frame Frame, bmp []uint16) error {
 		data[2*i+1] = uint8(rgb>>0) & 0xFF
 	}
 
+	return fr, data, nil
+}
+
+func (lcd *ILI9341) DrawBitmap16BPP(frame Frame, bmp []uint16) error {
+
+	fr, data, err := lcd.bitmap16BPP(frame, bmp)
+	if nil != err || 0 == len(data) {
+		return err
+	}
+
 	if err := lcd.SetFrame(fr); nil != err {
 		return err
 	}
@@ -597,3 +607,34 @@ func (lcd *ILI9341) DrawBitmap16BPP(frame Frame, bmp []uint16) error {
 func (lcd *ILI9341) DrawBitmapRect16BPP(x int, y int, w int, h int, bmp []uint16) error {
 	return lcd.DrawBitmap16BPP(MakeFrame(x, y, w, h), bmp)
 }
+
+func (lcd *ILI9341) Stream(depth uint) *ft232h.SPIStream {
+	return lcd.device.SPI.Stream(depth)
+}
+
+func (lcd *ILI9341) StreamBitmap16BPP(stream *ft232h.SPIStream, frame Frame, bmp []uint16) error {
+
+	fr, data, err := lcd.bitmap16BPP(frame, bmp)
+	if nil != err || 0 == len(data) {
+		return err
+	}
+
+	// the bitmap is copied into data, so the caller may begin rendering the next
+	// frame into bmp immediately. the address window and DC line are configured
+	// from the stream goroutine so that they remain ordered with the transfers.
+	return stream.Send(&ft232h.SPIFrame{
+		Data:  data,
+		Start: true,
+		Stop:  true,
+		Prepare: func() error {
+			if err := lcd.SetFrame(fr); nil != err {
+				return err
+			}
+			return lcd.setPinDC(true)
+		},
+	})
+}
+
+func (lcd *ILI9341) StreamBitmapRect16BPP(stream *ft232h.SPIStream, x int, y int, w int, h int, bmp []uint16) error {
+	return lcd.StreamBitmap16BPP(stream, MakeFrame(x, y, w, h), bmp)
+}
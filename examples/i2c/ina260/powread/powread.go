@@ -7,8 +7,9 @@ import (
 )
 
 const (
-	slave = 0x40       // default INA260 slave address
-	order = ft232h.MSB // byte order of INA260 data transfers
+	slaveMin = 0x40       // INA260 slave address range, selected with pins A0/A1
+	slaveMax = 0x4F       //
+	order    = ft232h.MSB // byte order of INA260 data transfers
 
 	// register addresses
 	cAddr = 0x01 // voltage
@@ -37,6 +38,22 @@ func main() {
 		log.Fatalf("I2C.Init(): %v", err)
 	}
 
+	// find the INA260 on the bus
+	scan, err := ft.I2C.Scan(&ft232h.I2CScanOption{
+		First: slaveMin,
+		Last:  slaveMax,
+		Probe: ft232h.I2CProbeReadByte,
+	})
+	if nil != err {
+		log.Fatalf("I2C.Scan(): %v", err)
+	}
+	log.Printf("I²C bus scan:\n%s", scan)
+	found := scan.Addrs()
+	if 0 == len(found) {
+		log.Fatalf("INA260 not found (0x%02X-0x%02X)", slaveMin, slaveMax)
+	}
+	slave := found[0]
+
 	// create a voltage register object
 	reg := ft.I2C.Reg(slave, vAddr, ft232h.Addr8Bit, order)
 
@@ -87,6 +87,11 @@ func boing(lcd *ili9341.ILI9341) error {
 	ballVel = coord{0.8, YBounce}
 	ballFrame = 3 // Ball animation frame #
 
+	// transfer each frame in the background while rendering the next one
+	stream := lcd.Stream(ft232h.SPIStreamDepthDefault)
+	defer stream.Close()
+	pending := uint(0)
+
 	startTime = time.Now().UnixNano()
 
 	for {
@@ -212,11 +217,19 @@ func boing(lcd *ili9341.ILI9341) error {
 			gy++
 		}
 
-		err := lcd.DrawBitmapRect16BPP(minX, minY, width-1, height-1, frameBuffer[:width*height])
+		err := lcd.StreamBitmapRect16BPP(stream, minX, minY, width-1, height-1, frameBuffer[:width*height])
 		if nil != err {
 			return err
 		}
 
+		// wait for the oldest frame once the stream is full
+		if pending++; pending >= ft232h.SPIStreamDepthDefault {
+			if f := <-stream.Done(); nil != f.Err {
+				return f.Err
+			}
+			pending--
+		}
+
 		// Show approximate frame rate
 		frame++
 		if frame&0xFF == 0 { // Every 256 frames...
@@ -25,12 +25,15 @@ type FT232H struct {
 	I2C  *I2C
 	SPI  *SPI
 	GPIO *GPIO
+	UART *UART
+	JTAG *JTAG
+	SWD  *SWD
 }
 
 // String constructs a string representation of an FT232H device.
 func (m *FT232H) String() string {
-	return fmt.Sprintf("{ Index: %s, Mode: %q, Flag: %+v, I2C: %s, SPI: %+v, GPIO: %s }",
-		m.info, m.mode, m.flag, m.I2C, m.SPI, m.GPIO)
+	return fmt.Sprintf("{ Index: %s, Mode: %q, Flag: %+v, I2C: %s, SPI: %+v, GPIO: %s, UART: %s, JTAG: %s, SWD: %s }",
+		m.info, m.mode, m.flag, m.I2C, m.SPI, m.GPIO, m.UART, m.JTAG, m.SWD)
 }
 
 // Mask contains strings for each of the supported attributes used to
@@ -136,13 +139,16 @@ func OpenFlag(arg []string, fatal bool) (*FT232H, error) {
 // for numeric literals (e.g., "13", "0b1101", "0xD", and "D" are all valid and
 // equivalent).
 func OpenMask(mask *Mask) (*FT232H, error) {
-	m := &FT232H{info: nil, mode: ModeNone, flag: nil, I2C: nil, SPI: nil, GPIO: nil}
+	m := &FT232H{info: nil, mode: ModeNone, flag: nil, I2C: nil, SPI: nil, GPIO: nil, UART: nil, JTAG: nil, SWD: nil}
 	if err := m.openDevice(mask); nil != err {
 		return nil, err
 	}
 	m.I2C = &I2C{device: m, config: i2cConfigDefault()}
 	m.SPI = &SPI{device: m, config: spiConfigDefault()}
 	m.GPIO = &GPIO{device: m, config: GPIOConfigDefault()}
+	m.UART = &UART{device: m, config: UARTConfigDefault()}
+	m.JTAG = &JTAG{device: m, config: jtagConfigDefault(), state: TAPUnknown}
+	m.SWD = &SWD{device: m, config: swdConfigDefault()}
 	if err := m.GPIO.Init(); nil != err {
 		return nil, err
 	}
@@ -3,6 +3,7 @@ package ft232h
 import (
 	"fmt"
 	"math/bits"
+	"time"
 )
 
 // I2C stores interface configuration settings for an I²C master and provides
@@ -12,6 +13,21 @@ import (
 type I2C struct {
 	device *FT232H
 	config *i2cConfig
+	tracer Tracer // records each transfer, if non-nil (see Trace)
+}
+
+// I2CBus is the interface implemented by I²C buses: the I²C interface of an
+// FT232H (*I2C) and each channel of an I²C multiplexer (*I2CMuxChannel).
+// Drivers of I²C slave devices should use an I2CBus so that they work the same
+// whether or not the device is behind a multiplexer.
+type I2CBus interface {
+	Read(slave I2CAddr, count uint, start bool, stop bool) ([]uint8, error)
+	Write(slave I2CAddr, data []uint8, start bool, stop bool) (uint, error)
+	Transfer(msgs []I2CMsg) error
+	Tx(slave I2CAddr, w []uint8, r []uint8) error
+	Present(slave I2CAddr) (bool, error)
+	Reg(slave I2CAddr, addr uint, space AddrSpace, order ByteOrder) *I2CReg
+	RegMap(slave I2CAddr, m *RegMap) (*I2CRegMap, error)
 }
 
 // String returns a descriptive string of an I²C interface.
@@ -23,10 +39,15 @@ func (i2c *I2C) String() string {
 // interface.
 type I2CConfig struct {
 	*I2COption
-	Clock        I2CClockRate // 100000 (100 kb/s) - 3400000 (3.4 Mb/s)
-	Latency      byte         // 1-255 USB HiSpeed, 2-255 USB FullSpeed
-	Clock3Phase  bool         // I²C 3-phase clocking enabled=true/disabled=false
-	LowDriveOnly bool         // float HIGH (pullup) if true, drive HIGH if false
+	Clock        I2CClockRate  // any rate up to 3400000 (3.4 Mb/s)
+	Latency      byte          // 1-255 USB HiSpeed, 2-255 USB FullSpeed
+	Clock3Phase  bool          // I²C 3-phase clocking enabled=true/disabled=false
+	LowDriveOnly bool          // float HIGH (pullup) if true, drive HIGH if false
+	Rounding     ClockRounding // policy used when Clock is not exactly possible
+	// ClockStretching waits for slaves holding SCL LOW (clock stretching) using
+	// the MPSSE adaptive clocking mode, which requires SCL (D0) to be connected
+	// to GPIOL3 (D7) with a jumper wire, and LowDriveOnly to be enabled.
+	ClockStretching bool
 }
 
 // I2CConfigDefault returns the default configuration settings for an I²C
@@ -36,6 +57,9 @@ func I2CConfigDefault() *I2CConfig {
 }
 
 // I2CConfig returns the current configuration settings of the I2C receiver.
+// The Clock field contains the effective clock rate generated by the MPSSE
+// engine, which may differ from the clock rate requested with Config (see type
+// ClockRounding).
 func (i2c *I2C) GetConfig() *I2CConfig {
 	return i2c.config.I2CConfig()
 }
@@ -46,6 +70,122 @@ const (
 	I2CSlaveAddressMax = 0x77
 )
 
+// Constants defining the entire 7-bit I²C address space, including the addresses
+// reserved by the I²C specification, which are only legal with
+// I2COption.AllowReserved.
+const (
+	I2CAddressMin = 0x00
+	I2CAddressMax = 0x7F
+)
+
+// Constants defining the ranges of 7-bit I²C addresses reserved by the I²C
+// specification, e.g. for general call, START byte, high-speed mode master
+// codes, and the prefix of 10-bit addresses.
+const (
+	I2CReservedLowMin  = 0x00
+	I2CReservedLowMax  = 0x07
+	I2CReservedHighMin = 0x78
+	I2CReservedHighMax = 0x7F
+)
+
+// Constants related to the I²C general call address.
+const (
+	I2CGeneralCall      I2CAddr = 0x00 // general call address
+	i2cGeneralCallReset uint8   = 0x06 // reset and write programmable address
+)
+
+// I2CAddr represents an unshifted I²C slave address, either 7-bit or 10-bit.
+// A 7-bit address is simply the address value, e.g. I2CAddr(0x40), and a 10-bit
+// address is constructed with I2CAddr10.
+type I2CAddr uint
+
+// Constants related to 10-bit I²C slave addresses.
+const (
+	I2CAddr10Bit     I2CAddr = 0x8000 // flag distinguishing 10-bit addresses
+	I2CAddr10BitMax          = 0x03FF // maximum 10-bit address
+	i2cAddr10BitHead         = 0x78   // 7-bit form of 10-bit prefix 11110xx
+)
+
+// I2CAddr10 returns the I2CAddr of the given 10-bit slave address.
+func I2CAddr10(addr uint) I2CAddr {
+	return I2CAddr10Bit | I2CAddr(addr)
+}
+
+// Is10Bit returns true if the receiver a is a 10-bit slave address.
+func (a I2CAddr) Is10Bit() bool {
+	return 0 != a&I2CAddr10Bit
+}
+
+// Addr returns the unshifted slave address, without the 10-bit flag.
+func (a I2CAddr) Addr() uint {
+	return uint(a &^ I2CAddr10Bit)
+}
+
+// String returns a descriptive string of an I2CAddr.
+func (a I2CAddr) String() string {
+	if a.Is10Bit() {
+		return fmt.Sprintf("0x%03X (10-bit)", a.Addr())
+	}
+	return fmt.Sprintf("0x%02X", a.Addr())
+}
+
+// Reserved returns true if the receiver a is a 7-bit address reserved by the I²C
+// specification (I2CReservedLowMin-I2CReservedLowMax or
+// I2CReservedHighMin-I2CReservedHighMax).
+func (a I2CAddr) Reserved() bool {
+	if a.Is10Bit() {
+		return false
+	}
+	return a <= I2CReservedLowMax ||
+		(a >= I2CReservedHighMin && a <= I2CReservedHighMax)
+}
+
+// validate returns a non-nil error if the receiver a is not a legal 7-bit or
+// 10-bit slave address. If reserved is true, all 7-bit addresses are legal,
+// including those reserved by the I²C specification (0x00-0x07, 0x78-0x7F).
+func (a I2CAddr) validate(reserved bool) error {
+	if a.Is10Bit() {
+		if a.Addr() > I2CAddr10BitMax {
+			return fmt.Errorf("invalid 10-bit slave address (0x000-0x%03X): 0x%03X",
+				I2CAddr10BitMax, a.Addr())
+		}
+		return nil
+	}
+	if reserved {
+		if a > I2CAddressMax {
+			return fmt.Errorf("invalid slave address (0x%02X-0x%02X): 0x%02X",
+				I2CAddressMin, I2CAddressMax, a.Addr())
+		}
+		return nil
+	}
+	if !(a >= I2CSlaveAddressMin && a <= I2CSlaveAddressMax) {
+		return fmt.Errorf("invalid slave address (0x%02X-0x%02X): 0x%02X",
+			I2CSlaveAddressMin, I2CSlaveAddressMax, a.Addr())
+	}
+	return nil
+}
+
+// head returns the 7-bit address sent in the first address byte of a transfer
+// with the receiver a. For a 10-bit address, this is the reserved prefix 11110
+// followed by the two most significant address bits. The remaining 8 address
+// bits are sent in the second address byte (see tail).
+func (a I2CAddr) head() uint {
+	if a.Is10Bit() {
+		return i2cAddr10BitHead | ((a.Addr() >> 8) & 0x03)
+	}
+	return a.Addr()
+}
+
+// tail returns the second address byte of a transfer with the receiver a, which
+// is the 8 least significant address bits of a 10-bit address. Returns nil for
+// a 7-bit address.
+func (a I2CAddr) tail() []uint8 {
+	if a.Is10Bit() {
+		return []uint8{uint8(a.Addr() & 0xFF)}
+	}
+	return nil
+}
+
 // Constants related to I²C interface initialization.
 const (
 	I2CClockMaximum   I2CClockRate = I2CClockHighSpeedMode
@@ -56,32 +196,46 @@ const (
 // i2cConfig holds all of the configuration settings for an I²C channel stored
 // privately in each instance of I2C.
 type i2cConfig struct {
-	clockRate I2CClockRate
+	clockRate I2CClockRate  // effective clock rate
+	clock     mpsseClock    // MPSSE clock settings generating clockRate
+	rounding  ClockRounding // policy used to select clock
 	latency   uint8
 	options   i2cOption
 	breakNACK bool
 	readNACK  bool
 	noDelay   bool
+	reserved  bool
+	recover   bool
+	stretch   bool
 }
 
 // String returns a descriptive string of an i2cConfig.
 func (c i2cConfig) String() string {
 	return fmt.Sprintf("{ Clock: %q, Latency: \"%d ms\", Options: %s, "+
-		"BreakOnNACK: %t, NACKAfterRead: %t, NoUSBDelay: %t }",
-		c.clockRate, c.latency, c.options, c.breakNACK, c.readNACK, c.noDelay)
+		"BreakOnNACK: %t, NACKAfterRead: %t, NoUSBDelay: %t, AllowReserved: %t, "+
+		"AutoRecover: %t, ClockStretching: %t }",
+		c.clockRate, c.latency, c.options, c.breakNACK, c.readNACK, c.noDelay,
+		c.reserved, c.recover, c.stretch)
 }
 
 // i2cConfigDefault returns an i2cConfig struct stored in the private
 // configuration field of an I2C instance with the default settings for all
 // fields.
 func i2cConfigDefault() *i2cConfig {
+	clock, _ := i2cClock(I2CClockDefault, i2cOptionDefault.clock3Phase(),
+		ClockRoundingDefault)
 	return &i2cConfig{
-		clockRate: I2CClockDefault,
+		clockRate: I2CClockRate(clock.rate()),
+		clock:     clock,
+		rounding:  ClockRoundingDefault,
 		latency:   I2CLatencyDefault,
 		options:   i2cOptionDefault,
 		breakNACK: i2cBreakNACKDefault,
 		readNACK:  i2cLastNACKDefault,
 		noDelay:   i2cNoDelayDefault,
+		reserved:  i2cReservedDefault,
+		recover:   i2cRecoverDefault,
+		stretch:   i2cStretchDefault,
 	}
 }
 
@@ -90,21 +244,31 @@ func i2cConfigDefault() *i2cConfig {
 func (c *i2cConfig) I2CConfig() *I2CConfig {
 	return &I2CConfig{
 		I2COption: &I2COption{
-			BreakOnNACK:  c.breakNACK,
-			LastReadNACK: c.readNACK,
-			NoUSBDelay:   c.noDelay,
+			BreakOnNACK:   c.breakNACK,
+			LastReadNACK:  c.readNACK,
+			NoUSBDelay:    c.noDelay,
+			AllowReserved: c.reserved,
+			AutoRecover:   c.recover,
 		},
-		Clock:        c.clockRate,
-		Latency:      c.latency,
-		Clock3Phase:  c.options.clock3Phase(),
-		LowDriveOnly: c.options.lowDriveOnly(),
+		Clock:           c.clockRate,
+		Latency:         c.latency,
+		Clock3Phase:     c.options.clock3Phase(),
+		LowDriveOnly:    c.options.lowDriveOnly(),
+		Rounding:        c.rounding,
+		ClockStretching: c.stretch,
 	}
 }
 
-// I2CClockRate holds one of the supported I²C clock rate constants.
+// I2CClockRate holds an I²C clock rate in Hz.
+// Any rate up to I2CClockMaximum may be used, not only the standard rates
+// defined below (e.g., 50 kHz for long cables, or 250 kHz for marginal slaves).
+// Since the MPSSE engine can only generate discrete rates, the rate requested
+// is selected according to the ClockRounding policy of the configuration, and
+// the effective rate is reported by GetConfig. The slowest possible rate is
+// about 61 Hz with 3-phase clocking, or 91 Hz without.
 type I2CClockRate uint32
 
-// Constants defining the supported I²C clock rates.%d ms
+// Constants defining the standard I²C clock rates.
 const (
 	I2CClockStandardMode  I2CClockRate = 100000  // 100 kb/sec
 	I2CClockFastMode      I2CClockRate = 400000  // 400 kb/sec
@@ -112,6 +276,24 @@ const (
 	I2CClockHighSpeedMode I2CClockRate = 3400000 // 3.4 Mb/sec
 )
 
+// i2cClock returns the MPSSE clock settings used to generate the given I²C
+// clock rate with the given rounding policy. If the given rate is 0, the default
+// clock rate is used. With 3-phase clocking enabled, each data bit requires 3
+// MPSSE clock phases instead of 2.
+func i2cClock(rate I2CClockRate, clock3Phase bool, round ClockRounding) (mpsseClock, error) {
+	if 0 == rate {
+		rate = I2CClockDefault
+	}
+	if rate > I2CClockMaximum {
+		return mpsseClock{}, fmt.Errorf("invalid clock rate: %d", rate)
+	}
+	phases := uint8(2)
+	if clock3Phase {
+		phases = 3
+	}
+	return newMPSSEClock(uint32(rate), phases, round)
+}
+
 // String returns a descriptive string of an I2CClockRate.
 func (c I2CClockRate) String() string {
 	switch c {
@@ -123,18 +305,37 @@ func (c I2CClockRate) String() string {
 		return "Fast mode plus (1000 KHz)"
 	case I2CClockHighSpeedMode:
 		return "High-speed mode (3.4 MHz)"
+	}
+	switch {
+	case c > I2CClockMaximum:
+		return fmt.Sprintf("Unsupported rate (%d Hz)", c)
+	case c >= 1000000:
+		return fmt.Sprintf("%g MHz", float64(c)/1e6)
+	case c >= 1000:
+		return fmt.Sprintf("%g KHz", float64(c)/1e3)
 	default:
-		return fmt.Sprintf("Unsupported mode (%d Hz)", c)
+		return fmt.Sprintf("%d Hz", c)
 	}
-
 }
 
 // I2COption holds all of the dynamic configuration settings that can be changed
 // while an I²C interface is open.
+//
+// The AllowReserved flag permits reading and writing slave addresses reserved by
+// the I²C specification (0x00-0x07, 0x78-0x7F), which some devices use anyway.
+// Otherwise (DEFAULT), only addresses I2CSlaveAddressMin-I2CSlaveAddressMax are
+// permitted. See also GeneralCall and SoftwareReset.
+//
+// The AutoRecover flag attempts to recover the bus (see Recover) whenever a
+// transfer fails for any reason other than a slave NACK, so that a slave left
+// holding SDA LOW does not cause all subsequent transfers to fail. The original
+// error is still returned, and the failed transfer is not retried.
 type I2COption struct {
-	BreakOnNACK  bool // do not continue reading/writing stream on slave NACK
-	LastReadNACK bool // send NACK after last byte read from I²C slave
-	NoUSBDelay   bool // pack all I²C data into the fewest number of USB packets
+	BreakOnNACK   bool // do not continue reading/writing stream on slave NACK
+	LastReadNACK  bool // send NACK after last byte read from I²C slave
+	NoUSBDelay    bool // pack all I²C data into the fewest number of USB packets
+	AllowReserved bool // permit 7-bit slave addresses reserved by I²C spec
+	AutoRecover   bool // attempt bus recovery after failed transfers
 }
 
 // i2cOption stores the various I²C configuration options as a 32-bit bitmap.
@@ -178,8 +379,14 @@ const (
 	i2cBreakNACKDefault = false
 	i2cLastNACKDefault  = false
 	i2cNoDelayDefault   = true
+	i2cReservedDefault  = false
+	i2cRecoverDefault   = false
 )
 
+// i2cStretchDefault is the default clock stretching setting of an I²C
+// configuration.
+const i2cStretchDefault = false
+
 // Valid verifies the i2cOption receiver opt isnt equal to the sentinel value
 // for invalid I²C options.
 func (opt i2cOption) Valid() bool { return opt != i2cOptionInvalid }
@@ -245,6 +452,8 @@ func (i2c *I2C) Option(opt *I2COption) error {
 	i2c.config.breakNACK = opt.BreakOnNACK
 	i2c.config.readNACK = opt.LastReadNACK
 	i2c.config.noDelay = opt.NoUSBDelay
+	i2c.config.reserved = opt.AllowReserved
+	i2c.config.recover = opt.AutoRecover
 
 	return nil
 }
@@ -253,24 +462,42 @@ func (i2c *I2C) Option(opt *I2COption) error {
 // ready for read/write.
 // If the given configuration is nil, the default configuration is used (see
 // I2CConfigDefault).
+// If the given configuration is invalid, an error is returned and the current
+// configuration is left unchanged.
 // It is not necessary to call Init after calling Config.
 // See documentation of Init for other semantics.
 func (i2c *I2C) Config(cfg *I2CConfig) error {
 
+	if err := i2c.configure(cfg); nil != err {
+		return err
+	}
+
+	return i2c.Init()
+}
+
+// configure validates the given configuration and, only if it is valid, stores
+// it as the current configuration without initializing the I²C interface.
+// If the given configuration is nil, the default configuration is used.
+func (i2c *I2C) configure(cfg *I2CConfig) error {
+
 	if nil == cfg {
 		cfg = I2CConfigDefault()
 	}
 
-	if 0 == cfg.Clock {
-		i2c.config.clockRate = I2CClockDefault
-	} else {
-		if cfg.Clock <= I2CClockMaximum {
-			i2c.config.clockRate = cfg.Clock
-		} else {
-			return fmt.Errorf("invalid clock rate: %d", cfg.Clock)
-		}
+	if cfg.ClockStretching && !cfg.LowDriveOnly {
+		return fmt.Errorf("clock stretching requires LowDriveOnly (SCL must " +
+			"not be driven HIGH while a slave holds it LOW)")
 	}
 
+	clock, err := i2cClock(cfg.Clock, cfg.Clock3Phase, cfg.Rounding)
+	if nil != err {
+		return err
+	}
+
+	i2c.config.clockRate = I2CClockRate(clock.rate())
+	i2c.config.clock = clock
+	i2c.config.rounding = cfg.Rounding
+
 	if 0 == cfg.Latency {
 		i2c.config.latency = I2CLatencyDefault
 	} else {
@@ -288,12 +515,12 @@ func (i2c *I2C) Config(cfg *I2CConfig) error {
 	}
 
 	i2c.config.options = driveOpt | phaseOpt
+	i2c.config.stretch = cfg.ClockStretching
 
-	if err := i2c.Option(cfg.I2COption); nil != err {
-		return err
+	if nil != cfg.I2COption {
+		return i2c.Option(cfg.I2COption)
 	}
-
-	return i2c.Init()
+	return nil
 }
 
 // Init initializes the I²C interface to a state ready for read/write.
@@ -309,27 +536,60 @@ func (i2c *I2C) Init() error {
 
 	i2c.device.mode = ModeI2C
 
+	if err := i2c.adaptiveClock(i2c.config.stretch); nil != err {
+		return err
+	}
+
 	return i2c.device.GPIO.Init() // reset GPIO
 }
 
+// i2cRTCKMask is the pin of port "D" sampled by the MPSSE engine in adaptive
+// clocking mode (GPIOL3, D7), which must be connected to SCL (D0) for clock
+// stretching.
+const i2cRTCKMask uint8 = 0x80
+
+// adaptiveClock enables (if enable is true) or disables the MPSSE adaptive
+// clocking mode used to support clock stretching. Before enabling, it verifies
+// that SCL is connected to GPIOL3 by toggling SCL and sampling GPIOL3.
+func (i2c *I2C) adaptiveClock(enable bool) error {
+
+	if !enable {
+		_, err := _FT_Write(i2c.device.info, []uint8{mpsseDisableAdaptiveClock})
+		return err
+	}
+
+	for _, val := range []uint8{i2cValSCLLoSDAHi, i2cValSCLHiSDAHi} {
+		cmd := &i2cCmd{}
+		cmd.pins(val, i2cDirSCLOutSDAIn, i2cRecoverHold)
+		if val == i2cValSCLHiSDAHi {
+			cmd.pins(i2cValSCLHiSDAHi, i2cDirSCLInSDAIn, 1)
+		}
+		cmd.sample()
+		cmd.flush()
+		resp, err := i2c.exec(cmd)
+		if nil != err {
+			return err
+		}
+		if (0 != resp[0]&i2cRTCKMask) != (0 != val&i2cSCLMask) {
+			return fmt.Errorf("clock stretching requires SCL (D0) connected to " +
+				"GPIOL3 (D7) with a jumper wire")
+		}
+	}
+
+	_, err := _FT_Write(i2c.device.info, []uint8{mpsseEnableAdaptiveClocking})
+	return err
+}
+
 // Close closes both the I²C interface and the connection to the FT232H device.
 func (i2c *I2C) Close() error {
 	return i2c.device.Close()
 }
 
-// Read reads the given count number of bytes from the I²C interface.
-// The given slave is the unshifted 7-bit I²C slave address to read from.
-// There is no maximum length for the number of bytes to read.
+// xferOption returns the transfer options for a read (if read is true) or
+// write using the current dynamic configuration settings.
 // If start is true, an I²C start condition is generated before transfer.
 // If stop is true, an I²C stop condition is generated after transfer.
-// Returns the slice of bytes successfully read and a non-nil error if there was
-// an error.
-func (i2c *I2C) Read(slave uint, count uint, start bool, stop bool) ([]uint8, error) {
-
-	if !(slave >= I2CSlaveAddressMin && slave <= I2CSlaveAddressMax) {
-		return nil, fmt.Errorf("invalid slave address (0x%02X-0x%02X): 0x%02X",
-			I2CSlaveAddressMin, I2CSlaveAddressMax, slave)
-	}
+func (i2c *I2C) xferOption(read bool, start bool, stop bool) i2cXferOption {
 
 	opt := i2cXferDefault
 
@@ -348,7 +608,7 @@ func (i2c *I2C) Read(slave uint, count uint, start bool, stop bool) ([]uint8, er
 	// these flags are not supported when fast transfer (I2COption.NoUSBDelay)
 	// is enabled with start/stop condition generation
 	if !(i2c.config.noDelay && (start || stop)) {
-		if i2c.config.readNACK {
+		if read && i2c.config.readNACK {
 			opt |= i2cLastReadNACK
 		}
 		if i2c.config.breakNACK {
@@ -356,52 +616,141 @@ func (i2c *I2C) Read(slave uint, count uint, start bool, stop bool) ([]uint8, er
 		}
 	}
 
-	return _I2C_Read(i2c, slave, count, opt)
+	return opt
+}
+
+// Read reads the given count number of bytes from the I²C interface.
+// The given slave is the unshifted 7-bit or 10-bit I²C slave address to read
+// from.
+// There is no maximum length for the number of bytes to read.
+// If start is true, an I²C start condition is generated before transfer.
+// If stop is true, an I²C stop condition is generated after transfer.
+// For a 10-bit slave address with start true, both address bytes are first
+// written, followed by a repeated start condition and the first address byte
+// with the read bit set, as required by the I²C specification.
+// Returns the slice of bytes successfully read and a non-nil error if there was
+// an error. If the slave does not acknowledge its address, the error returned is
+// ErrAddrNACK.
+// If NoUSBDelay is set (see I2COption) and start is true, the transfer is sent
+// as a single raw MPSSE command stream instead of using libMPSSE, since its fast
+// transfers cannot detect the address NACK.
+func (i2c *I2C) Read(slave I2CAddr, count uint, start bool, stop bool) (data []uint8, err error) {
+
+	if nil != i2c.tracer {
+		defer func(beg time.Time) {
+			i2c.trace(beg, &TraceEvent{Op: TraceRead, Addr: slave,
+				Start: start, Stop: stop, Rx: data, Count: uint(len(data)), Err: err})
+		}(time.Now())
+	}
+
+	if err := slave.validate(i2c.config.reserved); nil != err {
+		return nil, err
+	}
+
+	if start && i2c.config.noDelay {
+		// libMPSSE fast transfers do not report the address ACK
+		data = make([]uint8, count)
+		n, err := i2c.xfer(I2CMsg{Addr: slave, Read: true, Data: data},
+			true, stop, i2c.config.readNACK)
+		return data[:n], i2c.fail(err)
+	}
+
+	if tail := slave.tail(); start && nil != tail {
+		if _, err := _I2C_Write(i2c, slave.head(), tail,
+			i2c.xferOption(false, true, false)); nil != err {
+			return nil, i2c.fail(err)
+		}
+	}
+
+	data, err = _I2C_Read(i2c, slave.head(), count, i2c.xferOption(true, start, stop))
+	return data, i2c.fail(err)
 }
 
 // Write writes the given byte slice data to the I²C interface.
-// The given slave is the unshifted 7-bit I²C slave address to write to.
+// The given slave is the unshifted 7-bit or 10-bit I²C slave address to write
+// to.
 // There is no maximum length for the data slice.
 // If start is true, an I²C start condition is generated before transfer.
 // If stop is true, an I²C stop condition is generated after transfer.
 // Returns the slice of bytes successfully written and a non-nil error if there
-// was an error.
-func (i2c *I2C) Write(slave uint, data []uint8, start bool, stop bool) (uint, error) {
-
-	if !(slave >= I2CSlaveAddressMin && slave <= I2CSlaveAddressMax) {
-		return 0, fmt.Errorf("invalid slave address (0x%02X-0x%02X): 0x%02X",
-			I2CSlaveAddressMin, I2CSlaveAddressMax, slave)
+// was an error. The second address byte of a 10-bit slave address is not
+// included in the number of bytes written.
+// If the slave does not acknowledge its address, the error returned is
+// ErrAddrNACK. If BreakOnNACK is set (see I2COption) and the slave does not
+// acknowledge a data byte, the error returned is a *NACKError whose Offset is
+// the index of that byte in data.
+// If NoUSBDelay is set (see I2COption) and start is true, the transfer is sent
+// as a single raw MPSSE command stream instead of using libMPSSE, since its fast
+// transfers cannot detect the address NACK. Since the command stream is not
+// interrupted, all bytes are clocked out, but the first data byte not
+// acknowledged is still reported as a *NACKError, and the number of bytes
+// returned excludes it and all bytes following it.
+func (i2c *I2C) Write(slave I2CAddr, data []uint8, start bool, stop bool) (n uint, err error) {
+
+	if nil != i2c.tracer {
+		defer func(beg time.Time) {
+			i2c.trace(beg, &TraceEvent{Op: TraceWrite, Addr: slave,
+				Start: start, Stop: stop, Tx: data, Count: n, Err: err})
+		}(time.Now())
 	}
 
-	opt := i2cXferDefault
+	if err := slave.validate(i2c.config.reserved); nil != err {
+		return 0, err
+	}
 
-	if start {
-		opt |= i2cStartBit
+	if i2c.config.breakNACK {
+		// libMPSSE does not report which byte was not acknowledged
+		n, err := i2c.writeBreak(slave, data, start, stop)
+		return n, i2c.fail(err)
 	}
 
-	if stop {
-		opt |= i2cStopBit
+	if start && i2c.config.noDelay {
+		// libMPSSE fast transfers do not report the address ACK
+		n, err := i2c.xfer(I2CMsg{Addr: slave, Data: data}, true, stop, false)
+		return n, i2c.fail(err)
 	}
 
-	if i2c.config.noDelay {
-		opt |= i2cFastTransfer | i2cFastTransferBytes
+	tail := slave.tail()
+
+	n, err = _I2C_Write(i2c, slave.head(), append(tail, data...),
+		i2c.xferOption(false, start, stop))
+	if n < uint(len(tail)) {
+		return 0, i2c.fail(err)
 	}
+	return n - uint(len(tail)), i2c.fail(err)
+}
 
-	// this flag is not supported when fast transfer (I2COption.NoUSBDelay) is
-	// enabled with start/stop condition generation
-	if !(i2c.config.noDelay && (start || stop)) {
-		if i2c.config.breakNACK {
-			opt |= i2cBreakOnNACK
-		}
+// GeneralCall writes the given byte slice data to all I²C slave devices using
+// the general call address (0x00), generating start and stop conditions.
+// The general call address is always permitted, regardless of the value of
+// I2COption.AllowReserved.
+// Returns the number of bytes successfully written and a non-nil error if there
+// was an error.
+func (i2c *I2C) GeneralCall(data []uint8) (n uint, err error) {
+
+	if nil != i2c.tracer {
+		defer func(beg time.Time) {
+			i2c.trace(beg, &TraceEvent{Op: TraceWrite, Addr: I2CGeneralCall,
+				Start: true, Stop: true, Tx: data, Count: n, Err: err})
+		}(time.Now())
 	}
 
-	return _I2C_Write(i2c, slave, data, opt)
+	n, err = _I2C_Write(i2c, I2CGeneralCall.head(), data,
+		i2c.xferOption(false, true, true))
+	return n, i2c.fail(err)
+}
+
+// SoftwareReset sends the general call software reset command (0x06), which
+// resets all I²C slave devices that support it.
+func (i2c *I2C) SoftwareReset() error {
+	_, err := i2c.GeneralCall([]uint8{i2cGeneralCallReset})
+	return err
 }
 
 // I2CReg represents a read-write register of an I²C slave device.
 type I2CReg struct {
-	i2c   *I2C      // the I²C interface to use
-	slave uint      // unshifted 7-bit I²C slave address
+	i2c   I2CBus    // the I²C bus to use
+	slave I2CAddr   // unshifted 7-bit or 10-bit I²C slave address
 	addr  uint      // register sub-address to read/write
 	space AddrSpace // sub-address space used to format register in data payload
 	order ByteOrder // byte order used to format register+data in data payload
@@ -410,6 +759,9 @@ type I2CReg struct {
 // I2CRegReader represents a method for reading I²C slave device registers.
 type I2CRegReader func(rewrite bool) (uint64, error)
 
+// I2CRegWriter represents a method for writing I²C slave device registers.
+type I2CRegWriter func(value uint64) error
+
 // validate checks that fields of an I2CReg pass basic sanity requirements.
 // Returns the byte-ordered register sub-address to send in read/write payloads.
 func (reg *I2CReg) validate() ([]uint8, error) {
@@ -418,9 +770,9 @@ func (reg *I2CReg) validate() ([]uint8, error) {
 		return nil, fmt.Errorf("invalid receiver (nil)")
 	}
 
-	if !(reg.slave >= I2CSlaveAddressMin && reg.slave <= I2CSlaveAddressMax) {
-		return nil, fmt.Errorf("invalid I²C slave address (0x%02X-0x%02X): 0x%02X",
-			I2CSlaveAddressMin, I2CSlaveAddressMax, reg.slave)
+	// reserved addresses are verified by the I²C bus on transfer
+	if err := reg.slave.validate(true); nil != err {
+		return nil, err
 	}
 
 	b := reg.space.Bytes()
@@ -443,9 +795,14 @@ func (reg *I2CReg) validate() ([]uint8, error) {
 
 // Reg constructs a new I2CReg for conveniently reading and writing data in I²C
 // slave device registers.
-func (i2c *I2C) Reg(slave uint, addr uint, space AddrSpace, order ByteOrder) *I2CReg {
+func (i2c *I2C) Reg(slave I2CAddr, addr uint, space AddrSpace, order ByteOrder) *I2CReg {
+	return newI2CReg(i2c, slave, addr, space, order)
+}
+
+// newI2CReg constructs a new I2CReg using the given I²C bus.
+func newI2CReg(bus I2CBus, slave I2CAddr, addr uint, space AddrSpace, order ByteOrder) *I2CReg {
 	return &I2CReg{
-		i2c:   i2c,
+		i2c:   bus,
 		slave: slave,
 		addr:  addr,
 		space: space,
@@ -478,9 +835,12 @@ func (reg *I2CReg) Reader(size uint) (I2CRegReader, error) {
 	return func(rewrite bool) (uint64, error) {
 
 		if rewrite {
-			if _, err := reg.i2c.Write(reg.slave, addr, true, false); nil != err {
+			// reposition and read in a single transaction with repeated start
+			dat := make([]uint8, size)
+			if err := reg.i2c.Tx(reg.slave, addr, dat); nil != err {
 				return 0, err
 			}
+			return reg.order.Uint(size, dat), nil
 		}
 
 		if dat, err := reg.i2c.Read(reg.slave, size, true, true); nil != err {
@@ -491,3 +851,105 @@ func (reg *I2CReg) Reader(size uint) (I2CRegReader, error) {
 
 	}, nil
 }
+
+// Writer returns a closure that can be used to repeatedly write to a register.
+// The size argument defines the number of bytes to write, i.e. the size of the
+// data written to the register; it is also used along with the I2CReg byte
+// order to format the value given to the closure.
+// Each call to the closure writes the register sub-address followed by the
+// formatted value in a single transaction.
+func (reg *I2CReg) Writer(size uint) (I2CRegWriter, error) {
+
+	addr, err := reg.validate()
+	if nil != err {
+		return nil, err
+	}
+
+	return func(value uint64) error {
+		_, err := reg.i2c.Write(reg.slave,
+			append(addr, reg.pack(size, []uint64{value})...), true, true)
+		return err
+	}, nil
+}
+
+// Update performs a read-modify-write of the register, replacing only the bits
+// set in the given mask with the corresponding bits of the given value, which
+// is not shifted (i.e., value is already aligned with mask). The size argument
+// defines the size of the register in bytes, as with Reader and Writer.
+// Returns the value written to the register.
+func (reg *I2CReg) Update(size uint, mask uint64, value uint64) (uint64, error) {
+
+	addr, err := reg.validate()
+	if nil != err {
+		return 0, err
+	}
+
+	dat := make([]uint8, size)
+	if err := reg.i2c.Tx(reg.slave, addr, dat); nil != err {
+		return 0, err
+	}
+
+	val := (reg.order.Uint(size, dat) &^ mask) | (value & mask)
+	_, err = reg.i2c.Write(reg.slave,
+		append(addr, reg.pack(size, []uint64{val})...), true, true)
+	return val, err
+}
+
+// ReadBurst reads count consecutive registers, each of the given size in bytes,
+// beginning with the receiver's register, in a single transaction. The slave
+// device must auto-increment its register pointer after each byte read (which
+// is typical, but may need to be enabled on some devices).
+// Returns the value of each register, formatted using the I2CReg byte order.
+func (reg *I2CReg) ReadBurst(size uint, count uint) ([]uint64, error) {
+
+	addr, err := reg.validate()
+	if nil != err {
+		return nil, err
+	}
+
+	dat := make([]uint8, size*count)
+	if err := reg.i2c.Tx(reg.slave, addr, dat); nil != err {
+		return nil, err
+	}
+
+	return reg.unpack(size, dat), nil
+}
+
+// WriteBurst writes the given values to consecutive registers, each of the given
+// size in bytes, beginning with the receiver's register, in a single
+// transaction. The slave device must auto-increment its register pointer after
+// each byte written.
+func (reg *I2CReg) WriteBurst(size uint, values []uint64) error {
+
+	addr, err := reg.validate()
+	if nil != err {
+		return err
+	}
+
+	_, err = reg.i2c.Write(reg.slave,
+		append(addr, reg.pack(size, values)...), true, true)
+	return err
+}
+
+// pack formats each of the given values as size bytes using the I2CReg byte
+// order, returning the concatenated bytes.
+func (reg *I2CReg) pack(size uint, values []uint64) []uint8 {
+	b := make([]uint8, 0, size*uint(len(values)))
+	for _, v := range values {
+		b = append(b, reg.order.Bytes(size, v)...)
+	}
+	return b
+}
+
+// unpack converts each consecutive group of size bytes in the given data to an
+// unsigned integer using the I2CReg byte order.
+func (reg *I2CReg) unpack(size uint, data []uint8) []uint64 {
+	if 0 == size {
+		return nil
+	}
+	v := make([]uint64, 0, uint(len(data))/size)
+	for i := uint(0); i+size <= uint(len(data)); i += size {
+		v = append(v, reg.order.Uint(size, data[i:i+size]))
+	}
+	return v
+}
@@ -0,0 +1,180 @@
+package ft232h
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestI2CAddr(t *testing.T) {
+
+	for _, test := range []struct {
+		addr     I2CAddr
+		reserved bool
+		is10     bool
+		head     uint
+		tail     []uint8
+		valid    bool
+	}{
+		{addr: 0x40, is10: false, head: 0x40, tail: nil, valid: true},
+		{addr: I2CSlaveAddressMin, head: I2CSlaveAddressMin, valid: true},
+		{addr: I2CSlaveAddressMax, head: I2CSlaveAddressMax, valid: true},
+		{addr: 0x07, head: 0x07, valid: false},
+		{addr: 0x78, head: 0x78, valid: false},
+		{addr: 0x00, reserved: true, head: 0x00, valid: true},
+		{addr: 0x07, reserved: true, head: 0x07, valid: true},
+		{addr: 0x78, reserved: true, head: 0x78, valid: true},
+		{addr: I2CReservedLowMax, reserved: true, head: 0x07, valid: true},
+		{addr: I2CReservedHighMin, reserved: true, head: 0x78, valid: true},
+		{addr: I2CAddressMax, reserved: true, head: 0x7F, valid: true},
+		{addr: 0x80, reserved: true, head: 0x80, valid: false},
+		{addr: I2CAddr10(0x000), is10: true, head: 0x78, tail: []uint8{0x00}, valid: true},
+		{addr: I2CAddr10(0x123), is10: true, head: 0x79, tail: []uint8{0x23}, valid: true},
+		{addr: I2CAddr10(0x2A5), is10: true, head: 0x7A, tail: []uint8{0xA5}, valid: true},
+		{addr: I2CAddr10(0x3FF), is10: true, head: 0x7B, tail: []uint8{0xFF}, valid: true},
+		{addr: I2CAddr10(0x400), is10: true, head: 0x78, tail: []uint8{0x00}, valid: false},
+	} {
+		name := fmt.Sprintf("%s:%t", test.addr, test.reserved)
+		t.Run(name, func(s *testing.T) {
+			if test.is10 != test.addr.Is10Bit() {
+				s.Fatalf("unexpected 10-bit flag: %t", test.addr.Is10Bit())
+			}
+			// 7-bit addresses not in I2CSlaveAddressMin-I2CSlaveAddressMax are reserved
+			rsvd := !test.is10 && test.addr <= I2CAddressMax &&
+				(test.addr < I2CSlaveAddressMin || test.addr > I2CSlaveAddressMax)
+			if rsvd != test.addr.Reserved() {
+				s.Fatalf("unexpected reserved flag: %t", test.addr.Reserved())
+			}
+			if err := test.addr.validate(test.reserved); test.valid != (nil == err) {
+				s.Fatalf("unexpected validation: %v", err)
+			}
+			if !test.valid {
+				return
+			}
+			if head := test.addr.head(); test.head != head {
+				s.Fatalf("unexpected head: 0x%02X != 0x%02X", head, test.head)
+			}
+			if tail := test.addr.tail(); fmt.Sprint(test.tail) != fmt.Sprint(tail) {
+				s.Fatalf("unexpected tail: %v != %v", tail, test.tail)
+			}
+		})
+	}
+}
+
+func TestI2CRegPack(t *testing.T) {
+
+	for _, test := range []struct {
+		order  ByteOrder
+		size   uint
+		values []uint64
+		data   []uint8
+	}{
+		{order: MSB, size: 1, values: []uint64{0x12, 0x34}, data: []uint8{0x12, 0x34}},
+		{order: MSB, size: 2, values: []uint64{0x1234, 0xABCD}, data: []uint8{0x12, 0x34, 0xAB, 0xCD}},
+		{order: LSB, size: 2, values: []uint64{0x1234, 0xABCD}, data: []uint8{0x34, 0x12, 0xCD, 0xAB}},
+		{order: LSB, size: 3, values: []uint64{0x123456}, data: []uint8{0x56, 0x34, 0x12}},
+		{order: MSB, size: 4, values: []uint64{0x89ABCDEF}, data: []uint8{0x89, 0xAB, 0xCD, 0xEF}},
+	} {
+		name := fmt.Sprintf("%s:%d:%d", test.order, test.size, len(test.values))
+		t.Run(name, func(s *testing.T) {
+			reg := &I2CReg{order: test.order}
+			data := reg.pack(test.size, test.values)
+			if fmt.Sprint(test.data) != fmt.Sprint(data) {
+				s.Fatalf("unexpected packed data: %v != %v", data, test.data)
+			}
+			values := reg.unpack(test.size, data)
+			if fmt.Sprint(test.values) != fmt.Sprint(values) {
+				s.Fatalf("unexpected unpacked values: %v != %v", values, test.values)
+			}
+		})
+	}
+}
+
+func TestI2CClock(t *testing.T) {
+
+	for _, test := range []struct {
+		rate  I2CClockRate
+		phase bool
+		round ClockRounding
+		exp   I2CClockRate
+		str   string
+		ok    bool
+	}{
+		{rate: 50000, phase: true, round: ClockAtMost, exp: 50000, str: "50 KHz", ok: true},
+		{rate: 250000, phase: true, round: ClockAtMost, exp: 250000, str: "250 KHz", ok: true},
+		{rate: 250000, phase: false, round: ClockAtMost, exp: 250000, str: "250 KHz", ok: true},
+		{rate: 333333, phase: true, round: ClockAtMost, exp: 327868, str: "327.868 KHz", ok: true},
+		{rate: 1200000, phase: false, round: ClockNearest, exp: 1200000, str: "1.2 MHz", ok: true},
+		{rate: I2CClockStandardMode, phase: true, round: ClockAtMost,
+			exp: I2CClockStandardMode, str: "Standard mode (100 KHz)", ok: true},
+		{rate: 61, phase: true, round: ClockAtLeast, exp: 61, str: "61 Hz", ok: true},
+		{rate: 10, phase: true, round: ClockAtMost, ok: false},
+		{rate: I2CClockMaximum + 1, phase: false, round: ClockAtMost, ok: false},
+	} {
+		name := fmt.Sprintf("%d:%t:%s", test.rate, test.phase, test.round)
+		t.Run(name, func(s *testing.T) {
+			clock, err := i2cClock(test.rate, test.phase, test.round)
+			if test.ok != (nil == err) {
+				s.Fatalf("unexpected result: %v", err)
+			}
+			if !test.ok {
+				return
+			}
+			rate := I2CClockRate(clock.rate())
+			if test.exp != rate {
+				s.Fatalf("unexpected rate: %d != %d", rate, test.exp)
+			}
+			if test.str != rate.String() {
+				s.Fatalf("unexpected string: %q != %q", rate.String(), test.str)
+			}
+		})
+	}
+
+	if s := I2CClockRate(4000000).String(); "Unsupported rate (4000000 Hz)" != s {
+		t.Fatalf("unexpected string: %q", s)
+	}
+}
+
+func TestI2CConfig(t *testing.T) {
+
+	i2c := &I2C{config: i2cConfigDefault()}
+	init := *i2c.config
+
+	for _, test := range []struct {
+		name string
+		cfg  *I2CConfig
+	}{
+		{name: "stretch-drive", cfg: &I2CConfig{I2COption: &I2COption{NoUSBDelay: true},
+			Clock: I2CClockFastMode, Latency: 2, ClockStretching: true}},
+		{name: "clock", cfg: &I2CConfig{I2COption: &I2COption{NoUSBDelay: true},
+			Clock: I2CClockMaximum + 1, Latency: 2, LowDriveOnly: true}},
+	} {
+		t.Run(test.name, func(s *testing.T) {
+			if err := i2c.configure(test.cfg); nil == err {
+				s.Fatalf("expected error for invalid configuration")
+			}
+			if init != *i2c.config {
+				s.Fatalf("configuration changed: %s != %s", *i2c.config, init)
+			}
+		})
+	}
+
+	cfg := &I2CConfig{
+		I2COption: &I2COption{BreakOnNACK: true, AllowReserved: true},
+		Clock:     I2CClockFastMode, Latency: 4, Clock3Phase: true,
+		LowDriveOnly: true, Rounding: ClockAtMost, ClockStretching: true,
+	}
+	if err := i2c.configure(cfg); nil != err {
+		t.Fatalf("configure(): %v", err)
+	}
+	got := i2c.GetConfig()
+	if *cfg.I2COption != *got.I2COption {
+		t.Fatalf("unexpected options: %+v != %+v", *got.I2COption, *cfg.I2COption)
+	}
+	if got.I2COption = cfg.I2COption; *cfg != *got {
+		t.Fatalf("unexpected configuration: %+v != %+v", *got, *cfg)
+	}
+	if !i2c.config.stretch || !i2c.config.breakNACK || i2c.config.noDelay ||
+		i2cLowDriveOnlyEnable|i2cClock3PhaseEnable != i2c.config.options {
+		t.Fatalf("unexpected options: %s", *i2c.config)
+	}
+}
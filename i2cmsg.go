@@ -0,0 +1,423 @@
+package ft232h
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrAddrNACK is returned when an I²C slave does not acknowledge its address,
+// which usually means there is no slave device with that address on the bus.
+var ErrAddrNACK = errors.New("slave did not acknowledge address")
+
+// NACKError is returned when an I²C slave does not acknowledge a data byte
+// written to it.
+type NACKError struct {
+	Addr   I2CAddr // slave address
+	Msg    int     // index of the message containing the byte (see Transfer)
+	Offset uint    // index of the byte in its message
+}
+
+// Error returns a descriptive string of a NACKError.
+func (e *NACKError) Error() string {
+	return fmt.Sprintf("slave %s did not acknowledge byte %d of message %d",
+		e.Addr, e.Offset, e.Msg)
+}
+
+// i2cError returns the error err reported by libMPSSE as an error defined by
+// this package, if applicable.
+func i2cError(err error) error {
+	if SDeviceNotFound == err {
+		return ErrAddrNACK
+	}
+	return err
+}
+
+// I2CMsg is a single message of an I²C transaction performed with Transfer,
+// equivalent to struct i2c_msg used with the Linux I2C_RDWR ioctl.
+// Each message begins with a start condition (a repeated start condition for
+// all messages but the first), followed by the slave address and direction.
+type I2CMsg struct {
+	Addr I2CAddr // unshifted 7-bit or 10-bit I²C slave address
+	Read bool    // read len(Data) bytes into Data if true, otherwise write Data
+	Data []uint8 // data to write, or buffer receiving data read
+}
+
+// Constants defining the value and direction of the I²C pins on port "D" used in
+// raw MPSSE I²C command streams, identical to those used by libMPSSE.
+const (
+	i2cDirSCLInSDAIn   uint8 = 0x10 // SCL, SDA tristated
+	i2cDirSCLOutSDAIn  uint8 = 0x11 // SCL driven, SDA tristated
+	i2cDirSCLOutSDAOut uint8 = 0x13 // SCL, SDA driven
+	i2cValSCLLoSDALo   uint8 = 0x00 // SCL LOW, SDA LOW
+	i2cValSCLHiSDALo   uint8 = 0x01 // SCL HIGH, SDA LOW
+	i2cValSCLLoSDAHi   uint8 = 0x02 // SCL LOW, SDA HIGH
+	i2cValSCLHiSDAHi   uint8 = 0x03 // SCL HIGH, SDA HIGH
+)
+
+// Constants defining the number of times each pin state is repeated to hold the
+// state long enough to satisfy I²C bus timing, identical to those used by
+// libMPSSE.
+const (
+	i2cStartHold1 = 10 // SCL HIGH, SDA HIGH
+	i2cStartHold2 = 20 // SCL HIGH, SDA LOW
+	i2cStopHold1  = 10 // SCL LOW, SDA LOW
+	i2cStopHold2  = 10 // SCL HIGH, SDA LOW
+	i2cStopHold3  = 10 // SCL HIGH, SDA HIGH
+)
+
+// Constants defining the bit sent by the I²C master after each byte read.
+const (
+	i2cSendACK  uint8 = 0x00
+	i2cSendNACK uint8 = 0x80
+)
+
+// i2cRespKind identifies the meaning of a byte returned by the MPSSE engine in
+// response to a raw I²C command stream.
+type i2cRespKind uint8
+
+// Constants defining the meaning of each response byte.
+const (
+	i2cRespAddrACK i2cRespKind = iota // ACK bit (bit 0) of an address byte
+	i2cRespDataACK                    // ACK bit (bit 0) of a data byte written
+	i2cRespData                       // data byte read
+)
+
+// i2cResp describes a single byte returned by the MPSSE engine in response to a
+// raw I²C command stream, and the message (and offset into its data) to which
+// it belongs.
+type i2cResp struct {
+	kind i2cRespKind
+	msg  int
+	off  int
+}
+
+// i2cCmd builds a raw MPSSE command stream performing an I²C transaction, and
+// records the meaning of each byte returned by the MPSSE engine in response.
+type i2cCmd struct {
+	buf  []uint8
+	resp []i2cResp
+}
+
+// pins appends the command setting the I²C pins to the given value val and
+// direction dir, repeated n times.
+func (c *i2cCmd) pins(val uint8, dir uint8, n int) {
+	for i := 0; i < n; i++ {
+		c.buf = append(c.buf, mpsseSetDataBitsLowByte, val, dir)
+	}
+}
+
+// start appends the commands generating a start condition, or repeated start
+// condition if repeated is true.
+func (c *i2cCmd) start(repeated bool) {
+	if repeated {
+		// release SDA before raising SCL, or else the rising SDA while SCL is
+		// HIGH is a stop condition.
+		c.pins(i2cValSCLLoSDAHi, i2cDirSCLOutSDAIn, 1)
+	}
+	c.pins(i2cValSCLHiSDAHi, i2cDirSCLOutSDAIn, i2cStartHold1)
+	c.pins(i2cValSCLHiSDALo, i2cDirSCLOutSDAOut, i2cStartHold2)
+	c.pins(i2cValSCLLoSDALo, i2cDirSCLOutSDAOut, 1)
+}
+
+// stop appends the commands generating a stop condition, after which both SCL
+// and SDA are tristated.
+func (c *i2cCmd) stop() {
+	c.pins(i2cValSCLLoSDALo, i2cDirSCLOutSDAOut, i2cStopHold1)
+	c.pins(i2cValSCLHiSDALo, i2cDirSCLOutSDAOut, i2cStopHold2)
+	c.pins(i2cValSCLHiSDAHi, i2cDirSCLOutSDAIn, i2cStopHold3)
+	c.pins(i2cValSCLHiSDAHi, i2cDirSCLInSDAIn, 1)
+}
+
+// write appends the commands writing the given byte b and reading the ACK bit
+// from the slave, which is described by the given kind, msg, and off.
+func (c *i2cCmd) write(b uint8, kind i2cRespKind, msg int, off int) {
+	c.pins(i2cValSCLLoSDALo, i2cDirSCLOutSDAOut, 1)
+	c.buf = append(c.buf, mpsseDataOutBitsNegEdge, 0x07, b)
+	c.pins(i2cValSCLLoSDALo, i2cDirSCLOutSDAIn, 1)
+	c.buf = append(c.buf, mpsseDataInBitsPosEdge, 0x00)
+	c.resp = append(c.resp, i2cResp{kind: kind, msg: msg, off: off})
+}
+
+// read appends the commands reading a byte from the slave, followed by sending
+// an ACK (if ack is true) or NACK (if ack is false). The byte read belongs to
+// the given msg at offset off.
+func (c *i2cCmd) read(ack bool, msg int, off int) {
+	c.pins(i2cValSCLLoSDALo, i2cDirSCLOutSDAIn, 1)
+	c.buf = append(c.buf, mpsseDataInBitsPosEdge, 0x07)
+	if ack {
+		c.pins(i2cValSCLLoSDALo, i2cDirSCLOutSDAOut, 1)
+		c.buf = append(c.buf, mpsseDataOutBitsNegEdge, 0x00, i2cSendACK)
+	} else {
+		c.pins(i2cValSCLLoSDALo, i2cDirSCLOutSDAIn, 1)
+		c.buf = append(c.buf, mpsseDataOutBitsNegEdge, 0x00, i2cSendNACK)
+	}
+	c.pins(i2cValSCLLoSDALo, i2cDirSCLOutSDAIn, 1)
+	c.resp = append(c.resp, i2cResp{kind: i2cRespData, msg: msg, off: off})
+}
+
+// address appends the commands addressing the given slave for reading (if read
+// is true) or writing, as message msg. If repeated is true, a repeated start
+// condition is generated instead of a start condition.
+// A 10-bit slave is always addressed for writing with both address bytes. If
+// read is true, this is followed by a repeated start condition and the first
+// address byte with the read bit set.
+func (c *i2cCmd) address(slave I2CAddr, read bool, repeated bool, msg int) {
+	head := uint8(slave.head() << 1)
+	c.start(repeated)
+	if tail := slave.tail(); nil != tail {
+		c.write(head, i2cRespAddrACK, msg, 0)
+		c.write(tail[0], i2cRespAddrACK, msg, 1)
+		if !read {
+			return
+		}
+		c.start(true)
+	}
+	if read {
+		head |= 0x01
+	}
+	c.write(head, i2cRespAddrACK, msg, 0)
+}
+
+// newI2CCmd builds the raw MPSSE command stream performing the I²C transaction
+// defined by the given messages, terminated with a stop condition.
+func newI2CCmd(msgs []I2CMsg) *i2cCmd {
+	c := &i2cCmd{}
+	for i, m := range msgs {
+		c.address(m.Addr, m.Read, i > 0, i)
+		for j := range m.Data {
+			if m.Read {
+				// NACK the last byte read, as required before a (repeated) start or
+				// stop condition.
+				c.read(j < len(m.Data)-1, i, j)
+			} else {
+				c.write(m.Data[j], i2cRespDataACK, i, j)
+			}
+		}
+	}
+	c.stop()
+	c.flush()
+	return c
+}
+
+// flush appends the command instructing the MPSSE engine to send all pending
+// response bytes to the host immediately.
+func (c *i2cCmd) flush() {
+	c.buf = append(c.buf, mpsseSendImmediate)
+}
+
+// exec sends the raw MPSSE command stream of the given cmd, returning the
+// response bytes read from the MPSSE engine.
+func (i2c *I2C) exec(cmd *i2cCmd) ([]uint8, error) {
+
+	if err := _FT_Purge(i2c.device.info); nil != err {
+		return nil, err
+	}
+	if _, err := _FT_Write(i2c.device.info, cmd.buf); nil != err {
+		return nil, err
+	}
+	return _FT_Read(i2c.device.info, uint(len(cmd.resp)))
+}
+
+// parse copies the data bytes read from the given response resp into the given
+// messages, and checks the ACK bit of each byte written.
+// Returns a non-nil error if the response is incomplete, or if any byte written
+// was not acknowledged: ErrAddrNACK if an address byte, or *NACKError if a data
+// byte (whichever occurred first).
+func (c *i2cCmd) parse(msgs []I2CMsg, resp []uint8) error {
+
+	if len(resp) < len(c.resp) {
+		return fmt.Errorf("incomplete response: %d of %d bytes",
+			len(resp), len(c.resp))
+	}
+
+	var nack error
+	for i, r := range c.resp {
+		switch r.kind {
+		case i2cRespData:
+			msgs[r.msg].Data[r.off] = resp[i]
+		case i2cRespAddrACK:
+			if 0 != resp[i]&0x01 && nil == nack {
+				nack = ErrAddrNACK
+			}
+		case i2cRespDataACK:
+			if 0 != resp[i]&0x01 && nil == nack {
+				nack = &NACKError{Addr: msgs[r.msg].Addr, Msg: r.msg, Offset: uint(r.off)}
+			}
+		}
+	}
+	return nack
+}
+
+// Transfer performs an I²C transaction consisting of the given messages, each
+// separated by a repeated start condition, and terminated by a stop condition,
+// equivalent to the Linux I2C_RDWR ioctl. The entire transaction is sent to the
+// MPSSE engine as a single command stream, requiring only one USB round trip.
+// The last byte read by each read message is NACKed.
+// Since the command stream is not interrupted, the transaction always runs to
+// completion; any byte not acknowledged by a slave is reported afterwards as a
+// non-nil error (ErrAddrNACK or *NACKError), in which case the data read may be
+// invalid.
+// The I²C interface must be initialized before transfer.
+func (i2c *I2C) Transfer(msgs []I2CMsg) (err error) {
+
+	if 0 == len(msgs) {
+		return nil
+	}
+
+	for _, m := range msgs {
+		if err := m.Addr.validate(i2c.config.reserved); nil != err {
+			return err
+		}
+	}
+
+	if nil != i2c.tracer {
+		defer func(beg time.Time) { i2c.traceMsgs(beg, msgs, err) }(time.Now())
+	}
+
+	cmd := newI2CCmd(msgs)
+
+	resp, err := i2c.exec(cmd)
+	if nil != err {
+		return i2c.fail(err)
+	}
+
+	return i2c.fail(cmd.parse(msgs, resp))
+}
+
+// Tx performs an I²C transaction with the given slave, writing all bytes of w,
+// followed by a repeated start condition and reading len(r) bytes into r (see
+// Transfer). Either w or r may be empty (or nil) to perform only a read or only
+// a write. If both are empty, the slave is only addressed for writing (SMBus
+// "quick write").
+func (i2c *I2C) Tx(slave I2CAddr, w []uint8, r []uint8) error {
+
+	var msgs []I2CMsg
+	if len(w) > 0 || 0 == len(r) {
+		msgs = append(msgs, I2CMsg{Addr: slave, Read: false, Data: w})
+	}
+	if len(r) > 0 {
+		msgs = append(msgs, I2CMsg{Addr: slave, Read: true, Data: r})
+	}
+	return i2c.Transfer(msgs)
+}
+
+// Present returns true if an I²C slave device acknowledges the given address,
+// using an SMBus "quick write" (see Tx).
+func (i2c *I2C) Present(slave I2CAddr) (bool, error) {
+	switch err := i2c.Tx(slave, nil, nil); err {
+	case nil:
+		return true, nil
+	case ErrAddrNACK:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// newI2CXferCmd builds the raw MPSSE command stream performing a single Read or
+// Write transfer of the given message m.
+// If start is true, a start condition and the slave address are sent before the
+// data. If stop is true, a stop condition is generated after the data.
+// The last byte read is NACKed if either nack or stop is true.
+func newI2CXferCmd(m I2CMsg, start bool, stop bool, nack bool) *i2cCmd {
+	c := &i2cCmd{}
+	if start {
+		c.address(m.Addr, m.Read, false, 0)
+	}
+	for j := range m.Data {
+		if m.Read {
+			c.read(j < len(m.Data)-1 || !(nack || stop), 0, j)
+		} else {
+			c.write(m.Data[j], i2cRespDataACK, 0, j)
+		}
+	}
+	if stop {
+		c.stop()
+	}
+	c.flush()
+	return c
+}
+
+// result parses the given response resp to the single message m (see parse),
+// returning the number of data bytes transferred before the first byte not
+// acknowledged, and ErrAddrNACK or *NACKError if any byte was not acknowledged.
+func (c *i2cCmd) result(m I2CMsg, resp []uint8) (uint, error) {
+	switch err := c.parse([]I2CMsg{m}, resp).(type) {
+	case nil:
+		return uint(len(m.Data)), nil
+	case *NACKError:
+		return err.Offset, err
+	default:
+		return 0, err
+	}
+}
+
+// xfer performs a single Read or Write transfer of the given message m as one
+// raw MPSSE command stream (see newI2CXferCmd), requiring only one USB round
+// trip, and checks the ACK bit of every byte written.
+// Returns the number of data bytes transferred and a non-nil error if there was
+// an error (see result).
+func (i2c *I2C) xfer(m I2CMsg, start bool, stop bool, nack bool) (uint, error) {
+
+	cmd := newI2CXferCmd(m, start, stop, nack)
+
+	resp, err := i2c.exec(cmd)
+	if nil != err {
+		return 0, err
+	}
+
+	return cmd.result(m, resp)
+}
+
+// writeBreak writes the given byte slice data to the given slave, sending the
+// address and each data byte in a separate command stream, so that the transfer
+// stops at the first byte the slave does not acknowledge (I2COption.BreakOnNACK)
+// and nothing further is sent to it.
+// If start is true, a start condition and the slave address are sent before
+// the data. If stop is true, a stop condition is generated after the data. A
+// stop condition is always generated after a byte not acknowledged, as with
+// libMPSSE.
+// Returns the number of bytes written and acknowledged, and ErrAddrNACK or
+// *NACKError if the address or a data byte was not acknowledged.
+func (i2c *I2C) writeBreak(slave I2CAddr, data []uint8, start bool, stop bool) (uint, error) {
+
+	// send sends the given command stream, generating a stop condition after it
+	// if last is true, and returns the error of the bytes it writes (see result).
+	send := func(cmd *i2cCmd, last bool) error {
+		if last {
+			cmd.stop()
+		}
+		cmd.flush()
+		resp, err := i2c.exec(cmd)
+		if nil != err {
+			return err
+		}
+		if _, err = cmd.result(I2CMsg{Addr: slave}, resp); nil != err && !last {
+			halt := &i2cCmd{}
+			halt.stop()
+			if _, e := i2c.exec(halt); nil != e {
+				return e
+			}
+		}
+		return err
+	}
+
+	if start {
+		cmd := &i2cCmd{}
+		cmd.address(slave, false, false, 0)
+		if err := send(cmd, stop && 0 == len(data)); nil != err {
+			return 0, err
+		}
+	}
+
+	for n := range data {
+		cmd := &i2cCmd{}
+		cmd.write(data[n], i2cRespDataACK, 0, n)
+		if err := send(cmd, stop && n+1 == len(data)); nil != err {
+			return uint(n), err
+		}
+	}
+
+	return uint(len(data)), nil
+}
@@ -0,0 +1,273 @@
+package ft232h
+
+import (
+	"fmt"
+	"testing"
+)
+
+// decodeI2CCmd decodes the raw MPSSE I²C command stream buf, returning the bytes
+// written (8-bit data out), and the number of start conditions, bytes read
+// (8-bit data in), ACKs sent, and NACKs sent.
+func decodeI2CCmd(buf []uint8) (out []uint8, start int, in int, ack int, nack int, err error) {
+	var prev uint8 = i2cValSCLHiSDAHi
+	for i := 0; i < len(buf); {
+		switch buf[i] {
+		case mpsseSetDataBitsLowByte:
+			val := buf[i+1]
+			// SDA falling while SCL HIGH
+			if i2cValSCLHiSDAHi == prev && i2cValSCLHiSDALo == val {
+				start++
+			}
+			prev = val
+			i += 3
+		case mpsseDataOutBitsNegEdge:
+			switch buf[i+1] {
+			case 0x07:
+				out = append(out, buf[i+2])
+			case 0x00:
+				if i2cSendACK == buf[i+2] {
+					ack++
+				} else {
+					nack++
+				}
+			}
+			i += 3
+		case mpsseDataInBitsPosEdge:
+			if 0x07 == buf[i+1] {
+				in++
+			}
+			i += 2
+		case mpsseSendImmediate:
+			if i != len(buf)-1 {
+				return nil, 0, 0, 0, 0, fmt.Errorf("send immediate not last")
+			}
+			i++
+		default:
+			return nil, 0, 0, 0, 0, fmt.Errorf("unexpected opcode: 0x%02X", buf[i])
+		}
+	}
+	return out, start, in, ack, nack, nil
+}
+
+func TestI2CCmd(t *testing.T) {
+
+	for _, test := range []struct {
+		name  string
+		msgs  []I2CMsg
+		out   []uint8
+		start int
+		in    int
+		ack   int
+		nack  int
+		resp  []i2cRespKind
+	}{
+		{
+			name: "quick-write",
+			msgs: []I2CMsg{{Addr: 0x40}},
+			out:  []uint8{0x80}, start: 1,
+			resp: []i2cRespKind{i2cRespAddrACK},
+		},
+		{
+			name: "write",
+			msgs: []I2CMsg{{Addr: 0x40, Data: []uint8{0x01, 0xAB, 0xCD}}},
+			out:  []uint8{0x80, 0x01, 0xAB, 0xCD}, start: 1,
+			resp: []i2cRespKind{i2cRespAddrACK,
+				i2cRespDataACK, i2cRespDataACK, i2cRespDataACK},
+		},
+		{
+			name: "write-read",
+			msgs: []I2CMsg{
+				{Addr: 0x40, Data: []uint8{0x02}},
+				{Addr: 0x40, Read: true, Data: make([]uint8, 3)},
+			},
+			out: []uint8{0x80, 0x02, 0x81}, start: 2, in: 3, ack: 2, nack: 1,
+			resp: []i2cRespKind{i2cRespAddrACK, i2cRespDataACK,
+				i2cRespAddrACK, i2cRespData, i2cRespData, i2cRespData},
+		},
+		{
+			name: "10-bit-read",
+			msgs: []I2CMsg{{Addr: I2CAddr10(0x123), Read: true, Data: make([]uint8, 1)}},
+			out:  []uint8{0xF2, 0x23, 0xF3}, start: 2, in: 1, ack: 0, nack: 1,
+			resp: []i2cRespKind{i2cRespAddrACK, i2cRespAddrACK, i2cRespAddrACK,
+				i2cRespData},
+		},
+		{
+			name: "10-bit-write",
+			msgs: []I2CMsg{{Addr: I2CAddr10(0x3FF), Data: []uint8{0x55}}},
+			out:  []uint8{0xF6, 0xFF, 0x55}, start: 1,
+			resp: []i2cRespKind{i2cRespAddrACK, i2cRespAddrACK, i2cRespDataACK},
+		},
+	} {
+		t.Run(test.name, func(s *testing.T) {
+			cmd := newI2CCmd(test.msgs)
+			out, start, in, ack, nack, err := decodeI2CCmd(cmd.buf)
+			if nil != err {
+				s.Fatalf("invalid command stream: %v", err)
+			}
+			if fmt.Sprint(test.out) != fmt.Sprint(out) {
+				s.Fatalf("unexpected bytes written: %v != %v", out, test.out)
+			}
+			if test.start != start || test.in != in ||
+				test.ack != ack || test.nack != nack {
+				s.Fatalf("unexpected start/read/ack/nack: %d/%d/%d/%d != %d/%d/%d/%d",
+					start, in, ack, nack, test.start, test.in, test.ack, test.nack)
+			}
+			if len(test.resp) != len(cmd.resp) {
+				s.Fatalf("unexpected response length: %d != %d",
+					len(cmd.resp), len(test.resp))
+			}
+			for i, r := range cmd.resp {
+				if test.resp[i] != r.kind {
+					s.Fatalf("unexpected response kind [%d]: %d != %d",
+						i, r.kind, test.resp[i])
+				}
+			}
+		})
+	}
+}
+
+func TestI2CCmdParse(t *testing.T) {
+
+	for _, test := range []struct {
+		name string
+		resp []uint8
+		data []uint8
+		ok   bool
+		err  error
+	}{
+		{name: "ack", resp: []uint8{0x00, 0x00, 0x00, 0x12, 0x34}, data: []uint8{0x12, 0x34}, ok: true},
+		{name: "addr-nack", resp: []uint8{0x01, 0x00, 0x00, 0xFF, 0xFF}, ok: false,
+			err: ErrAddrNACK},
+		{name: "data-nack", resp: []uint8{0x00, 0x01, 0x00, 0xFF, 0xFF}, ok: false,
+			err: &NACKError{Addr: 0x40, Msg: 0, Offset: 0}},
+		{name: "read-nack", resp: []uint8{0x00, 0x00, 0x01, 0xFF, 0xFF}, ok: false,
+			err: ErrAddrNACK},
+		{name: "first-nack", resp: []uint8{0x00, 0x01, 0x01, 0xFF, 0xFF}, ok: false,
+			err: &NACKError{Addr: 0x40, Msg: 0, Offset: 0}},
+		{name: "short", resp: []uint8{0x00, 0x00, 0x00, 0x12}, ok: false},
+	} {
+		t.Run(test.name, func(s *testing.T) {
+			msgs := []I2CMsg{
+				{Addr: 0x40, Data: []uint8{0x02}},
+				{Addr: 0x40, Read: true, Data: make([]uint8, 2)},
+			}
+			err := newI2CCmd(msgs).parse(msgs, test.resp)
+			if test.ok != (nil == err) {
+				s.Fatalf("unexpected result: %v", err)
+			}
+			if nil != test.err && fmt.Sprintf("%#v", test.err) != fmt.Sprintf("%#v", err) {
+				s.Fatalf("unexpected error: %#v != %#v", err, test.err)
+			}
+			if test.ok && fmt.Sprint(test.data) != fmt.Sprint(msgs[1].Data) {
+				s.Fatalf("unexpected data: %v != %v", msgs[1].Data, test.data)
+			}
+		})
+	}
+}
+
+func TestI2CXferCmd(t *testing.T) {
+
+	for _, test := range []struct {
+		name  string
+		msg   I2CMsg
+		start bool
+		stop  bool
+		nack  bool
+		out   []uint8
+		in    int
+		ack   int
+		resp  []uint8
+		n     uint
+		err   error
+	}{
+		{
+			name: "write", msg: I2CMsg{Addr: 0x40, Data: []uint8{0x01, 0x02}},
+			start: true, stop: true, out: []uint8{0x80, 0x01, 0x02},
+			resp: []uint8{0x00, 0x00, 0x00}, n: 2,
+		},
+		{
+			name: "write-addr-nack", msg: I2CMsg{Addr: 0x40, Data: []uint8{0x01, 0x02}},
+			start: true, stop: true, out: []uint8{0x80, 0x01, 0x02},
+			resp: []uint8{0x01, 0x01, 0x01}, n: 0, err: ErrAddrNACK,
+		},
+		{
+			name: "write-data-nack", msg: I2CMsg{Addr: 0x40, Data: []uint8{0x01, 0x02}},
+			start: true, out: []uint8{0x80, 0x01, 0x02},
+			resp: []uint8{0x00, 0x00, 0x01}, n: 1,
+			err: &NACKError{Addr: 0x40, Msg: 0, Offset: 1},
+		},
+		{
+			name: "write-continued", msg: I2CMsg{Addr: 0x40, Data: []uint8{0x03}},
+			out: []uint8{0x03}, resp: []uint8{0x00}, n: 1,
+		},
+		{
+			name: "read-addr-nack", msg: I2CMsg{Addr: 0x40, Read: true, Data: make([]uint8, 2)},
+			start: true, stop: true, out: []uint8{0x81}, in: 2, ack: 1,
+			resp: []uint8{0x01, 0xFF, 0xFF}, n: 0, err: ErrAddrNACK,
+		},
+		{
+			name: "read-no-stop", msg: I2CMsg{Addr: 0x40, Read: true, Data: make([]uint8, 2)},
+			start: true, out: []uint8{0x81}, in: 2, ack: 2,
+			resp: []uint8{0x00, 0x12, 0x34}, n: 2,
+		},
+	} {
+		t.Run(test.name, func(s *testing.T) {
+			cmd := newI2CXferCmd(test.msg, test.start, test.stop, test.nack)
+			out, _, in, ack, nack, err := decodeI2CCmd(cmd.buf)
+			if nil != err {
+				s.Fatalf("invalid command stream: %v", err)
+			}
+			if fmt.Sprint(test.out) != fmt.Sprint(out) {
+				s.Fatalf("unexpected bytes written: %v != %v", out, test.out)
+			}
+			if test.in != in || test.ack != ack || test.in-test.ack != nack {
+				s.Fatalf("unexpected read/ack/nack: %d/%d/%d != %d/%d/%d",
+					in, ack, nack, test.in, test.ack, test.in-test.ack)
+			}
+			n, err := cmd.result(test.msg, test.resp)
+			if test.n != n {
+				s.Fatalf("unexpected count: %d != %d", n, test.n)
+			}
+			if fmt.Sprintf("%#v", test.err) != fmt.Sprintf("%#v", err) {
+				s.Fatalf("unexpected error: %#v != %#v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestNACKError(t *testing.T) {
+
+	err := error(&NACKError{Addr: 0x40, Msg: 1, Offset: 3})
+	if exp := "slave 0x40 did not acknowledge byte 3 of message 1"; exp != err.Error() {
+		t.Fatalf("unexpected error string: %q != %q", err.Error(), exp)
+	}
+	if ErrAddrNACK != i2cError(SDeviceNotFound) {
+		t.Fatalf("unexpected address NACK error: %v", i2cError(SDeviceNotFound))
+	}
+	if SInvalidHandle != i2cError(SInvalidHandle) {
+		t.Fatalf("unexpected error: %v", i2cError(SInvalidHandle))
+	}
+}
+
+func TestI2CFail(t *testing.T) {
+
+	// NACK errors must never trigger bus recovery, which would fail here since
+	// there is no device.
+	i2c := &I2C{config: i2cConfigDefault()}
+	i2c.config.recover = true
+
+	nack := &NACKError{Addr: 0x40, Offset: 1}
+	for _, test := range []struct {
+		err error
+		exp error
+	}{
+		{err: nil, exp: nil},
+		{err: SDeviceNotFound, exp: ErrAddrNACK},
+		{err: ErrAddrNACK, exp: ErrAddrNACK},
+		{err: nack, exp: nack},
+	} {
+		if err := i2c.fail(test.err); test.exp != err {
+			t.Fatalf("unexpected error: %v != %v", err, test.exp)
+		}
+	}
+}
@@ -0,0 +1,599 @@
+package ft232h
+
+import (
+	"fmt"
+	"time"
+)
+
+// JTAG stores interface configuration settings for a JTAG adapter and provides
+// methods for navigating the TAP (Test Access Port) state machine and shifting
+// data through the instruction (IR) and data (DR) registers of a scan chain.
+// The JTAG signals are on port "D": TCK on D0, TDI on D1, TDO on D2, and TMS on
+// D3.
+// The interface must be initialized by calling either Init or Config (not both)
+// before use.
+type JTAG struct {
+	device *FT232H
+	config *jtagConfig
+	state  TAPState // current TAP state, or TAPUnknown
+}
+
+// String returns a descriptive string of a JTAG interface.
+func (jtag *JTAG) String() string {
+	return fmt.Sprintf("{ FT232H: %p, Config: %s, State: %s }",
+		jtag.device, jtag.config, jtag.state)
+}
+
+// JTAGConfig holds all of the configuration settings for initializing a JTAG
+// interface.
+type JTAGConfig struct {
+	Clock    uint32        // TCK rate, valid range: 92-30000000 (30 MHz)
+	Latency  byte          // 1-255 USB HiSpeed, 2-255 USB FullSpeed
+	Rounding ClockRounding // policy used when Clock is not exactly possible
+}
+
+// Constants defining the default configuration settings of a JTAG interface.
+const (
+	JTAGClockDefault   uint32 = 1000000 // 1 MHz
+	JTAGLatencyDefault byte   = 2
+)
+
+// JTAGConfigDefault returns the default configuration settings for a JTAG
+// interface.
+func JTAGConfigDefault() *JTAGConfig {
+	return jtagConfigDefault().JTAGConfig()
+}
+
+// GetConfig returns the current configuration settings of the JTAG interface.
+// The Clock field contains the effective TCK rate generated by the MPSSE engine.
+func (jtag *JTAG) GetConfig() *JTAGConfig {
+	return jtag.config.JTAGConfig()
+}
+
+// jtagConfig holds the configuration settings of a JTAG interface.
+type jtagConfig struct {
+	clock    mpsseClock
+	latency  uint8
+	rounding ClockRounding
+}
+
+// String returns a descriptive string of a jtagConfig.
+func (c jtagConfig) String() string {
+	return fmt.Sprintf("{ Clock: %s, Latency: \"%d ms\", Rounding: %s }",
+		c.clock, c.latency, c.rounding)
+}
+
+// jtagConfigDefault returns the default configuration settings of a JTAG
+// interface.
+func jtagConfigDefault() *jtagConfig {
+	clock, _ := newMPSSEClock(JTAGClockDefault, 2, ClockRoundingDefault)
+	return &jtagConfig{
+		clock:    clock,
+		latency:  JTAGLatencyDefault,
+		rounding: ClockRoundingDefault,
+	}
+}
+
+// JTAGConfig returns the exported configuration settings of a jtagConfig.
+func (c *jtagConfig) JTAGConfig() *JTAGConfig {
+	return &JTAGConfig{
+		Clock:    c.clock.rate(),
+		Latency:  c.latency,
+		Rounding: c.rounding,
+	}
+}
+
+// Constants defining the JTAG signals on port "D", and the pin levels and
+// directions used to initialize them.
+const (
+	jtagTCK    uint8 = 0x01 // D0, output
+	jtagTDI    uint8 = 0x02 // D1, output
+	jtagTDO    uint8 = 0x04 // D2, input
+	jtagTMS    uint8 = 0x08 // D3, output
+	jtagDir          = jtagTCK | jtagTDI | jtagTMS
+	jtagVal          = jtagTMS // TCK idles LOW, TMS HIGH
+	jtagTMSMax uint  = 7       // TMS bits per MPSSE command
+	jtagBytes  uint  = 0x10000 // bytes per MPSSE data shifting command
+)
+
+// Config changes the configuration settings of the JTAG interface and
+// (re)initializes it.
+// If cfg is nil, the default configuration is used (see JTAGConfigDefault), and
+// any zero Clock or Latency field is replaced by its default value.
+func (jtag *JTAG) Config(cfg *JTAGConfig) error {
+
+	if err := jtag.configure(cfg); nil != err {
+		return err
+	}
+
+	return jtag.Init()
+}
+
+// configure validates the given configuration and, only if it is valid, stores
+// it as the current configuration without initializing the JTAG interface.
+// If the given configuration is nil, the default configuration is used.
+func (jtag *JTAG) configure(cfg *JTAGConfig) error {
+
+	if nil == cfg {
+		cfg = JTAGConfigDefault()
+	}
+
+	rate := cfg.Clock
+	if 0 == rate {
+		rate = JTAGClockDefault
+	}
+
+	clock, err := newMPSSEClock(rate, 2, cfg.Rounding)
+	if nil != err {
+		return err
+	}
+
+	jtag.config.clock = clock
+	jtag.config.rounding = cfg.Rounding
+
+	if 0 == cfg.Latency {
+		jtag.config.latency = JTAGLatencyDefault
+	} else {
+		jtag.config.latency = cfg.Latency
+	}
+
+	return nil
+}
+
+// Init initializes the JTAG interface to a state ready for use, and resets the
+// TAP state machine of all devices in the scan chain to Test-Logic-Reset.
+// If Config has not been called, the default configuration is used (see
+// JTAGConfigDefault).
+// If the interface is already initialized, it is first closed before
+// initializing the interface.
+func (jtag *JTAG) Init() error {
+
+	// close any open channels before trying to init
+	if err := jtag.device.Close(); nil != err {
+		return err
+	}
+
+	if err := mpsseInit(jtag.device.info, jtag.config.latency,
+		jtag.config.clock, jtagVal, jtagDir); nil != err {
+		return err
+	}
+
+	jtag.device.mode = ModeJTAG
+
+	if err := jtag.Reset(); nil != err {
+		return err
+	}
+
+	return jtag.device.GPIO.Init() // reset GPIO
+}
+
+// Close closes both the JTAG interface and the connection to the FT232H device.
+func (jtag *JTAG) Close() error {
+	jtag.state = TAPUnknown
+	return jtag.device.Close()
+}
+
+// SetClock changes the TCK rate of the initialized interface, using the
+// configured rounding policy, and returns the effective TCK rate.
+func (jtag *JTAG) SetClock(rate uint32) (uint32, error) {
+	clock, err := newMPSSEClock(rate, 2, jtag.config.rounding)
+	if nil != err {
+		return 0, err
+	}
+	if _, err := _FT_Write(jtag.device.info, clock.cmd()); nil != err {
+		return 0, err
+	}
+	jtag.config.clock = clock
+	return clock.rate(), nil
+}
+
+// State returns the current state of the TAP state machine, which is TAPUnknown
+// until the interface is initialized.
+func (jtag *JTAG) State() TAPState {
+	return jtag.state
+}
+
+// exec sends the given command stream to the MPSSE engine and returns the bits
+// read from TDO. The TAP state is unknown if an error is returned.
+func (jtag *JTAG) exec(cmd *jtagCmd) ([]uint8, error) {
+	cmd.flush()
+	if _, err := _FT_Write(jtag.device.info, cmd.buf); nil != err {
+		jtag.state = TAPUnknown
+		return nil, err
+	}
+	resp, err := _FT_Read(jtag.device.info, uint(len(cmd.resp)))
+	if nil != err {
+		jtag.state = TAPUnknown
+		return nil, err
+	}
+	jtag.state = cmd.state
+	return cmd.parse(resp), nil
+}
+
+// Reset moves the TAP state machine to Test-Logic-Reset from any state, by
+// clocking TMS HIGH five times, which loads the IDCODE (or BYPASS) instruction
+// into every device in the scan chain.
+func (jtag *JTAG) Reset() error {
+	cmd := &jtagCmd{state: TAPUnknown}
+	cmd.moveTo(TAPReset)
+	_, err := jtag.exec(cmd)
+	return err
+}
+
+// Goto moves the TAP state machine to the given state along the shortest path.
+func (jtag *JTAG) Goto(state TAPState) error {
+	if TAPUnknown == jtag.state {
+		return fmt.Errorf("invalid TAP state (not initialized): %s", jtag.state)
+	}
+	if !state.valid() {
+		return fmt.Errorf("invalid TAP state: %s", state)
+	}
+	cmd := &jtagCmd{state: jtag.state}
+	cmd.moveTo(state)
+	_, err := jtag.exec(cmd)
+	return err
+}
+
+// RunTest moves the TAP state machine to the given stable state (TAPIdle,
+// TAPReset, TAPPauseDR, or TAPPauseIR), clocks TCK the given number of cycles in
+// that state, and then waits at least the given duration min.
+func (jtag *JTAG) RunTest(state TAPState, cycles uint, min time.Duration) error {
+	if TAPUnknown == jtag.state {
+		return fmt.Errorf("invalid TAP state (not initialized): %s", jtag.state)
+	}
+	if !state.stable() {
+		return fmt.Errorf("invalid TAP run state: %s", state)
+	}
+	cmd := &jtagCmd{state: jtag.state}
+	cmd.moveTo(state)
+	cmd.clock(cycles)
+	if min > 0 {
+		cmd.sync() // wait for all cycles to be clocked before waiting
+	}
+	if _, err := jtag.exec(cmd); nil != err {
+		return err
+	}
+	wait(min)
+	return nil
+}
+
+// ShiftIR shifts the given number of bits of in (LSB first) into the
+// instruction registers of the scan chain, and returns the bits shifted out of
+// TDO, in the same format. If in is shorter than bits, it is padded with zeros.
+// The TAP state machine is then moved to the given end state, which is usually
+// TAPIdle or TAPPauseIR (or TAPShiftIR to continue shifting).
+func (jtag *JTAG) ShiftIR(in []uint8, bits uint, end TAPState) ([]uint8, error) {
+	return jtag.shift(TAPShiftIR, in, bits, end)
+}
+
+// ShiftDR shifts the given number of bits of in (LSB first) into the data
+// registers of the scan chain, and returns the bits shifted out of TDO, in the
+// same format. If in is shorter than bits, it is padded with zeros.
+// The TAP state machine is then moved to the given end state, which is usually
+// TAPIdle or TAPPauseDR (or TAPShiftDR to continue shifting).
+func (jtag *JTAG) ShiftDR(in []uint8, bits uint, end TAPState) ([]uint8, error) {
+	return jtag.shift(TAPShiftDR, in, bits, end)
+}
+
+// shift implements ShiftIR and ShiftDR for the given shift state.
+func (jtag *JTAG) shift(shift TAPState, in []uint8, bits uint, end TAPState) ([]uint8, error) {
+	if TAPUnknown == jtag.state {
+		return nil, fmt.Errorf("invalid TAP state (not initialized): %s", jtag.state)
+	}
+	if !end.valid() {
+		return nil, fmt.Errorf("invalid TAP state: %s", end)
+	}
+	cmd := &jtagCmd{state: jtag.state}
+	cmd.moveTo(shift)
+	cmd.shift(in, bits, end != shift)
+	cmd.moveTo(end)
+	return jtag.exec(cmd)
+}
+
+// TAPState is a state of the JTAG TAP controller state machine.
+type TAPState uint8
+
+// Constants defining the states of the TAP controller state machine.
+const (
+	TAPReset     TAPState = iota // Test-Logic-Reset
+	TAPIdle                      // Run-Test/Idle
+	TAPSelectDR                  // Select-DR-Scan
+	TAPCaptureDR                 // Capture-DR
+	TAPShiftDR                   // Shift-DR
+	TAPExit1DR                   // Exit1-DR
+	TAPPauseDR                   // Pause-DR
+	TAPExit2DR                   // Exit2-DR
+	TAPUpdateDR                  // Update-DR
+	TAPSelectIR                  // Select-IR-Scan
+	TAPCaptureIR                 // Capture-IR
+	TAPShiftIR                   // Shift-IR
+	TAPExit1IR                   // Exit1-IR
+	TAPPauseIR                   // Pause-IR
+	TAPExit2IR                   // Exit2-IR
+	TAPUpdateIR                  // Update-IR
+	TAPUnknown                   // state not known (before reset)
+)
+
+// tapNext defines the state transitions of the TAP state machine, indexed by
+// the current state and then by the value of TMS (0 or 1).
+var tapNext = [TAPUnknown][2]TAPState{
+	TAPReset:     {TAPIdle, TAPReset},
+	TAPIdle:      {TAPIdle, TAPSelectDR},
+	TAPSelectDR:  {TAPCaptureDR, TAPSelectIR},
+	TAPCaptureDR: {TAPShiftDR, TAPExit1DR},
+	TAPShiftDR:   {TAPShiftDR, TAPExit1DR},
+	TAPExit1DR:   {TAPPauseDR, TAPUpdateDR},
+	TAPPauseDR:   {TAPPauseDR, TAPExit2DR},
+	TAPExit2DR:   {TAPShiftDR, TAPUpdateDR},
+	TAPUpdateDR:  {TAPIdle, TAPSelectDR},
+	TAPSelectIR:  {TAPCaptureIR, TAPReset},
+	TAPCaptureIR: {TAPShiftIR, TAPExit1IR},
+	TAPShiftIR:   {TAPShiftIR, TAPExit1IR},
+	TAPExit1IR:   {TAPPauseIR, TAPUpdateIR},
+	TAPPauseIR:   {TAPPauseIR, TAPExit2IR},
+	TAPExit2IR:   {TAPShiftIR, TAPUpdateIR},
+	TAPUpdateIR:  {TAPIdle, TAPSelectDR},
+}
+
+// String returns the name of a TAPState used by SVF (e.g., "IDLE", "DRPAUSE").
+func (s TAPState) String() string {
+	switch s {
+	case TAPReset:
+		return "RESET"
+	case TAPIdle:
+		return "IDLE"
+	case TAPSelectDR:
+		return "DRSELECT"
+	case TAPCaptureDR:
+		return "DRCAPTURE"
+	case TAPShiftDR:
+		return "DRSHIFT"
+	case TAPExit1DR:
+		return "DREXIT1"
+	case TAPPauseDR:
+		return "DRPAUSE"
+	case TAPExit2DR:
+		return "DREXIT2"
+	case TAPUpdateDR:
+		return "DRUPDATE"
+	case TAPSelectIR:
+		return "IRSELECT"
+	case TAPCaptureIR:
+		return "IRCAPTURE"
+	case TAPShiftIR:
+		return "IRSHIFT"
+	case TAPExit1IR:
+		return "IREXIT1"
+	case TAPPauseIR:
+		return "IRPAUSE"
+	case TAPExit2IR:
+		return "IREXIT2"
+	case TAPUpdateIR:
+		return "IRUPDATE"
+	case TAPUnknown:
+		return "(unknown)"
+	}
+	return "(invalid state)"
+}
+
+// next returns the state following the receiver s when TCK is clocked with the
+// given level of TMS.
+func (s TAPState) next(tms bool) TAPState {
+	if tms {
+		return tapNext[s][1]
+	}
+	return tapNext[s][0]
+}
+
+// valid returns true if the receiver s is a state of the TAP state machine.
+func (s TAPState) valid() bool {
+	return s < TAPUnknown
+}
+
+// stable returns true if the TAP state machine can remain in the receiver s
+// while TCK is clocked.
+func (s TAPState) stable() bool {
+	switch s {
+	case TAPReset, TAPIdle, TAPPauseDR, TAPPauseIR:
+		return true
+	}
+	return false
+}
+
+// tapPath returns the TMS values (in order) that move the TAP state machine
+// from one state to another along the shortest path. If from is TAPUnknown or
+// to is TAPReset, the path begins with five 1s to reset the state machine.
+func tapPath(from TAPState, to TAPState) []bool {
+
+	var path []bool
+	if TAPUnknown == from || (TAPReset == to && TAPReset != from) {
+		path = []bool{true, true, true, true, true}
+		from = TAPReset
+	}
+
+	// breadth-first search; there are at most 8 transitions between any states.
+	type node struct {
+		prev TAPState
+		tms  bool
+		seen bool
+	}
+	var visit [TAPUnknown]node
+	visit[from].seen = true
+	queue := []TAPState{from}
+	for len(queue) > 0 && !visit[to].seen {
+		s := queue[0]
+		queue = queue[1:]
+		for tms, n := range tapNext[s] {
+			if !visit[n].seen {
+				visit[n] = node{prev: s, tms: 1 == tms, seen: true}
+				queue = append(queue, n)
+			}
+		}
+	}
+
+	var tail []bool
+	for s := to; s != from; s = visit[s].prev {
+		tail = append([]bool{visit[s].tms}, tail...)
+	}
+	return append(path, tail...)
+}
+
+// jtagCmd is a command stream sent to the MPSSE engine to perform a JTAG
+// operation, along with the number of TDO bits in each response byte.
+type jtagCmd struct {
+	buf   []uint8
+	resp  []uint8  // number of TDO bits in each response byte
+	state TAPState // TAP state after the commands are executed
+	tdi   bool     // level of TDI held during TMS commands
+}
+
+// tms appends commands that clock the given TMS values, holding TDI at the
+// level of the last bit shifted. If read is true, TDO is sampled on each
+// clock.
+func (c *jtagCmd) tms(path []bool, read bool) {
+	for beg := uint(0); beg < uint(len(path)); beg += jtagTMSMax {
+		end := beg + jtagTMSMax
+		if end > uint(len(path)) {
+			end = uint(len(path))
+		}
+		var b uint8
+		for i, v := range path[beg:end] {
+			if v {
+				b |= 1 << uint(i)
+			}
+		}
+		if c.tdi {
+			b |= 0x80
+		}
+		op := mpsseTMSOutBitsNegEdge
+		if read {
+			op = mpsseTMSBitsInPosOutNeg
+			c.resp = append(c.resp, uint8(end-beg))
+		}
+		c.buf = append(c.buf, op, uint8(end-beg-1), b)
+	}
+	if TAPUnknown != c.state {
+		for _, v := range path {
+			c.state = c.state.next(v)
+		}
+	}
+}
+
+// moveTo appends commands that move the TAP state machine to the given state.
+func (c *jtagCmd) moveTo(state TAPState) {
+	path := tapPath(c.state, state)
+	c.tms(path, false)
+	c.state = state
+}
+
+// shift appends commands that shift the given number of bits of in (LSB first)
+// through TDI, sampling TDO. If exit is true, the last bit is shifted with TMS
+// HIGH, moving the TAP state machine from the shift state to its exit state.
+func (c *jtagCmd) shift(in []uint8, bits uint, exit bool) {
+
+	if 0 == bits {
+		return
+	}
+
+	n := bits
+	if exit {
+		n-- // last bit is shifted with TMS
+	}
+
+	// whole bytes
+	bytes := n / 8
+	for beg := uint(0); beg < bytes; beg += jtagBytes {
+		end := beg + jtagBytes
+		if end > bytes {
+			end = bytes
+		}
+		lo, hi := mpsseLen(end - beg)
+		c.buf = append(c.buf, mpsseDataBytesInPosOutNeg|mpsseDataLSBFirst, lo, hi)
+		for i := beg; i < end; i++ {
+			c.buf = append(c.buf, jtagByte(in, i))
+			c.resp = append(c.resp, 8)
+		}
+	}
+
+	// remaining bits
+	if rem := n % 8; rem > 0 {
+		c.buf = append(c.buf, mpsseDataBitsInPosOutNeg|mpsseDataLSBFirst,
+			uint8(rem-1), jtagByte(in, bytes))
+		c.resp = append(c.resp, uint8(rem))
+	}
+
+	c.tdi = jtagBit(in, bits-1)
+	if exit {
+		c.tms([]bool{true}, true)
+	}
+}
+
+// clock appends commands that clock TCK the given number of cycles without
+// changing TMS or transferring data.
+func (c *jtagCmd) clock(cycles uint) {
+	for bytes := cycles / 8; bytes > 0; {
+		n := bytes
+		if n > jtagBytes {
+			n = jtagBytes
+		}
+		lo, hi := mpsseLen(n)
+		c.buf = append(c.buf, mpsseClockBytes, lo, hi)
+		bytes -= n
+	}
+	if rem := cycles % 8; rem > 0 {
+		c.buf = append(c.buf, mpsseClockBits, uint8(rem-1))
+	}
+}
+
+// sync appends a command that reads port D, so that the response is not
+// received until all preceding commands have been executed.
+func (c *jtagCmd) sync() {
+	c.buf = append(c.buf, mpsseGetDataBitsLowByte)
+	c.resp = append(c.resp, 0)
+}
+
+// flush appends the command that sends all pending responses to the host, if
+// any responses are expected.
+func (c *jtagCmd) flush() {
+	if len(c.resp) > 0 {
+		c.buf = append(c.buf, mpsseSendImmediate)
+	}
+}
+
+// parse returns the TDO bits (LSB first) contained in the given response bytes.
+// The MPSSE engine shifts TDO bits into each response byte from the MSB, so a
+// byte containing n < 8 bits holds them in its n most significant bits.
+func (c *jtagCmd) parse(resp []uint8) []uint8 {
+	var (
+		out  []uint8
+		bits uint
+	)
+	for i, n := range c.resp {
+		if i >= len(resp) {
+			break
+		}
+		b := resp[i] >> (8 - uint(n))
+		for j := uint(0); j < uint(n); j++ {
+			if 0 == bits%8 {
+				out = append(out, 0)
+			}
+			out[bits/8] |= ((b >> j) & 1) << (bits % 8)
+			bits++
+		}
+	}
+	return out
+}
+
+// jtagByte returns byte i of the given data, or 0 if i is out of range.
+func jtagByte(data []uint8, i uint) uint8 {
+	if i < uint(len(data)) {
+		return data[i]
+	}
+	return 0
+}
+
+// jtagBit returns bit i (LSB first) of the given data, or false if i is out of
+// range.
+func jtagBit(data []uint8, i uint) bool {
+	return 0 != (jtagByte(data, i/8)>>(i%8))&1
+}
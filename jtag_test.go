@@ -0,0 +1,296 @@
+package ft232h
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTAPPath(t *testing.T) {
+
+	for from := TAPReset; from <= TAPUnknown; from++ {
+		for to := TAPReset; to < TAPUnknown; to++ {
+			path := tapPath(from, to)
+			max := 8
+			if TAPUnknown == from || (TAPReset == to && TAPReset != from) {
+				max += 5
+			}
+			if len(path) > max {
+				t.Fatalf("path too long: %s -> %s: %v", from, to, path)
+			}
+			s := from
+			if TAPUnknown == s {
+				s = TAPReset // after any five 1s
+				path = path[5:]
+			}
+			for _, tms := range path {
+				s = s.next(tms)
+			}
+			if to != s {
+				t.Fatalf("invalid path: %s -> %s: ended in %s", from, to, s)
+			}
+		}
+	}
+
+	for _, test := range []struct {
+		from, to TAPState
+		path     []bool
+	}{
+		{from: TAPIdle, to: TAPShiftDR, path: []bool{true, false, false}},
+		{from: TAPIdle, to: TAPShiftIR, path: []bool{true, true, false, false}},
+		{from: TAPExit1DR, to: TAPIdle, path: []bool{true, false}},
+		{from: TAPPauseIR, to: TAPShiftIR, path: []bool{true, false}},
+		{from: TAPIdle, to: TAPIdle, path: nil},
+		{from: TAPUnknown, to: TAPIdle, path: []bool{true, true, true, true, true, false}},
+		{from: TAPShiftDR, to: TAPReset, path: []bool{true, true, true, true, true}},
+	} {
+		t.Run(test.from.String()+"-"+test.to.String(), func(s *testing.T) {
+			path := tapPath(test.from, test.to)
+			if len(test.path) != len(path) {
+				s.Fatalf("unexpected path: %v", path)
+			}
+			for i := range path {
+				if test.path[i] != path[i] {
+					s.Fatalf("unexpected path: %v", path)
+				}
+			}
+		})
+	}
+}
+
+func TestJTAGCmd(t *testing.T) {
+
+	for _, test := range []struct {
+		name  string
+		in    []uint8
+		bits  uint
+		exit  bool
+		buf   []uint8
+		resp  []uint8
+		state TAPState
+	}{
+		{
+			name: "bits-exit", in: []uint8{0x05}, bits: 3, exit: true,
+			buf:  []uint8{0x3B, 0x01, 0x05, 0x6B, 0x00, 0x81},
+			resp: []uint8{2, 1}, state: TAPExit1DR,
+		},
+		{
+			name: "bytes-bits-exit", in: []uint8{0xA5, 0x01}, bits: 10, exit: true,
+			buf:  []uint8{0x39, 0x00, 0x00, 0xA5, 0x3B, 0x00, 0x01, 0x6B, 0x00, 0x01},
+			resp: []uint8{8, 1, 1}, state: TAPExit1DR,
+		},
+		{
+			name: "bytes", in: []uint8{0x12, 0x34}, bits: 16, exit: false,
+			buf:  []uint8{0x39, 0x01, 0x00, 0x12, 0x34},
+			resp: []uint8{8, 8}, state: TAPShiftDR,
+		},
+		{
+			name: "single-exit", in: []uint8{0x00}, bits: 1, exit: true,
+			buf:  []uint8{0x6B, 0x00, 0x01},
+			resp: []uint8{1}, state: TAPExit1DR,
+		},
+	} {
+		t.Run(test.name, func(s *testing.T) {
+			cmd := &jtagCmd{state: TAPShiftDR}
+			cmd.shift(test.in, test.bits, test.exit)
+			if !bytes.Equal(test.buf, cmd.buf) {
+				s.Fatalf("unexpected commands: % 02X", cmd.buf)
+			}
+			if !bytes.Equal(test.resp, cmd.resp) {
+				s.Fatalf("unexpected response bits: %v", cmd.resp)
+			}
+			if test.state != cmd.state {
+				s.Fatalf("unexpected state: %s", cmd.state)
+			}
+		})
+	}
+
+	// TDO bits are shifted into each response byte from the MSB.
+	cmd := &jtagCmd{resp: []uint8{8, 1, 1, 0, 3}}
+	out := cmd.parse([]uint8{0x3C, 0x80, 0x00, 0xFF, 0xA0})
+	if !bytes.Equal([]uint8{0x3C, 0x15}, out) {
+		t.Fatalf("unexpected TDO bits: % 02X", out)
+	}
+
+	cmd = &jtagCmd{state: TAPIdle}
+	cmd.moveTo(TAPShiftIR)
+	cmd.clock(20)
+	if exp := []uint8{0x4B, 0x03, 0x03, 0x8F, 0x01, 0x00, 0x8E, 0x03}; !bytes.Equal(exp, cmd.buf) {
+		t.Fatalf("unexpected commands: % 02X", cmd.buf)
+	}
+}
+
+// jtagChain returns the bits shifted out of a scan chain with the given IDCODEs
+// (0 for BYPASS) after reset, followed by the 1s shifted in.
+func jtagChain(ids ...JTAGIDCode) ([]uint8, uint) {
+	var (
+		out  = make([]uint8, 4*(JTAGScanMax+1))
+		bits uint
+	)
+	for _, id := range ids {
+		if 0 == id {
+			bits++
+			continue
+		}
+		for j := uint(0); j < 32; j++ {
+			out[bits/8] |= uint8((id>>j)&1) << (bits % 8)
+			bits++
+		}
+	}
+	for ; bits < uint(len(out))*8; bits++ {
+		out[bits/8] |= 1 << (bits % 8)
+	}
+	return out, bits
+}
+
+func TestJTAGIDCodes(t *testing.T) {
+
+	for _, test := range []struct {
+		name string
+		ids  []JTAGIDCode
+	}{
+		{name: "empty", ids: nil},
+		{name: "single", ids: []JTAGIDCode{0x4BA00477}},
+		{name: "bypass", ids: []JTAGIDCode{0x06413041, 0, 0x4BA00477}},
+		{name: "bypass-last", ids: []JTAGIDCode{0x0362D093, 0}},
+	} {
+		t.Run(test.name, func(s *testing.T) {
+			ids, err := jtagIDCodes(jtagChain(test.ids...))
+			if nil != err {
+				s.Fatalf("unexpected error: %v", err)
+			}
+			if len(test.ids) != len(ids) {
+				s.Fatalf("unexpected IDCODEs: %v", ids)
+			}
+			for i := range ids {
+				if test.ids[i] != ids[i] {
+					s.Fatalf("unexpected IDCODEs: %v", ids)
+				}
+			}
+		})
+	}
+
+	// TDO stuck LOW
+	if _, err := jtagIDCodes(make([]uint8, 4*(JTAGScanMax+1)), 32*(JTAGScanMax+1)); nil == err {
+		t.Fatalf("expected error with TDO stuck LOW")
+	}
+
+	if n, ok := jtagLength(jtagFill(13, 3), 8); !ok || 5 != n {
+		t.Fatalf("unexpected length: %d (%t)", n, ok)
+	}
+	if _, ok := jtagLength(jtagFill(16, 0), 8); ok {
+		t.Fatalf("unexpected length")
+	}
+}
+
+func TestJTAGIRLen(t *testing.T) {
+
+	for _, test := range []struct {
+		name  string
+		irLen []uint
+		total uint
+		exp   []uint
+		valid bool
+	}{
+		{name: "known", irLen: []uint{5, 4}, total: 9, exp: []uint{5, 4}, valid: true},
+		{name: "derived", irLen: []uint{5, 0, 4}, total: 17, exp: []uint{5, 8, 4}, valid: true},
+		{name: "unknown", irLen: []uint{0, 0}, total: 9, exp: []uint{0, 0}, valid: true},
+		{name: "mismatch", irLen: []uint{5, 4}, total: 10, valid: false},
+		{name: "overflow", irLen: []uint{5, 0}, total: 5, valid: false},
+	} {
+		t.Run(test.name, func(s *testing.T) {
+			dev := make([]JTAGDevice, len(test.irLen))
+			for i, n := range test.irLen {
+				dev[i].IRLen = n
+			}
+			err := jtagIRLen(dev, test.total)
+			if test.valid != (nil == err) {
+				s.Fatalf("unexpected result: %v", err)
+			}
+			for i := range test.exp {
+				if test.exp[i] != dev[i].IRLen {
+					s.Fatalf("unexpected IR length: %v", dev)
+				}
+			}
+		})
+	}
+}
+
+func TestJTAGIDCode(t *testing.T) {
+
+	for _, test := range []struct {
+		id    JTAGIDCode
+		mfr   string
+		part  uint16
+		ver   uint8
+		name  string
+		irLen uint
+	}{
+		{id: 0x4BA00477, mfr: "ARM", part: 0xBA00, ver: 4, name: "ARM CoreSight JTAG-DP", irLen: 4},
+		{id: 0x3BA00477, mfr: "ARM", part: 0xBA00, ver: 3, name: "ARM CoreSight JTAG-DP", irLen: 4},
+		{id: 0x06413041, mfr: "STMicroelectronics", part: 0x6413, ver: 0, name: "STM32F405/407 boundary scan", irLen: 5},
+		{id: 0x1362D093, mfr: "Xilinx", part: 0x362D, ver: 1, name: "Xilinx XC7A35T", irLen: 6},
+		{id: 0x020F30DD, mfr: "Altera", part: 0x20F3, ver: 0, name: "Altera EP4CE22 (Cyclone IV)", irLen: 10},
+		{id: 0x41111043, mfr: "Lattice", part: 0x1111, ver: 4, name: "Lattice LFE5U-25F (ECP5)", irLen: 8},
+		{id: 0x12345679, mfr: "JEP106 0x33C", part: 0x2345, ver: 1},
+	} {
+		t.Run(test.id.String(), func(s *testing.T) {
+			if !test.id.Valid() {
+				s.Fatalf("unexpected invalid IDCODE")
+			}
+			if test.mfr != test.id.ManufacturerName() {
+				s.Fatalf("unexpected manufacturer: %s", test.id.ManufacturerName())
+			}
+			if test.part != test.id.Part() || test.ver != test.id.Version() {
+				s.Fatalf("unexpected part/version: 0x%04X/%d", test.id.Part(), test.id.Version())
+			}
+			p := LookupJTAGPart(test.id)
+			if "" == test.name {
+				if nil != p {
+					s.Fatalf("unexpected part: %s", p.Name)
+				}
+			} else if nil == p || test.name != p.Name || test.irLen != p.IRLen {
+				s.Fatalf("unexpected part: %+v", p)
+			}
+		})
+	}
+
+	if JTAGIDCode(0x000000FF).Valid() || JTAGIDCode(0x4BA00476).Valid() {
+		t.Fatalf("unexpected valid IDCODE")
+	}
+}
+
+func TestJTAGConfig(t *testing.T) {
+
+	jtag := &JTAG{config: jtagConfigDefault()}
+	init := *jtag.config
+
+	if err := jtag.configure(&JTAGConfig{Clock: 40000000,
+		Rounding: ClockAtLeast}); nil == err {
+		t.Fatalf("expected error for invalid configuration")
+	}
+	if init != *jtag.config {
+		t.Fatalf("configuration changed: %s != %s", *jtag.config, init)
+	}
+
+	for _, test := range []struct {
+		name string
+		cfg  *JTAGConfig
+		want JTAGConfig
+	}{
+		{name: "nil", cfg: nil, want: *JTAGConfigDefault()},
+		{name: "zero", cfg: &JTAGConfig{}, want: *JTAGConfigDefault()},
+		{name: "latency", cfg: &JTAGConfig{Clock: 6000000},
+			want: JTAGConfig{Clock: 6000000, Latency: JTAGLatencyDefault}},
+		{name: "clock", cfg: &JTAGConfig{Latency: 16},
+			want: JTAGConfig{Clock: JTAGClockDefault, Latency: 16}},
+	} {
+		t.Run(test.name, func(s *testing.T) {
+			if err := jtag.configure(test.cfg); nil != err {
+				s.Fatalf("configure(): %v", err)
+			}
+			if got := jtag.GetConfig(); test.want != *got {
+				s.Fatalf("unexpected configuration: %+v != %+v", *got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package ft232h
+
+import (
+	"fmt"
+)
+
+// JTAGIDCode is the 32-bit device identification register of a JTAG device,
+// loaded into its data register when the TAP state machine is reset.
+type JTAGIDCode uint32
+
+// Version returns the 4-bit version field of the IDCODE.
+func (id JTAGIDCode) Version() uint8 {
+	return uint8(id >> 28)
+}
+
+// Part returns the 16-bit part number field of the IDCODE.
+func (id JTAGIDCode) Part() uint16 {
+	return uint16(id >> 12)
+}
+
+// Manufacturer returns the 11-bit JEP106 manufacturer field of the IDCODE:
+// the number of continuation codes (bank) in bits 10-7, and the identity code
+// (without parity) in bits 6-0.
+func (id JTAGIDCode) Manufacturer() uint16 {
+	return uint16(id>>1) & 0x7FF
+}
+
+// Valid returns true if the IDCODE has its LSB set, as required by IEEE 1149.1,
+// and a legal manufacturer identity code.
+func (id JTAGIDCode) Valid() bool {
+	return 0 != id&1 && 0x7F != id.Manufacturer()&0x7F
+}
+
+// String returns the hexadecimal representation of the IDCODE.
+func (id JTAGIDCode) String() string {
+	return fmt.Sprintf("0x%08X", uint32(id))
+}
+
+// JTAGManufacturers maps JEP106 manufacturer fields of IDCODEs to names.
+var JTAGManufacturers = map[uint16]string{
+	0x020: "STMicroelectronics",
+	0x021: "Lattice",
+	0x049: "Xilinx",
+	0x06E: "Altera",
+	0x23B: "ARM",
+}
+
+// ManufacturerName returns the name of the manufacturer of the IDCODE, or its
+// JEP106 code if the manufacturer is not known.
+func (id JTAGIDCode) ManufacturerName() string {
+	if name, ok := JTAGManufacturers[id.Manufacturer()]; ok {
+		return name
+	}
+	return fmt.Sprintf("JEP106 0x%03X", id.Manufacturer())
+}
+
+// JTAGPart describes a known JTAG device, identified by the bits of its IDCODE
+// selected by Mask (usually all but the version field).
+type JTAGPart struct {
+	IDCode JTAGIDCode
+	Mask   JTAGIDCode
+	Name   string
+	IRLen  uint // instruction register length (bits)
+}
+
+// jtagIgnoreVersion is the mask of an IDCODE excluding its version field.
+const jtagIgnoreVersion JTAGIDCode = 0x0FFFFFFF
+
+// JTAGParts is the database of known JTAG devices used to identify devices and
+// their instruction register lengths during scan chain detection (see Scan).
+// Parts may be appended to identify other devices.
+var JTAGParts = []JTAGPart{
+	{IDCode: 0x0BA00477, Mask: jtagIgnoreVersion, Name: "ARM CoreSight JTAG-DP", IRLen: 4},
+	{IDCode: 0x3F0F0F0F, Mask: 0xFFFFFFFF, Name: "ARM7TDMI", IRLen: 4},
+	{IDCode: 0x06410041, Mask: jtagIgnoreVersion, Name: "STM32F1 (medium-density) boundary scan", IRLen: 5},
+	{IDCode: 0x06412041, Mask: jtagIgnoreVersion, Name: "STM32F1 (low-density) boundary scan", IRLen: 5},
+	{IDCode: 0x06414041, Mask: jtagIgnoreVersion, Name: "STM32F1 (high-density) boundary scan", IRLen: 5},
+	{IDCode: 0x06413041, Mask: jtagIgnoreVersion, Name: "STM32F405/407 boundary scan", IRLen: 5},
+	{IDCode: 0x120034E5, Mask: 0xFFFFFFFF, Name: "ESP32 (Xtensa)", IRLen: 5},
+	{IDCode: 0x09604093, Mask: jtagIgnoreVersion, Name: "Xilinx XC9572XL", IRLen: 8},
+	{IDCode: 0x04001093, Mask: jtagIgnoreVersion, Name: "Xilinx XC6SLX9", IRLen: 6},
+	{IDCode: 0x0362D093, Mask: jtagIgnoreVersion, Name: "Xilinx XC7A35T", IRLen: 6},
+	{IDCode: 0x0362C093, Mask: jtagIgnoreVersion, Name: "Xilinx XC7A50T", IRLen: 6},
+	{IDCode: 0x03631093, Mask: jtagIgnoreVersion, Name: "Xilinx XC7A100T", IRLen: 6},
+	{IDCode: 0x03636093, Mask: jtagIgnoreVersion, Name: "Xilinx XC7A200T", IRLen: 6},
+	{IDCode: 0x020A10DD, Mask: jtagIgnoreVersion, Name: "Altera EPM240 (MAX II)", IRLen: 10},
+	{IDCode: 0x020F10DD, Mask: jtagIgnoreVersion, Name: "Altera EP4CE6/10 (Cyclone IV)", IRLen: 10},
+	{IDCode: 0x020F30DD, Mask: jtagIgnoreVersion, Name: "Altera EP4CE22 (Cyclone IV)", IRLen: 10},
+	{IDCode: 0x41111043, Mask: jtagIgnoreVersion, Name: "Lattice LFE5U-25F (ECP5)", IRLen: 8},
+	{IDCode: 0x41112043, Mask: jtagIgnoreVersion, Name: "Lattice LFE5U-45F (ECP5)", IRLen: 8},
+	{IDCode: 0x41113043, Mask: jtagIgnoreVersion, Name: "Lattice LFE5U-85F (ECP5)", IRLen: 8},
+}
+
+// LookupJTAGPart returns the first part in JTAGParts matching the given IDCODE,
+// or nil if the IDCODE is not known.
+func LookupJTAGPart(id JTAGIDCode) *JTAGPart {
+	for i := range JTAGParts {
+		if p := &JTAGParts[i]; id&p.Mask == p.IDCode&p.Mask {
+			return p
+		}
+	}
+	return nil
+}
+
+// JTAGDevice is a device found in a JTAG scan chain.
+type JTAGDevice struct {
+	IDCode JTAGIDCode // 0 if the device has no IDCODE register
+	IRLen  uint       // instruction register length (bits), 0 if unknown
+	Part   *JTAGPart  // nil if the IDCODE is not known
+}
+
+// String returns a descriptive string of a JTAGDevice.
+func (d JTAGDevice) String() string {
+	if 0 == d.IDCode {
+		return fmt.Sprintf("{ IDCODE: (none), IRLen: %d }", d.IRLen)
+	}
+	name := "(unknown)"
+	if nil != d.Part {
+		name = d.Part.Name
+	}
+	return fmt.Sprintf("{ IDCODE: %s, Manufacturer: %s, Part: 0x%04X, "+
+		"Version: %d, Name: %s, IRLen: %d }", d.IDCode, d.IDCode.ManufacturerName(),
+		d.IDCode.Part(), d.IDCode.Version(), name, d.IRLen)
+}
+
+// Constants defining the limits of scan chain detection.
+const (
+	JTAGScanMax = 32   // max number of devices in a scan chain
+	jtagIRMax   = 1024 // max total length of all instruction registers (bits)
+)
+
+// Scan detects the devices in the scan chain, ordered from the device nearest
+// TDO (first) to the device nearest TDI (last).
+//
+// After resetting the TAP state machine, the data register of each device holds
+// its IDCODE, or a single 0 bit (BYPASS) if the device has no IDCODE register;
+// these are shifted out to identify each device. The total length of all
+// instruction registers is then measured by filling them with 1s (BYPASS), and
+// the number of devices is verified by measuring the total length of their
+// BYPASS registers. The instruction register length of each device is taken
+// from JTAGParts, or if the length of exactly one device is unknown, it is
+// derived from the total length.
+// The TAP state machine is reset on return.
+func (jtag *JTAG) Scan() ([]JTAGDevice, error) {
+
+	if err := jtag.Reset(); nil != err {
+		return nil, err
+	}
+
+	// shift out the IDCODE/BYPASS registers, followed by the 1s shifted in.
+	bits := uint(32 * (JTAGScanMax + 1))
+	out, err := jtag.ShiftDR(jtagFill(0, bits), bits, TAPIdle)
+	if nil != err {
+		return nil, err
+	}
+	ids, err := jtagIDCodes(out, bits)
+	if nil != err {
+		return nil, err
+	}
+
+	// fill all instruction registers with 0s and then 1s, and measure the length
+	// of the chain by counting the bits until the first 1 is shifted out.
+	out, err = jtag.ShiftIR(jtagFill(jtagIRMax, jtagIRMax), 2*jtagIRMax, TAPIdle)
+	if nil != err {
+		return nil, err
+	}
+	irLen, ok := jtagLength(out, jtagIRMax)
+	if !ok {
+		return nil, fmt.Errorf("invalid scan chain: IR length exceeds %d bits", jtagIRMax)
+	}
+
+	// all devices are now in BYPASS, with a 1-bit data register each.
+	bits = 2 * JTAGScanMax
+	out, err = jtag.ShiftDR(jtagFill(JTAGScanMax, JTAGScanMax), bits, TAPIdle)
+	if nil != err {
+		return nil, err
+	}
+	if n, ok := jtagLength(out, JTAGScanMax); !ok || n != uint(len(ids)) {
+		return nil, fmt.Errorf("invalid scan chain: found %d devices with IDCODE, "+
+			"%d devices with BYPASS", len(ids), n)
+	}
+
+	if err := jtag.Reset(); nil != err {
+		return nil, err
+	}
+
+	dev := make([]JTAGDevice, len(ids))
+	for i, id := range ids {
+		dev[i].IDCode = id
+		if p := LookupJTAGPart(id); 0 != id && nil != p {
+			dev[i].Part, dev[i].IRLen = p, p.IRLen
+		}
+	}
+	if err := jtagIRLen(dev, irLen); nil != err {
+		return dev, err
+	}
+	return dev, nil
+}
+
+// jtagFill returns a bit string (LSB first) of the given number of 0s followed
+// by the given number of 1s.
+func jtagFill(zeros uint, ones uint) []uint8 {
+	out := make([]uint8, (zeros+ones+7)/8)
+	for i := zeros; i < zeros+ones; i++ {
+		out[i/8] |= 1 << (i % 8)
+	}
+	return out
+}
+
+// jtagIDCodes parses the IDCODE and BYPASS registers shifted out of a scan chain
+// after reset, followed by the 1s shifted in, which end the chain (an IDCODE
+// of all 1s is invalid).
+func jtagIDCodes(out []uint8, bits uint) ([]JTAGIDCode, error) {
+	var ids []JTAGIDCode
+	for i := uint(0); i < bits; {
+		if !jtagBit(out, i) {
+			ids = append(ids, 0) // BYPASS
+			i++
+		} else {
+			if i+32 > bits {
+				break
+			}
+			var id JTAGIDCode
+			for j := uint(0); j < 32; j++ {
+				if jtagBit(out, i+j) {
+					id |= 1 << j
+				}
+			}
+			if 0xFFFFFFFF == id {
+				return ids, nil
+			}
+			ids = append(ids, id)
+			i += 32
+		}
+		if len(ids) > JTAGScanMax {
+			break
+		}
+	}
+	return nil, fmt.Errorf("invalid scan chain: more than %d devices, or TDO stuck", JTAGScanMax)
+}
+
+// jtagLength returns the number of bits after the given offset until the first
+// 1 in a bit string, and false if there is no 1 after the offset.
+func jtagLength(out []uint8, off uint) (uint, bool) {
+	for i := off; i < uint(len(out))*8; i++ {
+		if jtagBit(out, i) {
+			return i - off, true
+		}
+	}
+	return 0, false
+}
+
+// jtagIRLen verifies the instruction register lengths of the given devices
+// against the total length, deriving the length of at most one unknown device.
+func jtagIRLen(dev []JTAGDevice, total uint) error {
+	var (
+		sum     uint
+		unknown = -1
+	)
+	for i, d := range dev {
+		if 0 == d.IRLen {
+			if unknown >= 0 {
+				return nil // cannot be derived
+			}
+			unknown = i
+		}
+		sum += d.IRLen
+	}
+	if sum > total || (unknown < 0 && sum != total) || (unknown >= 0 && sum == total) {
+		return fmt.Errorf("invalid scan chain: IR length %d bits, expected %d bits", total, sum)
+	}
+	if unknown >= 0 {
+		dev[unknown].IRLen = total - sum
+	}
+	return nil
+}
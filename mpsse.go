@@ -0,0 +1,114 @@
+package ft232h
+
+import (
+	"fmt"
+)
+
+// Constants defining the MPSSE command opcodes used when communicating with the
+// MPSSE engine directly, i.e. without going through libMPSSE. See FTDI
+// application note AN_108 "Command Processor for MPSSE and MCU Host Bus
+// Emulation Modes" for details.
+const (
+	// data shifting commands, combined with the bit flags below
+	mpsseDataOutBytesPosEdge    uint8 = 0x10 // clock bytes out on +ve edge
+	mpsseDataOutBytesNegEdge    uint8 = 0x11 // clock bytes out on -ve edge
+	mpsseDataOutBitsPosEdge     uint8 = 0x12 // clock bits out on +ve edge
+	mpsseDataOutBitsNegEdge     uint8 = 0x13 // clock bits out on -ve edge
+	mpsseDataInBytesPosEdge     uint8 = 0x20 // clock bytes in on +ve edge
+	mpsseDataInBytesNegEdge     uint8 = 0x24 // clock bytes in on -ve edge
+	mpsseDataInBitsPosEdge      uint8 = 0x22 // clock bits in on +ve edge
+	mpsseDataInBitsNegEdge      uint8 = 0x26 // clock bits in on -ve edge
+	mpsseDataBytesInPosOutNeg   uint8 = 0x31 // clock bytes in +ve, out -ve edge
+	mpsseDataBytesInNegOutPos   uint8 = 0x34 // clock bytes in -ve, out +ve edge
+	mpsseDataBitsInPosOutNeg    uint8 = 0x33 // clock bits in +ve, out -ve edge
+	mpsseDataBitsInNegOutPos    uint8 = 0x36 // clock bits in -ve, out +ve edge
+	mpsseDataLSBFirst           uint8 = 0x08 // flag: shift LSB first
+	mpsseTMSOutBitsNegEdge      uint8 = 0x4B // clock bits out on TMS, -ve edge
+	mpsseTMSBitsInPosOutNeg     uint8 = 0x6B // clock bits out on TMS -ve, in +ve
+	mpsseSetDataBitsLowByte     uint8 = 0x80 // set value, direction of port D
+	mpsseGetDataBitsLowByte     uint8 = 0x81 // read value of port D
+	mpsseSetDataBitsHighByte    uint8 = 0x82 // set value, direction of port C
+	mpsseGetDataBitsHighByte    uint8 = 0x83 // read value of port C
+	mpsseLoopbackEnable         uint8 = 0x84 // connect TDI/DO to TDO/DI
+	mpsseLoopbackDisable        uint8 = 0x85 // disconnect TDI/DO from TDO/DI
+	mpsseSetClockDivisor        uint8 = 0x86 // set TCK/SK clock divisor
+	mpsseSendImmediate          uint8 = 0x87 // flush MPSSE buffer back to host
+	mpsseDisableClockDivide5    uint8 = 0x8A // use 60 MHz master clock
+	mpsseEnableClockDivide5     uint8 = 0x8B // use 12 MHz master clock
+	mpsseEnable3PhaseClocking   uint8 = 0x8C // 3-phase data clocking (I²C)
+	mpsseDisable3PhaseClocking  uint8 = 0x8D // 2-phase data clocking
+	mpsseClockBits              uint8 = 0x8E // clock bits, no data transfer
+	mpsseClockBytes             uint8 = 0x8F // clock bytes, no data transfer
+	mpsseEnableAdaptiveClocking uint8 = 0x96 // wait for RTCK on GPIOL3
+	mpsseDisableAdaptiveClock   uint8 = 0x97 // do not wait for RTCK
+	mpsseEnableDriveOnlyZero    uint8 = 0x9E // tristate pins when driving HIGH
+	mpsseBadCommand             uint8 = 0xAA // invalid opcode, used to sync
+	mpsseBadCommandReply        uint8 = 0xFA // reply to invalid opcode
+)
+
+// mpsseLen returns the 2-byte little-endian length field of an MPSSE data
+// shifting command used to transfer n units (bytes or bits), which are encoded
+// as n-1.
+func mpsseLen(n uint) (uint8, uint8) {
+	return uint8((n - 1) & 0xFF), uint8(((n - 1) >> 8) & 0xFF)
+}
+
+// mpsseSync blocks until all commands previously sent to the MPSSE engine have
+// been executed, by requesting the value of port D and waiting for its reply.
+// Returns a non-nil error if the reply could not be read.
+func mpsseSync(info *deviceInfo) error {
+	cmd := []uint8{mpsseGetDataBitsLowByte, mpsseSendImmediate}
+	if _, err := _FT_Write(info, cmd); nil != err {
+		return err
+	}
+	_, err := _FT_Read(info, 1)
+	return err
+}
+
+// Constants defining the settings of the MPSSE engine when used directly.
+const (
+	mpsseTimeout uint32 = 5000 // USB read/write timeout (ms)
+	mpsseMode    uint8  = 0x02 // D2XX bit mode: MPSSE
+)
+
+// mpsseInit opens the device and initializes the MPSSE engine for use without
+// libMPSSE: 2-phase clocking at the given clock rate, and port D pins with the
+// given initial values and directions.
+func mpsseInit(info *deviceInfo, latency uint8, clock mpsseClock, val uint8, dir uint8) error {
+
+	if err := info.open(); nil != err {
+		return err
+	}
+	if err := _FT_SetBitMode(info, 0x00, 0x00); nil != err { // reset
+		return err
+	}
+	if err := _FT_SetBitMode(info, dir, mpsseMode); nil != err {
+		return err
+	}
+	if err := _FT_SetLatencyTimer(info, latency); nil != err {
+		return err
+	}
+	if err := _FT_SetTimeouts(info, mpsseTimeout, mpsseTimeout); nil != err {
+		return err
+	}
+	if err := _FT_Purge(info); nil != err {
+		return err
+	}
+
+	// verify the MPSSE engine is responding, and that the receive buffer is
+	// synchronized with our commands, by sending an invalid opcode.
+	if _, err := _FT_Write(info, []uint8{mpsseBadCommand}); nil != err {
+		return err
+	}
+	if r, err := _FT_Read(info, 2); nil != err {
+		return err
+	} else if mpsseBadCommandReply != r[0] || mpsseBadCommand != r[1] {
+		return fmt.Errorf("invalid MPSSE sync response: % 02X", r)
+	}
+
+	cmd := append(clock.cmd(),
+		mpsseDisableAdaptiveClock, mpsseDisable3PhaseClocking, mpsseLoopbackDisable,
+		mpsseSetDataBitsLowByte, val, dir)
+	_, err := _FT_Write(info, cmd)
+	return err
+}
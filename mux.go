@@ -0,0 +1,231 @@
+package ft232h
+
+import (
+	"fmt"
+)
+
+// Constants defining the I²C slave address range of TCA9548A/PCA954x I²C
+// multiplexers, selected with pins A2-A0.
+const (
+	I2CMuxAddrMin I2CAddr = 0x70
+	I2CMuxAddrMax I2CAddr = 0x77
+)
+
+// I2CMuxChannelsMax is the maximum number of downstream channels of an I²C
+// multiplexer (TCA9548A, PCA9548A).
+const I2CMuxChannelsMax = 8
+
+// I2CMux represents a TCA9548A/PCA954x I²C multiplexer (or switch), whose
+// downstream channels are enabled by writing a bitmask to its single control
+// register (one bit per channel). Compatible devices include the TCA9548A and
+// PCA9548A (8 channels), TCA9546A and PCA9546A (4 channels), and PCA9543A (2
+// channels).
+//
+// Each channel is presented as a virtual I²C bus (see Channel), which enables
+// only its own channel before each transfer. The value of the control register
+// is cached so that it is only written when a different channel is used.
+// If the multiplexer is reset, or its control register is written by some other
+// means, the cache must be discarded with Invalidate.
+type I2CMux struct {
+	bus      I2CBus  // upstream I²C bus
+	addr     I2CAddr // slave address of the multiplexer
+	channels uint    // number of downstream channels
+	sel      uint8   // cached value of the control register
+	cached   bool    // true if sel is the value of the control register
+}
+
+// String returns a descriptive string of an I2CMux.
+func (m *I2CMux) String() string {
+	sel := "?"
+	if m.cached {
+		sel = fmt.Sprintf("0x%02X", m.sel)
+	}
+	return fmt.Sprintf("{ Addr: %s, Channels: %d, Select: %s }",
+		m.addr, m.channels, sel)
+}
+
+// Mux returns an I2CMux for the multiplexer at the given slave address with the
+// given number of downstream channels.
+// The I²C interface must be initialized before transfer.
+func (i2c *I2C) Mux(addr I2CAddr, channels uint) (*I2CMux, error) {
+	return newI2CMux(i2c, addr, channels)
+}
+
+// newI2CMux returns an I2CMux for the multiplexer at the given slave address on
+// the given I²C bus.
+func newI2CMux(bus I2CBus, addr I2CAddr, channels uint) (*I2CMux, error) {
+	if addr < I2CMuxAddrMin || addr > I2CMuxAddrMax {
+		return nil, fmt.Errorf("invalid I²C multiplexer address: %s", addr)
+	}
+	if 0 == channels || channels > I2CMuxChannelsMax {
+		return nil, fmt.Errorf("invalid I²C multiplexer channels: %d", channels)
+	}
+	return &I2CMux{bus: bus, addr: addr, channels: channels}, nil
+}
+
+// Channels returns the number of downstream channels of the multiplexer.
+func (m *I2CMux) Channels() uint {
+	return m.channels
+}
+
+// Channel returns the virtual I²C bus of the given downstream channel, numbered
+// from 0.
+func (m *I2CMux) Channel(ch uint) (*I2CMuxChannel, error) {
+	if ch >= m.channels {
+		return nil, fmt.Errorf("invalid I²C multiplexer channel: %d", ch)
+	}
+	return &I2CMuxChannel{mux: m, ch: ch}, nil
+}
+
+// Select enables the downstream channels set in the given bitmask, and disables
+// all others. The control register is not written if it already holds the
+// given bitmask.
+func (m *I2CMux) Select(mask uint8) error {
+	if 0 != uint(mask)>>m.channels {
+		return fmt.Errorf("invalid I²C multiplexer channel mask: 0x%02X", mask)
+	}
+	if m.cached && mask == m.sel {
+		return nil
+	}
+	if _, err := m.bus.Write(m.addr, []uint8{mask}, true, true); nil != err {
+		m.cached = false
+		return err
+	}
+	m.sel, m.cached = mask, true
+	return nil
+}
+
+// Disable disables all downstream channels, isolating them from the upstream
+// bus.
+func (m *I2CMux) Disable() error {
+	return m.Select(0)
+}
+
+// Selected reads the control register of the multiplexer, returning the bitmask
+// of enabled downstream channels, and updates the cached value.
+func (m *I2CMux) Selected() (uint8, error) {
+	r, err := m.bus.Read(m.addr, 1, true, true)
+	if nil != err {
+		m.cached = false
+		return 0, err
+	}
+	m.sel, m.cached = r[0], true
+	return r[0], nil
+}
+
+// Invalidate discards the cached value of the control register, so that it is
+// written before the next transfer on any channel.
+func (m *I2CMux) Invalidate() {
+	m.cached = false
+}
+
+// I2CMuxChannel is a virtual I²C bus connected to a downstream channel of an
+// I²C multiplexer. It implements I2CBus, enabling its channel (and disabling
+// all others) before each transfer.
+type I2CMuxChannel struct {
+	mux *I2CMux
+	ch  uint
+}
+
+// String returns a descriptive string of an I2CMuxChannel.
+func (c *I2CMuxChannel) String() string {
+	return fmt.Sprintf("{ Mux: %s, Channel: %d }", c.mux.addr, c.ch)
+}
+
+// Channel returns the channel number of the virtual I²C bus.
+func (c *I2CMuxChannel) Channel() uint {
+	return c.ch
+}
+
+// enable enables the receiver's channel. If start is false, the transfer
+// continues a transaction in progress, which must already be on the receiver's
+// channel, since the control register cannot be written without interrupting
+// that transaction.
+func (c *I2CMuxChannel) enable(start bool) error {
+	mask := uint8(1) << c.ch
+	if !start && !(c.mux.cached && mask == c.mux.sel) {
+		return fmt.Errorf("invalid I²C multiplexer channel (transaction in progress): %d", c.ch)
+	}
+	return c.mux.Select(mask)
+}
+
+// Read reads count bytes from the given slave on the receiver's channel (see
+// I2C.Read).
+func (c *I2CMuxChannel) Read(slave I2CAddr, count uint, start bool, stop bool) ([]uint8, error) {
+	if err := c.enable(start); nil != err {
+		return nil, err
+	}
+	return c.mux.bus.Read(slave, count, start, stop)
+}
+
+// Write writes the given data to the given slave on the receiver's channel
+// (see I2C.Write).
+func (c *I2CMuxChannel) Write(slave I2CAddr, data []uint8, start bool, stop bool) (uint, error) {
+	if err := c.enable(start); nil != err {
+		return 0, err
+	}
+	return c.mux.bus.Write(slave, data, start, stop)
+}
+
+// Transfer performs the given messages as a single transaction on the
+// receiver's channel (see I2C.Transfer).
+func (c *I2CMuxChannel) Transfer(msgs []I2CMsg) error {
+	if 0 == len(msgs) {
+		return nil
+	}
+	if err := c.enable(true); nil != err {
+		return err
+	}
+	return c.mux.bus.Transfer(msgs)
+}
+
+// Tx performs a write-then-read transaction with the given slave on the
+// receiver's channel (see I2C.Tx).
+func (c *I2CMuxChannel) Tx(slave I2CAddr, w []uint8, r []uint8) error {
+	if err := c.enable(true); nil != err {
+		return err
+	}
+	return c.mux.bus.Tx(slave, w, r)
+}
+
+// Present returns true if a slave device on the receiver's channel acknowledges
+// the given address (see I2C.Present).
+func (c *I2CMuxChannel) Present(slave I2CAddr) (bool, error) {
+	if err := c.enable(true); nil != err {
+		return false, err
+	}
+	return c.mux.bus.Present(slave)
+}
+
+// Reg constructs a new I2CReg for a slave device on the receiver's channel.
+func (c *I2CMuxChannel) Reg(slave I2CAddr, addr uint, space AddrSpace, order ByteOrder) *I2CReg {
+	return newI2CReg(c, slave, addr, space, order)
+}
+
+// RegMap validates and binds the given register map to a slave device on the
+// receiver's channel.
+func (c *I2CMuxChannel) RegMap(slave I2CAddr, m *RegMap) (*I2CRegMap, error) {
+	return newI2CRegMap(c, slave, m)
+}
+
+// Mux returns an I2CMux for a multiplexer connected to the receiver's channel,
+// for cascaded multiplexers.
+func (c *I2CMuxChannel) Mux(addr I2CAddr, channels uint) (*I2CMux, error) {
+	return newI2CMux(c, addr, channels)
+}
+
+// SMBus returns an SMBus for the given 7-bit slave address on the receiver's
+// channel.
+func (c *I2CMuxChannel) SMBus(slave I2CAddr, pec bool) (*SMBus, error) {
+	return newSMBus(c, slave, pec)
+}
+
+// PMBus returns a PMBus for the given 7-bit slave address on the receiver's
+// channel.
+func (c *I2CMuxChannel) PMBus(slave I2CAddr, pec bool) (*PMBus, error) {
+	s, err := newSMBus(c, slave, pec)
+	if nil != err {
+		return nil, err
+	}
+	return newPMBus(s), nil
+}
@@ -0,0 +1,125 @@
+package ft232h
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// testI2CBus is an I2CBus that records the transfers written to it.
+type testI2CBus struct {
+	log  []string
+	fail bool
+}
+
+func (b *testI2CBus) Read(slave I2CAddr, count uint, start bool, stop bool) ([]uint8, error) {
+	b.log = append(b.log, fmt.Sprintf("R %s %d", slave, count))
+	return make([]uint8, count), nil
+}
+
+func (b *testI2CBus) Write(slave I2CAddr, data []uint8, start bool, stop bool) (uint, error) {
+	b.log = append(b.log, fmt.Sprintf("W %s %v", slave, data))
+	if b.fail {
+		return 0, errors.New("write failed")
+	}
+	return uint(len(data)), nil
+}
+
+func (b *testI2CBus) Transfer(msgs []I2CMsg) error {
+	for _, m := range msgs {
+		b.log = append(b.log, fmt.Sprintf("T %s %t %d", m.Addr, m.Read, len(m.Data)))
+	}
+	return nil
+}
+
+func (b *testI2CBus) Tx(slave I2CAddr, w []uint8, r []uint8) error {
+	b.log = append(b.log, fmt.Sprintf("X %s %v %d", slave, w, len(r)))
+	return nil
+}
+
+func (b *testI2CBus) Present(slave I2CAddr) (bool, error) {
+	return true, b.Tx(slave, nil, nil)
+}
+
+func (b *testI2CBus) Reg(slave I2CAddr, addr uint, space AddrSpace, order ByteOrder) *I2CReg {
+	return newI2CReg(b, slave, addr, space, order)
+}
+
+func (b *testI2CBus) RegMap(slave I2CAddr, m *RegMap) (*I2CRegMap, error) {
+	return newI2CRegMap(b, slave, m)
+}
+
+func TestI2CMux(t *testing.T) {
+
+	for _, test := range []struct {
+		addr     I2CAddr
+		channels uint
+		valid    bool
+	}{
+		{addr: 0x70, channels: 8, valid: true},
+		{addr: 0x77, channels: 2, valid: true},
+		{addr: 0x6F, channels: 8, valid: false},
+		{addr: 0x78, channels: 8, valid: false},
+		{addr: 0x70, channels: 0, valid: false},
+		{addr: 0x70, channels: 9, valid: false},
+	} {
+		if _, err := newI2CMux(&testI2CBus{}, test.addr, test.channels); test.valid != (nil == err) {
+			t.Fatalf("unexpected result: %s, %d: %v", test.addr, test.channels, err)
+		}
+	}
+
+	bus := &testI2CBus{}
+	mux, err := newI2CMux(bus, 0x70, 4)
+	if nil != err {
+		t.Fatalf("newI2CMux(): %v", err)
+	}
+	if _, err := mux.Channel(4); nil == err {
+		t.Fatalf("Channel(4): expected error")
+	}
+	ch0, _ := mux.Channel(0)
+	ch2, _ := mux.Channel(2)
+
+	if _, err := ch0.Read(0x40, 1, false, true); nil == err {
+		t.Fatalf("Read(): expected error switching channel within transaction")
+	}
+	if err := ch0.Tx(0x40, []uint8{0x01}, make([]uint8, 2)); nil != err {
+		t.Fatalf("Tx(): %v", err)
+	}
+	if _, err := ch0.Reg(0x40, 0x02, Addr8Bit, MSB).Update(2, 0xFF, 0x12); nil != err {
+		t.Fatalf("Update(): %v", err)
+	}
+	if _, err := ch0.Read(0x40, 1, false, true); nil != err {
+		t.Fatalf("Read(): %v", err)
+	}
+	if ok, err := ch2.Present(0x40); !ok || nil != err {
+		t.Fatalf("Present(): %t, %v", ok, err)
+	}
+	mux.Invalidate()
+	if err := ch2.Transfer([]I2CMsg{{Addr: 0x40}}); nil != err {
+		t.Fatalf("Transfer(): %v", err)
+	}
+
+	expect := []string{
+		"W 0x70 [1]",
+		"X 0x40 [1] 2",
+		"X 0x40 [2] 2",
+		"W 0x40 [2 0 18]",
+		"R 0x40 1",
+		"W 0x70 [4]",
+		"X 0x40 [] 0",
+		"W 0x70 [4]",
+		"T 0x40 false 0",
+	}
+	if !reflect.DeepEqual(expect, bus.log) {
+		t.Fatalf("unexpected transfers:\n%q\n%q", bus.log, expect)
+	}
+
+	bus.fail = true
+	if err := ch0.Tx(0x40, nil, nil); nil == err {
+		t.Fatalf("Tx(): expected error")
+	}
+	if mux.cached {
+		t.Fatalf("cached selection after error")
+	}
+}
@@ -13,6 +13,8 @@ package ft232h
 // #include "stdlib.h"
 import "C"
 
+import "fmt"
+
 // Type aliases for the native types needed by the C libraries.
 type (
 	Handle C.FT_HANDLE
@@ -168,6 +170,9 @@ const (
 	ModeNone Mode = 0
 	ModeSPI  Mode = 1
 	ModeI2C  Mode = 2
+	ModeUART Mode = 3
+	ModeJTAG Mode = 4
+	ModeSWD  Mode = 5
 )
 
 // String returns a string describing the legacy protocol supported by MPSSE.
@@ -180,6 +185,12 @@ func (m Mode) String() string {
 		return "SPI"
 	case ModeI2C:
 		return "I²C"
+	case ModeUART:
+		return "UART"
+	case ModeJTAG:
+		return "JTAG"
+	case ModeSWD:
+		return "SWD"
 	default:
 		return "(invalid mode)"
 	}
@@ -248,6 +259,66 @@ func _FT_Close(info *deviceInfo) error {
 	return nil
 }
 
+// _FT_Write writes the given slice of uint8 data directly to the USB device,
+// bypassing libMPSSE, using the D2XX driver. This is used to send raw command
+// sequences to the MPSSE engine. Returns the number of bytes successfully
+// written, and a non-nil error if unsuccessful.
+func _FT_Write(info *deviceInfo, data []uint8) (uint, error) {
+	if 0 == len(data) {
+		return 0, nil
+	}
+	var sent C.DWORD
+	stat := Status(C.FT_Write(C.PVOID(info.handle), C.LPVOID(&data[0]),
+		C.DWORD(len(data)), &sent))
+	if !stat.OK() {
+		return uint(sent), stat
+	}
+	return uint(sent), nil
+}
+
+// _FT_Read reads the given count number of bytes directly from the USB device,
+// bypassing libMPSSE, using the D2XX driver. This is used to receive responses
+// to raw command sequences sent to the MPSSE engine. Returns the slice of bytes
+// successfully read, and a non-nil error if unsuccessful.
+func _FT_Read(info *deviceInfo, count uint) ([]uint8, error) {
+	data, err := _FT_ReadTimeout(info, count)
+	if nil != err {
+		return data, err
+	}
+	if uint(len(data)) < count {
+		return data, fmt.Errorf("read timeout: %d of %d bytes", len(data), count)
+	}
+	return data, nil
+}
+
+// _FT_ReadTimeout reads up to the given count number of bytes directly from the
+// USB device using the D2XX driver, returning fewer bytes (without error) if the
+// read timeout configured with _FT_SetTimeouts expires first. Returns the slice
+// of bytes successfully read, and a non-nil error if unsuccessful.
+func _FT_ReadTimeout(info *deviceInfo, count uint) ([]uint8, error) {
+	if 0 == count {
+		return []uint8{}, nil
+	}
+	var recv C.DWORD
+	data := make([]uint8, count)
+	stat := Status(C.FT_Read(C.PVOID(info.handle), C.LPVOID(&data[0]),
+		C.DWORD(count), &recv))
+	if !stat.OK() {
+		return data[:recv], stat
+	}
+	return data[:recv], nil
+}
+
+// _FT_Purge discards all data in the USB receive and transmit buffers of the
+// device using the D2XX driver, returning a non-nil error if unsuccessful.
+func _FT_Purge(info *deviceInfo) error {
+	stat := Status(C.FT_Purge(C.PVOID(info.handle), C.FT_PURGE_RX|C.FT_PURGE_TX))
+	if !stat.OK() {
+		return stat
+	}
+	return nil
+}
+
 // _FT_WriteGPIO sets the level val and direction dir for all pins on port "C"
 // of the FT232H using the D2XX driver, returns a non-nil error if the driver
 // could not set the pin configuration.
@@ -270,6 +341,158 @@ func _FT_ReadGPIO(gpio *GPIO) (uint8, error) {
 	return uint8(val), nil
 }
 
+// _FT_SetBitMode sets the bit mode of the USB device using the D2XX driver,
+// where mode 0 resets the device to its default (UART) mode, with the given
+// pin direction mask. Returns a non-nil error if unsuccessful.
+func _FT_SetBitMode(info *deviceInfo, mask uint8, mode uint8) error {
+	stat := Status(C.FT_SetBitMode(C.PVOID(info.handle), C.UCHAR(mask), C.UCHAR(mode)))
+	if !stat.OK() {
+		return stat
+	}
+	return nil
+}
+
+// _FT_SetLatencyTimer sets the USB receive buffer latency timer (in ms) of the
+// device using the D2XX driver, returning a non-nil error if unsuccessful.
+func _FT_SetLatencyTimer(info *deviceInfo, latency uint8) error {
+	stat := Status(C.FT_SetLatencyTimer(C.PVOID(info.handle), C.UCHAR(latency)))
+	if !stat.OK() {
+		return stat
+	}
+	return nil
+}
+
+// _FT_SetTimeouts sets the read and write timeouts (in ms) of the device using
+// the D2XX driver, where 0 waits indefinitely. Returns a non-nil error if
+// unsuccessful.
+func _FT_SetTimeouts(info *deviceInfo, read uint32, write uint32) error {
+	stat := Status(C.FT_SetTimeouts(C.PVOID(info.handle), C.ULONG(read), C.ULONG(write)))
+	if !stat.OK() {
+		return stat
+	}
+	return nil
+}
+
+// _FT_GetQueueStatus returns the number of bytes in the receive queue of the
+// device using the D2XX driver, and a non-nil error if unsuccessful.
+func _FT_GetQueueStatus(info *deviceInfo) (uint, error) {
+	var n C.DWORD
+	stat := Status(C.FT_GetQueueStatus(C.PVOID(info.handle), &n))
+	if !stat.OK() {
+		return 0, stat
+	}
+	return uint(n), nil
+}
+
+// _UART_Init configures the device for asynchronous serial (UART) mode with the
+// configuration defined in the given uart using the D2XX driver.
+// If the FT232H device is already opened in any mode (including UART), the
+// interface is first closed before re-opening with the new configuration.
+// Returns a non-nil error if the interface could not be closed or (re)opened.
+func _UART_Init(uart *UART) error {
+
+	// close any open channels before trying to init
+	if err := uart.device.Close(); nil != err {
+		return err
+	}
+	if err := uart.device.info.open(); nil != err {
+		return err
+	}
+
+	cfg := uart.config
+	info := uart.device.info
+
+	if err := _FT_SetBitMode(info, 0x00, 0x00); nil != err { // reset to UART
+		return err
+	}
+	if err := _FT_Purge(info); nil != err {
+		return err
+	}
+
+	stat := Status(C.FT_SetBaudRate(C.PVOID(info.handle), C.ULONG(cfg.Baud)))
+	if !stat.OK() {
+		return stat
+	}
+
+	stop := C.UCHAR(C.FT_STOP_BITS_1)
+	if 2 == cfg.StopBits {
+		stop = C.FT_STOP_BITS_2
+	}
+	stat = Status(C.FT_SetDataCharacteristics(C.PVOID(info.handle),
+		C.UCHAR(cfg.DataBits), stop, C.UCHAR(cfg.Parity)))
+	if !stat.OK() {
+		return stat
+	}
+
+	stat = Status(C.FT_SetFlowControl(C.PVOID(info.handle),
+		C.USHORT(cfg.Flow), C.UCHAR(cfg.XOn), C.UCHAR(cfg.XOff)))
+	if !stat.OK() {
+		return stat
+	}
+
+	if err := _FT_SetLatencyTimer(info, cfg.Latency); nil != err {
+		return err
+	}
+
+	return _FT_SetTimeouts(info, millis(cfg.ReadTimeout), millis(cfg.WriteTimeout))
+}
+
+// _UART_SetDTR asserts (if set is true) or de-asserts the DTR output of the
+// device using the D2XX driver, returning a non-nil error if unsuccessful.
+func _UART_SetDTR(uart *UART, set bool) error {
+	var stat Status
+	if set {
+		stat = Status(C.FT_SetDtr(C.PVOID(uart.device.info.handle)))
+	} else {
+		stat = Status(C.FT_ClrDtr(C.PVOID(uart.device.info.handle)))
+	}
+	if !stat.OK() {
+		return stat
+	}
+	return nil
+}
+
+// _UART_SetRTS asserts (if set is true) or de-asserts the RTS output of the
+// device using the D2XX driver, returning a non-nil error if unsuccessful.
+func _UART_SetRTS(uart *UART, set bool) error {
+	var stat Status
+	if set {
+		stat = Status(C.FT_SetRts(C.PVOID(uart.device.info.handle)))
+	} else {
+		stat = Status(C.FT_ClrRts(C.PVOID(uart.device.info.handle)))
+	}
+	if !stat.OK() {
+		return stat
+	}
+	return nil
+}
+
+// _UART_SetBreak starts (if on is true) or stops sending a break condition on
+// the TXD output of the device using the D2XX driver, returning a non-nil error
+// if unsuccessful.
+func _UART_SetBreak(uart *UART, on bool) error {
+	var stat Status
+	if on {
+		stat = Status(C.FT_SetBreakOn(C.PVOID(uart.device.info.handle)))
+	} else {
+		stat = Status(C.FT_SetBreakOff(C.PVOID(uart.device.info.handle)))
+	}
+	if !stat.OK() {
+		return stat
+	}
+	return nil
+}
+
+// _UART_GetModemStatus reads the modem and line status of the device using the
+// D2XX driver, returning 0 and a non-nil error if unsuccessful.
+func _UART_GetModemStatus(uart *UART) (UARTStatus, error) {
+	var stat C.ULONG
+	if s := Status(C.FT_GetModemStatus(C.PVOID(uart.device.info.handle), &stat)); !s.OK() {
+		return 0, s
+	}
+	return UARTStatus(stat & 0xFFFF), nil
+}
+
 // _SPI_InitChannel initializes the MPSSE engine in SPI master mode with the
 // configuration defined in the given spi using the libMPSSE driver.
 // If the FT232H device is already opened in any mode (including SPI), the
@@ -301,6 +524,13 @@ func _SPI_InitChannel(spi *SPI) error {
 		return stat
 	}
 
+	// libMPSSE computes its own clock divisor from the given clock rate, which
+	// overshoots rates that cannot be generated exactly. overwrite it with the
+	// divisor selected by our configured rounding policy.
+	if _, err := _FT_Write(spi.device.info, spi.config.clock.cmd()); nil != err {
+		return err
+	}
+
 	return nil
 }
 
@@ -511,6 +741,13 @@ func _I2C_InitChannel(i2c *I2C) error {
 		return stat
 	}
 
+	// libMPSSE computes its own clock divisor from the given clock rate, which
+	// overshoots rates that cannot be generated exactly. overwrite it with the
+	// divisor selected by our configured rounding policy.
+	if _, err := _FT_Write(i2c.device.info, i2c.config.clock.cmd()); nil != err {
+		return err
+	}
+
 	return nil
 }
 
@@ -629,3 +866,41 @@ func _I2C_Write(i2c *I2C, addr uint, data []uint8, opt i2cXferOption) (uint, err
 
 	return uint(dataLen), nil
 }
+
+// _I2C_Probe checks for the presence of an I²C slave device at the given 7-bit
+// slave address using the libMPSSE driver with the given open I²C interface.
+// If read is true, a single byte is read from the slave (and NACKed). Otherwise,
+// the address is written with no data (SMBus "quick write"). In both cases,
+// start and stop conditions are generated, and fast transfers are not used so
+// that the address acknowledgement is checked.
+// Returns true if the slave acknowledged its address, and a non-nil error if
+// the probe failed for any other reason.
+func _I2C_Probe(i2c *I2C, addr uint, read bool) (bool, error) {
+
+	var (
+		sent C.uint32
+		stat Status
+		data [1]uint8
+	)
+
+	opt := i2cStartBit | i2cStopBit
+
+	if read {
+		stat = Status(C.I2C_DeviceRead(C.PVOID(i2c.device.info.handle),
+			C.uint32(addr), C.uint32(1), (*C.uint8)(&data[0]), &sent,
+			C.uint32(opt|i2cLastReadNACK)))
+	} else {
+		stat = Status(C.I2C_DeviceWrite(C.PVOID(i2c.device.info.handle),
+			C.uint32(addr), C.uint32(0), (*C.uint8)(&data[0]), &sent,
+			C.uint32(opt)))
+	}
+
+	switch stat {
+	case SOK:
+		return true, nil
+	case SDeviceNotFound:
+		return false, nil
+	default:
+		return false, stat
+	}
+}
@@ -0,0 +1,498 @@
+package ft232h
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// PMBusCmd represents a PMBus command code.
+type PMBusCmd uint8
+
+// Constants defining the standard PMBus command codes (PMBus 1.3, part II).
+const (
+	PMBusPage              PMBusCmd = 0x00
+	PMBusOperation         PMBusCmd = 0x01
+	PMBusOnOffConfig       PMBusCmd = 0x02
+	PMBusClearFaults       PMBusCmd = 0x03
+	PMBusPhase             PMBusCmd = 0x04
+	PMBusWriteProtect      PMBusCmd = 0x10
+	PMBusStoreDefaultAll   PMBusCmd = 0x11
+	PMBusRestoreDefaultAll PMBusCmd = 0x12
+	PMBusCapability        PMBusCmd = 0x19
+	PMBusVoutMode          PMBusCmd = 0x20
+	PMBusVoutCommand       PMBusCmd = 0x21
+	PMBusVoutTrim          PMBusCmd = 0x22
+	PMBusVoutCalOffset     PMBusCmd = 0x23
+	PMBusVoutMax           PMBusCmd = 0x24
+	PMBusVoutMarginHigh    PMBusCmd = 0x25
+	PMBusVoutMarginLow     PMBusCmd = 0x26
+	PMBusVoutTransition    PMBusCmd = 0x27
+	PMBusCoefficients      PMBusCmd = 0x30
+	PMBusPoutMax           PMBusCmd = 0x31
+	PMBusVinOn             PMBusCmd = 0x35
+	PMBusVinOff            PMBusCmd = 0x36
+	PMBusIoutCalGain       PMBusCmd = 0x38
+	PMBusIoutCalOffset     PMBusCmd = 0x39
+	PMBusVoutOVFaultLimit  PMBusCmd = 0x40
+	PMBusVoutOVWarnLimit   PMBusCmd = 0x42
+	PMBusVoutUVWarnLimit   PMBusCmd = 0x43
+	PMBusVoutUVFaultLimit  PMBusCmd = 0x44
+	PMBusIoutOCFaultLimit  PMBusCmd = 0x46
+	PMBusIoutOCWarnLimit   PMBusCmd = 0x4A
+	PMBusOTFaultLimit      PMBusCmd = 0x4F
+	PMBusOTWarnLimit       PMBusCmd = 0x51
+	PMBusVinOVFaultLimit   PMBusCmd = 0x55
+	PMBusVinOVWarnLimit    PMBusCmd = 0x57
+	PMBusVinUVWarnLimit    PMBusCmd = 0x58
+	PMBusVinUVFaultLimit   PMBusCmd = 0x59
+	PMBusPowerGoodOn       PMBusCmd = 0x5E
+	PMBusPowerGoodOff      PMBusCmd = 0x5F
+	PMBusStatusByte        PMBusCmd = 0x78
+	PMBusStatusWord        PMBusCmd = 0x79
+	PMBusStatusVout        PMBusCmd = 0x7A
+	PMBusStatusIout        PMBusCmd = 0x7B
+	PMBusStatusInput       PMBusCmd = 0x7C
+	PMBusStatusTemperature PMBusCmd = 0x7D
+	PMBusStatusCML         PMBusCmd = 0x7E
+	PMBusStatusOther       PMBusCmd = 0x7F
+	PMBusStatusMfrSpecific PMBusCmd = 0x80
+	PMBusStatusFans12      PMBusCmd = 0x81
+	PMBusReadEin           PMBusCmd = 0x86
+	PMBusReadEout          PMBusCmd = 0x87
+	PMBusReadVin           PMBusCmd = 0x88
+	PMBusReadIin           PMBusCmd = 0x89
+	PMBusReadVcap          PMBusCmd = 0x8A
+	PMBusReadVout          PMBusCmd = 0x8B
+	PMBusReadIout          PMBusCmd = 0x8C
+	PMBusReadTemperature1  PMBusCmd = 0x8D
+	PMBusReadTemperature2  PMBusCmd = 0x8E
+	PMBusReadTemperature3  PMBusCmd = 0x8F
+	PMBusReadFanSpeed1     PMBusCmd = 0x90
+	PMBusReadFanSpeed2     PMBusCmd = 0x91
+	PMBusReadDutyCycle     PMBusCmd = 0x94
+	PMBusReadFrequency     PMBusCmd = 0x95
+	PMBusReadPout          PMBusCmd = 0x96
+	PMBusReadPin           PMBusCmd = 0x97
+	PMBusRevision          PMBusCmd = 0x98
+	PMBusMfrID             PMBusCmd = 0x99
+	PMBusMfrModel          PMBusCmd = 0x9A
+	PMBusMfrRevision       PMBusCmd = 0x9B
+)
+
+var pmbusCmdName = map[PMBusCmd]string{
+	PMBusPage: "PAGE", PMBusOperation: "OPERATION", PMBusOnOffConfig: "ON_OFF_CONFIG",
+	PMBusClearFaults: "CLEAR_FAULTS", PMBusPhase: "PHASE",
+	PMBusWriteProtect: "WRITE_PROTECT", PMBusStoreDefaultAll: "STORE_DEFAULT_ALL",
+	PMBusRestoreDefaultAll: "RESTORE_DEFAULT_ALL", PMBusCapability: "CAPABILITY",
+	PMBusVoutMode: "VOUT_MODE", PMBusVoutCommand: "VOUT_COMMAND",
+	PMBusVoutTrim: "VOUT_TRIM", PMBusVoutCalOffset: "VOUT_CAL_OFFSET",
+	PMBusVoutMax: "VOUT_MAX", PMBusVoutMarginHigh: "VOUT_MARGIN_HIGH",
+	PMBusVoutMarginLow: "VOUT_MARGIN_LOW", PMBusVoutTransition: "VOUT_TRANSITION_RATE",
+	PMBusCoefficients: "COEFFICIENTS", PMBusPoutMax: "POUT_MAX",
+	PMBusVinOn: "VIN_ON", PMBusVinOff: "VIN_OFF",
+	PMBusIoutCalGain: "IOUT_CAL_GAIN", PMBusIoutCalOffset: "IOUT_CAL_OFFSET",
+	PMBusVoutOVFaultLimit: "VOUT_OV_FAULT_LIMIT", PMBusVoutOVWarnLimit: "VOUT_OV_WARN_LIMIT",
+	PMBusVoutUVWarnLimit: "VOUT_UV_WARN_LIMIT", PMBusVoutUVFaultLimit: "VOUT_UV_FAULT_LIMIT",
+	PMBusIoutOCFaultLimit: "IOUT_OC_FAULT_LIMIT", PMBusIoutOCWarnLimit: "IOUT_OC_WARN_LIMIT",
+	PMBusOTFaultLimit: "OT_FAULT_LIMIT", PMBusOTWarnLimit: "OT_WARN_LIMIT",
+	PMBusVinOVFaultLimit: "VIN_OV_FAULT_LIMIT", PMBusVinOVWarnLimit: "VIN_OV_WARN_LIMIT",
+	PMBusVinUVWarnLimit: "VIN_UV_WARN_LIMIT", PMBusVinUVFaultLimit: "VIN_UV_FAULT_LIMIT",
+	PMBusPowerGoodOn: "POWER_GOOD_ON", PMBusPowerGoodOff: "POWER_GOOD_OFF",
+	PMBusStatusByte: "STATUS_BYTE", PMBusStatusWord: "STATUS_WORD",
+	PMBusStatusVout: "STATUS_VOUT", PMBusStatusIout: "STATUS_IOUT",
+	PMBusStatusInput: "STATUS_INPUT", PMBusStatusTemperature: "STATUS_TEMPERATURE",
+	PMBusStatusCML: "STATUS_CML", PMBusStatusOther: "STATUS_OTHER",
+	PMBusStatusMfrSpecific: "STATUS_MFR_SPECIFIC", PMBusStatusFans12: "STATUS_FANS_1_2",
+	PMBusReadEin: "READ_EIN", PMBusReadEout: "READ_EOUT",
+	PMBusReadVin: "READ_VIN", PMBusReadIin: "READ_IIN", PMBusReadVcap: "READ_VCAP",
+	PMBusReadVout: "READ_VOUT", PMBusReadIout: "READ_IOUT",
+	PMBusReadTemperature1: "READ_TEMPERATURE_1", PMBusReadTemperature2: "READ_TEMPERATURE_2",
+	PMBusReadTemperature3: "READ_TEMPERATURE_3",
+	PMBusReadFanSpeed1:    "READ_FAN_SPEED_1", PMBusReadFanSpeed2: "READ_FAN_SPEED_2",
+	PMBusReadDutyCycle: "READ_DUTY_CYCLE", PMBusReadFrequency: "READ_FREQUENCY",
+	PMBusReadPout: "READ_POUT", PMBusReadPin: "READ_PIN",
+	PMBusRevision: "PMBUS_REVISION", PMBusMfrID: "MFR_ID",
+	PMBusMfrModel: "MFR_MODEL", PMBusMfrRevision: "MFR_REVISION",
+}
+
+// String returns the name of a PMBus command code.
+func (c PMBusCmd) String() string {
+	if s, ok := pmbusCmdName[c]; ok {
+		return s
+	}
+	return fmt.Sprintf("0x%02X", uint8(c))
+}
+
+// vout returns true if the command's data is an output voltage, formatted
+// according to VOUT_MODE instead of LINEAR11.
+func (c PMBusCmd) vout() bool {
+	switch c {
+	case PMBusVoutCommand, PMBusVoutTrim, PMBusVoutCalOffset, PMBusVoutMax,
+		PMBusVoutMarginHigh, PMBusVoutMarginLow, PMBusVoutOVFaultLimit,
+		PMBusVoutOVWarnLimit, PMBusVoutUVWarnLimit, PMBusVoutUVFaultLimit,
+		PMBusPowerGoodOn, PMBusPowerGoodOff, PMBusReadVout:
+		return true
+	}
+	return false
+}
+
+// pmbusLinear11Exp are the bounds of the signed 5-bit exponent N, and
+// pmbusLinear11Mant the bounds of the signed 11-bit mantissa Y, of a LINEAR11
+// value.
+const (
+	pmbusLinear11ExpMin  = -16
+	pmbusLinear11ExpMax  = 15
+	pmbusLinear11MantMin = -1024
+	pmbusLinear11MantMax = 1023
+)
+
+// signExtend returns the signed value of the given value v with the given
+// number of bits.
+func signExtend(v uint16, bits uint) int {
+	s := 16 - bits
+	return int(int16(v<<s) >> s)
+}
+
+// PMBusLinear11 decodes the given LINEAR11 value Y·2ᴺ, where N is the signed
+// 5-bit exponent (bits 15-11) and Y the signed 11-bit mantissa (bits 10-0).
+func PMBusLinear11(v uint16) float64 {
+	return math.Ldexp(float64(signExtend(v&0x07FF, 11)), signExtend(v>>11, 5))
+}
+
+// PMBusToLinear11 encodes the given value as LINEAR11 with the greatest
+// precision possible.
+func PMBusToLinear11(x float64) (uint16, error) {
+	for n := pmbusLinear11ExpMin; n <= pmbusLinear11ExpMax; n++ {
+		y := math.Round(math.Ldexp(x, -n))
+		if y >= pmbusLinear11MantMin && y <= pmbusLinear11MantMax {
+			return uint16(n&0x1F)<<11 | uint16(int(y)&0x07FF), nil
+		}
+	}
+	return 0, fmt.Errorf("value out of LINEAR11 range: %g", x)
+}
+
+// PMBusMode represents the VOUT_MODE of a PMBus device, defining the data
+// format of output voltage commands.
+type PMBusMode uint8
+
+// Constants defining the data formats of VOUT_MODE (bits 7-5).
+const (
+	PMBusModeLinear PMBusMode = 0x00 // LINEAR16
+	PMBusModeVID    PMBusMode = 0x20 // VID code
+	PMBusModeDirect PMBusMode = 0x40 // DIRECT
+	PMBusModeIEEE   PMBusMode = 0x60 // IEEE 754 half precision
+)
+
+// Mode returns the data format of VOUT_MODE.
+func (m PMBusMode) Mode() PMBusMode { return m & 0xE0 }
+
+// Exponent returns the signed 5-bit LINEAR16 exponent N (bits 4-0).
+func (m PMBusMode) Exponent() int { return signExtend(uint16(m&0x1F), 5) }
+
+// String returns a descriptive string of a PMBusMode.
+func (m PMBusMode) String() string {
+	switch m.Mode() {
+	case PMBusModeLinear:
+		return fmt.Sprintf("LINEAR16 (N=%d)", m.Exponent())
+	case PMBusModeVID:
+		return fmt.Sprintf("VID (code=0x%02X)", uint8(m&0x1F))
+	case PMBusModeDirect:
+		return "DIRECT"
+	case PMBusModeIEEE:
+		return "IEEE half"
+	default:
+		return fmt.Sprintf("invalid VOUT_MODE (0x%02X)", uint8(m))
+	}
+}
+
+// Linear16 decodes the given unsigned LINEAR16 mantissa V·2ᴺ using the exponent
+// of VOUT_MODE.
+func (m PMBusMode) Linear16(v uint16) float64 {
+	return math.Ldexp(float64(v), m.Exponent())
+}
+
+// ToLinear16 encodes the given value as a LINEAR16 mantissa using the exponent
+// of VOUT_MODE.
+func (m PMBusMode) ToLinear16(x float64) (uint16, error) {
+	v := math.Round(math.Ldexp(x, -m.Exponent()))
+	if v < 0 || v > math.MaxUint16 {
+		return 0, fmt.Errorf("value out of LINEAR16 range: %g", x)
+	}
+	return uint16(v), nil
+}
+
+// PMBusDirect holds the coefficients of the DIRECT data format, in which the
+// value X is encoded as the signed 16-bit integer Y = (M·X + B)·10ᴿ.
+type PMBusDirect struct {
+	M int16 // slope
+	B int16 // offset
+	R int8  // exponent
+}
+
+// Decode decodes the given DIRECT value.
+func (d PMBusDirect) Decode(v uint16) float64 {
+	return (float64(int16(v))*math.Pow10(-int(d.R)) - float64(d.B)) / float64(d.M)
+}
+
+// Encode encodes the given value as DIRECT.
+func (d PMBusDirect) Encode(x float64) (uint16, error) {
+	y := math.Round((float64(d.M)*x + float64(d.B)) * math.Pow10(int(d.R)))
+	if y < math.MinInt16 || y > math.MaxInt16 {
+		return 0, fmt.Errorf("value out of DIRECT range: %g", x)
+	}
+	return uint16(int16(y)), nil
+}
+
+// PMBusStatus represents the STATUS_WORD of a PMBus device, whose low byte is
+// STATUS_BYTE.
+type PMBusStatus uint16
+
+// PMBusStatusBit identifies a single bit of STATUS_WORD (see PMBusStatus.Has).
+type PMBusStatusBit uint16
+
+// Constants defining the bits of STATUS_WORD.
+const (
+	PMBusStatusBitNoneOfTheAbove PMBusStatusBit = 1 << iota
+	PMBusStatusBitCML
+	PMBusStatusBitTemperature
+	PMBusStatusBitVinUV
+	PMBusStatusBitIoutOC
+	PMBusStatusBitVoutOV
+	PMBusStatusBitOff
+	PMBusStatusBitBusy
+	PMBusStatusBitUnknown
+	PMBusStatusBitOther
+	PMBusStatusBitFans
+	PMBusStatusBitPowerGoodNegated
+	PMBusStatusBitMfr
+	PMBusStatusBitInput
+	PMBusStatusBitIoutPout
+	PMBusStatusBitVout
+)
+
+var pmbusStatusName = [...]string{
+	"NONE_OF_THE_ABOVE", "CML", "TEMPERATURE", "VIN_UV", "IOUT_OC", "VOUT_OV",
+	"OFF", "BUSY", "UNKNOWN", "OTHER", "FANS", "POWER_GOOD#", "MFR", "INPUT",
+	"IOUT/POUT", "VOUT",
+}
+
+// String returns the name of a STATUS_WORD bit.
+func (b PMBusStatusBit) String() string {
+	for i, name := range pmbusStatusName {
+		if PMBusStatusBit(1<<uint(i)) == b {
+			return name
+		}
+	}
+	return fmt.Sprintf("invalid STATUS_WORD bit (0x%04X)", uint16(b))
+}
+
+// Has returns true if the given bit of STATUS_WORD is set.
+func (s PMBusStatus) Has(b PMBusStatusBit) bool { return 0 != uint16(s)&uint16(b) }
+
+// String returns the names of all bits set in STATUS_WORD.
+func (s PMBusStatus) String() string {
+	var set []string
+	for i, name := range pmbusStatusName {
+		if s.Has(PMBusStatusBit(1 << uint(i))) {
+			set = append(set, name)
+		}
+	}
+	return fmt.Sprintf("0x%04X [%s]", uint16(s), strings.Join(set, " "))
+}
+
+// PMBus performs PMBus transactions with a single power management device using
+// the SMBus transport (see SMBus).
+// Numeric commands are encoded and decoded as LINEAR11, except output voltage
+// commands, which use the format of VOUT_MODE. If VOUT_MODE is DIRECT, the
+// coefficients of each output voltage command are read from the device (see
+// Coefficients) separately for reading and writing. Devices using the DIRECT
+// format for any other command must specify its coefficients in Direct, which
+// also overrides those read from the device.
+type PMBus struct {
+	*SMBus
+	Direct map[PMBusCmd]PMBusDirect  // coefficients of commands using DIRECT
+	mode   *PMBusMode                // cached VOUT_MODE
+	coef   map[pmbusCoef]PMBusDirect // cached output voltage coefficients
+}
+
+// pmbusCoef identifies the DIRECT coefficients of a command for reading (if read
+// is true) or writing.
+type pmbusCoef struct {
+	cmd  PMBusCmd
+	read bool
+}
+
+// PMBus returns a PMBus for the given 7-bit slave address.
+// The I²C interface must be initialized before transfer.
+func (i2c *I2C) PMBus(slave I2CAddr, pec bool) (*PMBus, error) {
+	s, err := i2c.SMBus(slave, pec)
+	if nil != err {
+		return nil, err
+	}
+	return newPMBus(s), nil
+}
+
+// newPMBus returns a PMBus using the given SMBus.
+func newPMBus(s *SMBus) *PMBus {
+	return &PMBus{SMBus: s, Direct: map[PMBusCmd]PMBusDirect{},
+		coef: map[pmbusCoef]PMBusDirect{}}
+}
+
+// SetPage selects the given page (output channel) of a multi-page device, for
+// all subsequent commands.
+func (p *PMBus) SetPage(page uint8) error {
+	// VOUT_MODE and coefficients may differ per page
+	p.mode = nil
+	p.coef = map[pmbusCoef]PMBusDirect{}
+	return p.WriteByteData(uint8(PMBusPage), page)
+}
+
+// ClearFaults clears all fault and warning bits of the status registers.
+func (p *PMBus) ClearFaults() error {
+	return p.SendByte(uint8(PMBusClearFaults))
+}
+
+// VoutMode reads VOUT_MODE, which is cached until the page is changed.
+func (p *PMBus) VoutMode() (PMBusMode, error) {
+	if nil != p.mode {
+		return *p.mode, nil
+	}
+	b, err := p.ReadByteData(uint8(PMBusVoutMode))
+	if nil != err {
+		return 0, err
+	}
+	mode := PMBusMode(b)
+	p.mode = &mode
+	return mode, nil
+}
+
+// Coefficients reads the DIRECT coefficients of the given command for reading
+// (if read is true) or writing, using the COEFFICIENTS command.
+func (p *PMBus) Coefficients(cmd PMBusCmd, read bool) (PMBusDirect, error) {
+	rw := uint8(0)
+	if read {
+		rw = 1
+	}
+	r, err := p.BlockProcessCall(uint8(PMBusCoefficients), []uint8{uint8(cmd), rw})
+	if nil != err {
+		return PMBusDirect{}, err
+	}
+	if 5 != len(r) {
+		return PMBusDirect{}, fmt.Errorf("invalid COEFFICIENTS length: %d", len(r))
+	}
+	return PMBusDirect{
+		M: int16(LSB.Uint(2, r[0:2])),
+		B: int16(LSB.Uint(2, r[2:4])),
+		R: int8(r[4]),
+	}, nil
+}
+
+// direct returns the DIRECT coefficients of the given command for reading (if
+// read is true) or writing, if any.
+func (p *PMBus) direct(cmd PMBusCmd, read bool) (PMBusDirect, bool, error) {
+	if d, ok := p.Direct[cmd]; ok {
+		return d, true, nil
+	}
+	if !cmd.vout() {
+		return PMBusDirect{}, false, nil
+	}
+	mode, err := p.VoutMode()
+	if nil != err || PMBusModeDirect != mode.Mode() {
+		return PMBusDirect{}, false, err
+	}
+	key := pmbusCoef{cmd: cmd, read: read}
+	if d, ok := p.coef[key]; ok {
+		return d, true, nil
+	}
+	d, err := p.Coefficients(cmd, read)
+	if nil != err {
+		return PMBusDirect{}, false, err
+	}
+	if nil == p.coef {
+		p.coef = map[pmbusCoef]PMBusDirect{}
+	}
+	p.coef[key] = d
+	return d, true, nil
+}
+
+// Read reads the given numeric command, returning its value in engineering
+// units (volts, amperes, watts, degrees Celsius, etc.).
+func (p *PMBus) Read(cmd PMBusCmd) (float64, error) {
+
+	d, direct, err := p.direct(cmd, true)
+	if nil != err {
+		return 0, err
+	}
+
+	w, err := p.ReadWordData(uint8(cmd))
+	if nil != err {
+		return 0, err
+	}
+
+	switch {
+	case direct:
+		return d.Decode(w), nil
+	case cmd.vout():
+		mode, err := p.VoutMode()
+		if nil != err {
+			return 0, err
+		}
+		if PMBusModeLinear != mode.Mode() {
+			return 0, fmt.Errorf("unsupported VOUT_MODE: %s", mode)
+		}
+		return mode.Linear16(w), nil
+	default:
+		return PMBusLinear11(w), nil
+	}
+}
+
+// Write writes the given value, in engineering units, to the given numeric
+// command.
+func (p *PMBus) Write(cmd PMBusCmd, x float64) error {
+
+	d, direct, err := p.direct(cmd, false)
+	if nil != err {
+		return err
+	}
+
+	var w uint16
+	switch {
+	case direct:
+		w, err = d.Encode(x)
+	case cmd.vout():
+		var mode PMBusMode
+		if mode, err = p.VoutMode(); nil == err {
+			if PMBusModeLinear != mode.Mode() {
+				return fmt.Errorf("unsupported VOUT_MODE: %s", mode)
+			}
+			w, err = mode.ToLinear16(x)
+		}
+	default:
+		w, err = PMBusToLinear11(x)
+	}
+	if nil != err {
+		return err
+	}
+
+	return p.WriteWordData(uint8(cmd), w)
+}
+
+// Status reads STATUS_WORD.
+func (p *PMBus) Status() (PMBusStatus, error) {
+	w, err := p.ReadWordData(uint8(PMBusStatusWord))
+	return PMBusStatus(w), err
+}
+
+// StatusByte reads one of the 8-bit status commands (e.g., STATUS_VOUT), whose
+// bits are defined by the PMBus specification for each command.
+func (p *PMBus) StatusByte(cmd PMBusCmd) (uint8, error) {
+	return p.ReadByteData(uint8(cmd))
+}
+
+// ReadString reads one of the block commands containing ASCII text (e.g.,
+// MFR_ID, MFR_MODEL).
+func (p *PMBus) ReadString(cmd PMBusCmd) (string, error) {
+	b, err := p.BlockRead(uint8(cmd))
+	return string(b), err
+}
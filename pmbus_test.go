@@ -0,0 +1,146 @@
+package ft232h
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPMBusLinear11(t *testing.T) {
+
+	for _, test := range []struct {
+		raw   uint16
+		value float64
+	}{
+		{raw: 0xF064, value: 25.0},
+		{raw: 0x07FF, value: -1.0},
+		{raw: 0xD2C8, value: 11.125},
+		{raw: 0x0001, value: 1.0},
+		{raw: 0x0400, value: -1024.0},
+		{raw: 0x7BFF, value: 1023.0 * 32768},
+	} {
+		t.Run(fmt.Sprintf("0x%04X", test.raw), func(s *testing.T) {
+			if v := PMBusLinear11(test.raw); test.value != v {
+				s.Fatalf("unexpected value: %g != %g", v, test.value)
+			}
+			raw, err := PMBusToLinear11(test.value)
+			if nil != err {
+				s.Fatalf("PMBusToLinear11(): %v", err)
+			}
+			if v := PMBusLinear11(raw); test.value != v {
+				s.Fatalf("unexpected round trip: %g != %g", v, test.value)
+			}
+		})
+	}
+
+	if raw, err := PMBusToLinear11(25.0); nil != err || 0xDB20 != raw {
+		t.Fatalf("unexpected encoding: 0x%04X (%v)", raw, err)
+	}
+	if _, err := PMBusToLinear11(1024.0 * 32768); nil == err {
+		t.Fatalf("expected error for value out of range")
+	}
+}
+
+func TestPMBusLinear16(t *testing.T) {
+
+	mode := PMBusMode(0x17) // LINEAR16, N=-9
+	if PMBusModeLinear != mode.Mode() || -9 != mode.Exponent() {
+		t.Fatalf("unexpected mode: %s", mode)
+	}
+	if v := mode.Linear16(0x0A00); 5.0 != v {
+		t.Fatalf("unexpected value: %g", v)
+	}
+	if raw, err := mode.ToLinear16(3.3); nil != err || 0x069A != raw {
+		t.Fatalf("unexpected encoding: 0x%04X (%v)", raw, err)
+	}
+	if _, err := mode.ToLinear16(-1.0); nil == err {
+		t.Fatalf("expected error for negative value")
+	}
+	if s := PMBusMode(0x40).String(); "DIRECT" != s {
+		t.Fatalf("unexpected mode string: %s", s)
+	}
+}
+
+func TestPMBusDirect(t *testing.T) {
+
+	for _, test := range []struct {
+		coef  PMBusDirect
+		raw   uint16
+		value float64
+	}{
+		{coef: PMBusDirect{M: 200, B: 0, R: -2}, raw: 25, value: 12.5},
+		{coef: PMBusDirect{M: 3, B: -100, R: 0}, raw: 50, value: 50.0},
+		{coef: PMBusDirect{M: 1, B: 0, R: 0}, raw: 0xFFF6, value: -10.0},
+		{coef: PMBusDirect{M: 5, B: 0, R: 1}, raw: 1000, value: 20.0},
+	} {
+		t.Run(fmt.Sprintf("%+v", test.coef), func(s *testing.T) {
+			if v := test.coef.Decode(test.raw); test.value != v {
+				s.Fatalf("unexpected value: %g != %g", v, test.value)
+			}
+			if raw, err := test.coef.Encode(test.value); nil != err || test.raw != raw {
+				s.Fatalf("unexpected encoding: 0x%04X != 0x%04X (%v)", raw, test.raw, err)
+			}
+		})
+	}
+
+	if _, err := (PMBusDirect{M: 1000, R: 2}).Encode(1000); nil == err {
+		t.Fatalf("expected error for value out of range")
+	}
+}
+
+func TestPMBusStatus(t *testing.T) {
+
+	exp := "0x0843 [NONE_OF_THE_ABOVE CML OFF POWER_GOOD#]"
+	if s := PMBusStatus(0x0843).String(); exp != s {
+		t.Fatalf("unexpected status: %q != %q", s, exp)
+	}
+	if !PMBusStatus(0x0843).Has(PMBusStatusBitPowerGoodNegated) ||
+		PMBusStatus(0x0843).Has(PMBusStatusBitBusy) {
+		t.Fatalf("unexpected status bits: %s", PMBusStatus(0x0843))
+	}
+	if s := PMBusStatusBitIoutPout.String(); "IOUT/POUT" != s {
+		t.Fatalf("unexpected status bit: %s", s)
+	}
+	if s := PMBusReadVout.String(); "READ_VOUT" != s {
+		t.Fatalf("unexpected command: %s", s)
+	}
+}
+
+func TestPMBusVoutDirect(t *testing.T) {
+
+	// cached VOUT_MODE and coefficients, so that no transfer is performed
+	mode := PMBusModeDirect
+	read := PMBusDirect{M: 200, B: 0, R: -2}
+	write := PMBusDirect{M: 400, B: 0, R: -2}
+	p := &PMBus{
+		Direct: map[PMBusCmd]PMBusDirect{PMBusVoutMax: {M: 1, B: 0, R: 0}},
+		mode:   &mode,
+		coef: map[pmbusCoef]PMBusDirect{
+			{cmd: PMBusReadVout, read: true}:     read,
+			{cmd: PMBusVoutCommand, read: false}: write,
+		},
+	}
+
+	for _, test := range []struct {
+		cmd  PMBusCmd
+		read bool
+		coef PMBusDirect
+	}{
+		{cmd: PMBusReadVout, read: true, coef: read},
+		{cmd: PMBusVoutCommand, read: false, coef: write},
+		{cmd: PMBusVoutMax, read: false, coef: PMBusDirect{M: 1, B: 0, R: 0}},
+	} {
+		t.Run(test.cmd.String(), func(s *testing.T) {
+			d, ok, err := p.direct(test.cmd, test.read)
+			if nil != err || !ok {
+				s.Fatalf("direct(): %t (%v)", ok, err)
+			}
+			if test.coef != d {
+				s.Fatalf("unexpected coefficients: %+v != %+v", d, test.coef)
+			}
+		})
+	}
+
+	if _, ok, err := p.direct(PMBusReadIout, true); nil != err || ok {
+		t.Fatalf("unexpected DIRECT format of non-VOUT command: %t (%v)", ok, err)
+	}
+}
@@ -0,0 +1,118 @@
+package ft232h
+
+import (
+	"errors"
+)
+
+// Errors returned by Recover when the I²C bus cannot be recovered.
+var (
+	// ErrSCLStuck is returned when SCL is held LOW by another device, which
+	// cannot be recovered by the master.
+	ErrSCLStuck = errors.New("SCL held LOW")
+	// ErrSDAStuck is returned when SDA is still held LOW by a slave after it has
+	// been clocked i2cRecoverPulses times.
+	ErrSDAStuck = errors.New("SDA held LOW")
+)
+
+// Constants defining the pins of port "D" sampled to determine I²C line state.
+// The FT232H SDA line is connected to both AD1 (output) and AD2 (input).
+const (
+	i2cSCLMask uint8 = 0x01 // AD0
+	i2cSDAMask uint8 = 0x04 // AD2
+)
+
+// i2cRecoverPulses is the maximum number of SCL pulses generated to release a
+// slave holding SDA LOW, i.e. enough to finish any byte being transmitted, plus
+// its ACK bit.
+const i2cRecoverPulses = 9
+
+// i2cRecoverHold is the number of times each pin state is repeated to hold the
+// state long enough during bus recovery (the same as a start condition).
+const i2cRecoverHold = i2cStartHold2
+
+// i2cRespPins is the meaning of a response byte containing the value of the
+// pins of port "D", sampled with i2cCmd.sample.
+const i2cRespPins i2cRespKind = i2cRespData + 1
+
+// sample appends the command reading the value of the pins of port "D".
+func (c *i2cCmd) sample() {
+	c.buf = append(c.buf, mpsseGetDataBitsLowByte)
+	c.resp = append(c.resp, i2cResp{kind: i2cRespPins})
+}
+
+// lines returns the state of SCL and SDA (true if HIGH) after executing the
+// given command cmd, which should leave both lines released.
+func (i2c *I2C) lines(cmd *i2cCmd) (scl bool, sda bool, err error) {
+	cmd.sample()
+	cmd.flush()
+	resp, err := i2c.exec(cmd)
+	if nil != err {
+		return false, false, err
+	}
+	pins := resp[len(resp)-1]
+	return 0 != pins&i2cSCLMask, 0 != pins&i2cSDAMask, nil
+}
+
+// Recover attempts to release an I²C bus on which a slave is holding SDA LOW,
+// e.g. a slave that was reset (or whose master was) in the middle of a read.
+// The lines are first released and sampled; if SDA is LOW, SCL is pulsed until
+// the slave releases SDA, up to 9 times, and a stop condition is generated to
+// reset the state of all slaves.
+// Returns ErrSCLStuck if SCL is held LOW, or ErrSDAStuck if SDA is still held
+// LOW after all SCL pulses.
+// See also I2COption.AutoRecover.
+func (i2c *I2C) Recover() error {
+
+	cmd := &i2cCmd{}
+	cmd.pins(i2cValSCLHiSDAHi, i2cDirSCLInSDAIn, 1)
+	scl, sda, err := i2c.lines(cmd)
+	if nil != err {
+		return err
+	}
+	if !scl {
+		return ErrSCLStuck
+	}
+
+	for i := 0; !sda && i < i2cRecoverPulses; i++ {
+		cmd := &i2cCmd{}
+		cmd.pins(i2cValSCLLoSDAHi, i2cDirSCLOutSDAIn, i2cRecoverHold)
+		cmd.pins(i2cValSCLHiSDAHi, i2cDirSCLOutSDAIn, i2cRecoverHold)
+		if scl, sda, err = i2c.lines(cmd); nil != err {
+			return err
+		}
+		if !scl {
+			return ErrSCLStuck
+		}
+	}
+	if !sda {
+		return ErrSDAStuck
+	}
+
+	// SDA is released with SCL HIGH. pull SCL LOW before generating the stop
+	// condition so that pulling SDA LOW isn't interpreted as a start condition.
+	cmd = &i2cCmd{}
+	cmd.pins(i2cValSCLLoSDAHi, i2cDirSCLOutSDAIn, i2cRecoverHold)
+	cmd.stop()
+	if _, sda, err = i2c.lines(cmd); nil != err {
+		return err
+	}
+	if !sda {
+		return ErrSDAStuck
+	}
+	return nil
+}
+
+// fail returns the given error err returned by a transfer (see i2cError). If
+// AutoRecover is set and the error is not caused by a slave NACK, a bus
+// recovery is attempted, whose result is ignored.
+func (i2c *I2C) fail(err error) error {
+	err = i2cError(err)
+	if nil == err || !i2c.config.recover || ErrAddrNACK == err {
+		return err
+	}
+	if _, ok := err.(*NACKError); ok {
+		return err
+	}
+	_ = i2c.Recover()
+	return err
+}
@@ -0,0 +1,420 @@
+package ft232h
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// RegAccess represents the access mode of a device register.
+type RegAccess uint8
+
+// Constants defining the supported register access modes.
+const (
+	RegReadWrite RegAccess = iota // readable and writable
+	RegReadOnly                   // readable only
+	RegWriteOnly                  // writable only
+)
+
+// String returns a string representation of the access mode.
+func (a RegAccess) String() string {
+	switch a {
+	case RegReadWrite:
+		return "rw"
+	case RegReadOnly:
+		return "r"
+	case RegWriteOnly:
+		return "w"
+	default:
+		return "(invalid access)"
+	}
+}
+
+// Readable returns true if the access mode permits reading.
+func (a RegAccess) Readable() bool { return RegReadWrite == a || RegReadOnly == a }
+
+// Writable returns true if the access mode permits writing.
+func (a RegAccess) Writable() bool { return RegReadWrite == a || RegWriteOnly == a }
+
+// MarshalText returns the string representation of the access mode, "rw", "r",
+// or "w".
+func (a RegAccess) MarshalText() ([]byte, error) {
+	if a > RegWriteOnly {
+		return nil, fmt.Errorf("invalid access mode: %d", a)
+	}
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText parses the string representation of an access mode, "rw", "r",
+// or "w".
+func (a *RegAccess) UnmarshalText(text []byte) error {
+	for _, m := range []RegAccess{RegReadWrite, RegReadOnly, RegWriteOnly} {
+		if m.String() == string(text) {
+			*a = m
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid access mode: %q", text)
+}
+
+// RegEnum names one of the values of a register bit field.
+type RegEnum struct {
+	Name  string `json:"name"`
+	Value uint64 `json:"value"`
+}
+
+// RegField describes a named bit field of a device register, occupying Width
+// bits beginning with bit Shift (the least significant bit is 0).
+type RegField struct {
+	Name  string    `json:"name"`
+	Shift uint      `json:"shift"`
+	Width uint      `json:"width"`
+	Enum  []RegEnum `json:"enum,omitempty"` // named values, if any
+	Doc   string    `json:"doc,omitempty"`
+}
+
+// Mask returns the bits occupied by the field in its register.
+func (f *RegField) Mask() uint64 {
+	if f.Width >= 64 {
+		return ^uint64(0) << f.Shift
+	}
+	return ((uint64(1) << f.Width) - 1) << f.Shift
+}
+
+// Get returns the value of the field, shifted to bit 0, contained in the given
+// register value reg.
+func (f *RegField) Get(reg uint64) uint64 {
+	return (reg & f.Mask()) >> f.Shift
+}
+
+// Set returns the given register value reg with the field replaced by the given
+// value, which is shifted into position.
+func (f *RegField) Set(reg uint64, value uint64) uint64 {
+	return (reg &^ f.Mask()) | ((value << f.Shift) & f.Mask())
+}
+
+// EnumName returns the name of the given field value, if it has one.
+func (f *RegField) EnumName(value uint64) (string, bool) {
+	for _, e := range f.Enum {
+		if value == e.Value {
+			return e.Name, true
+		}
+	}
+	return "", false
+}
+
+// EnumValue returns the field value with the given name, if it exists.
+func (f *RegField) EnumValue(name string) (uint64, bool) {
+	for _, e := range f.Enum {
+		if name == e.Name {
+			return e.Value, true
+		}
+	}
+	return 0, false
+}
+
+// RegDef describes a single device register, Size bytes wide, at sub-address
+// Addr.
+type RegDef struct {
+	Name   string     `json:"name"`
+	Addr   uint       `json:"addr"`
+	Size   uint       `json:"size"` // bytes, 1-8
+	Order  ByteOrder  `json:"order"`
+	Access RegAccess  `json:"access"`
+	Fields []RegField `json:"fields,omitempty"`
+	Doc    string     `json:"doc,omitempty"`
+}
+
+// Field returns the bit field with the given name, or nil if it does not exist.
+func (d *RegDef) Field(name string) *RegField {
+	for i := range d.Fields {
+		if name == d.Fields[i].Name {
+			return &d.Fields[i]
+		}
+	}
+	return nil
+}
+
+// Format returns a descriptive string of the given register value, including
+// the value of each bit field (and its name, if any).
+func (d *RegDef) Format(value uint64) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s (0x%02X) = 0x%0*X", d.Name, d.Addr, 2*d.Size, value)
+	if 0 == len(d.Fields) {
+		return sb.String()
+	}
+	sb.WriteString(" {")
+	for i := range d.Fields {
+		f := &d.Fields[i]
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		v := f.Get(value)
+		fmt.Fprintf(&sb, " %s: %d", f.Name, v)
+		if name, ok := f.EnumName(v); ok {
+			fmt.Fprintf(&sb, " (%s)", name)
+		}
+	}
+	sb.WriteString(" }")
+	return sb.String()
+}
+
+// validate checks that the register is well-formed in the given address space.
+func (d *RegDef) validate(space AddrSpace) error {
+
+	if "" == d.Name {
+		return fmt.Errorf("invalid register name (empty): 0x%02X", d.Addr)
+	}
+	if space.Bits() < 64 && uint64(d.Addr) >= uint64(1)<<space.Bits() {
+		return fmt.Errorf("register %s sub-address outside %s address space: 0x%02X",
+			d.Name, space, d.Addr)
+	}
+	if d.Size < 1 || d.Size > 8 {
+		return fmt.Errorf("invalid register %s size: %d", d.Name, d.Size)
+	}
+	if _, err := d.Order.MarshalText(); nil != err {
+		return fmt.Errorf("invalid register %s byte order: %d", d.Name, d.Order)
+	}
+	if _, err := d.Access.MarshalText(); nil != err {
+		return fmt.Errorf("invalid register %s access mode: %d", d.Name, d.Access)
+	}
+
+	used := uint64(0)
+	for i := range d.Fields {
+		f := &d.Fields[i]
+		if "" == f.Name || d.Field(f.Name) != f {
+			return fmt.Errorf("invalid register %s field name: %q", d.Name, f.Name)
+		}
+		if 0 == f.Width || f.Shift+f.Width > 8*d.Size {
+			return fmt.Errorf("invalid register %s field %s bits: %d-%d",
+				d.Name, f.Name, f.Shift, f.Shift+f.Width-1)
+		}
+		if 0 != used&f.Mask() {
+			return fmt.Errorf("register %s field %s overlaps another field",
+				d.Name, f.Name)
+		}
+		used |= f.Mask()
+		for j, e := range f.Enum {
+			if "" == e.Name {
+				return fmt.Errorf("invalid register %s field %s enum name (empty)",
+					d.Name, f.Name)
+			}
+			for _, p := range f.Enum[:j] {
+				if e.Name == p.Name {
+					return fmt.Errorf("duplicate register %s field %s enum name: %s",
+						d.Name, f.Name, e.Name)
+				}
+			}
+			if e.Value > f.Mask()>>f.Shift {
+				return fmt.Errorf("register %s field %s enum %s value out of range: %d",
+					d.Name, f.Name, e.Name, e.Value)
+			}
+		}
+	}
+	return nil
+}
+
+// RegMap describes the registers of a slave device, all of which share the same
+// sub-address space. The map is typically declared once per device, either as
+// a Go literal or parsed from a JSON description with ParseRegMap, and then
+// bound to a device with I2C.RegMap.
+type RegMap struct {
+	Name  string    `json:"name"`
+	Space AddrSpace `json:"space"`
+	Order ByteOrder `json:"order"` // default byte order of each register
+	Regs  []RegDef  `json:"regs"`
+}
+
+// Reg returns the register with the given name, or nil if it does not exist.
+func (m *RegMap) Reg(name string) *RegDef {
+	for i := range m.Regs {
+		if name == m.Regs[i].Name {
+			return &m.Regs[i]
+		}
+	}
+	return nil
+}
+
+// Validate checks that the register map is well-formed: register names and
+// sub-addresses are unique, and the bit fields of each register are contained
+// in the register and do not overlap.
+func (m *RegMap) Validate() error {
+
+	if nil == m {
+		return fmt.Errorf("invalid register map (nil)")
+	}
+	if 0 == m.Space.Bits() {
+		return fmt.Errorf("invalid sub-address space: %d", m.Space)
+	}
+
+	for i := range m.Regs {
+		d := &m.Regs[i]
+		if err := d.validate(m.Space); nil != err {
+			return err
+		}
+		if m.Reg(d.Name) != d {
+			return fmt.Errorf("duplicate register name: %s", d.Name)
+		}
+		for j := range m.Regs[:i] {
+			if d.Addr == m.Regs[j].Addr {
+				return fmt.Errorf("duplicate register sub-address: 0x%02X (%s, %s)",
+					d.Addr, m.Regs[j].Name, d.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// ParseRegMap parses and validates the JSON description of a register map.
+// Registers that do not specify "size", "order", or "access" default to 1 byte,
+// the byte order of the map, and "rw", respectively. Address spaces and byte
+// orders are given by name (e.g., "8-bit", "MSB"), and access modes as "rw",
+// "r", or "w".
+func ParseRegMap(data []byte) (*RegMap, error) {
+
+	var desc struct {
+		RegMap
+		Regs []json.RawMessage `json:"regs"`
+	}
+	desc.Space = Addr8Bit
+	if err := json.Unmarshal(data, &desc); nil != err {
+		return nil, err
+	}
+
+	m := desc.RegMap
+	m.Regs = make([]RegDef, len(desc.Regs))
+	for i, raw := range desc.Regs {
+		m.Regs[i] = RegDef{Size: 1, Order: m.Order, Access: RegReadWrite}
+		if err := json.Unmarshal(raw, &m.Regs[i]); nil != err {
+			return nil, err
+		}
+	}
+
+	if err := m.Validate(); nil != err {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// I2CRegMap binds a RegMap to an I²C slave device, providing access to its
+// registers and bit fields by name.
+type I2CRegMap struct {
+	i2c   I2CBus
+	slave I2CAddr
+	Map   *RegMap
+}
+
+// RegMap validates and binds the given register map to the given slave.
+func (i2c *I2C) RegMap(slave I2CAddr, m *RegMap) (*I2CRegMap, error) {
+	return newI2CRegMap(i2c, slave, m)
+}
+
+// newI2CRegMap validates and binds the given register map to the given slave
+// using the given I²C bus.
+func newI2CRegMap(bus I2CBus, slave I2CAddr, m *RegMap) (*I2CRegMap, error) {
+	if err := m.Validate(); nil != err {
+		return nil, err
+	}
+	return &I2CRegMap{i2c: bus, slave: slave, Map: m}, nil
+}
+
+// reg returns the definition and I2CReg of the register with the given name.
+func (r *I2CRegMap) reg(name string) (*RegDef, *I2CReg, error) {
+	d := r.Map.Reg(name)
+	if nil == d {
+		return nil, nil, fmt.Errorf("invalid register: %s", name)
+	}
+	return d, r.i2c.Reg(r.slave, d.Addr, r.Map.Space, d.Order), nil
+}
+
+// Read reads the value of the register with the given name.
+func (r *I2CRegMap) Read(name string) (uint64, error) {
+	d, reg, err := r.reg(name)
+	if nil != err {
+		return 0, err
+	}
+	if !d.Access.Readable() {
+		return 0, fmt.Errorf("register not readable: %s", name)
+	}
+	v, err := reg.ReadBurst(d.Size, 1)
+	if nil != err {
+		return 0, err
+	}
+	return v[0], nil
+}
+
+// Write writes the given value to the register with the given name.
+func (r *I2CRegMap) Write(name string, value uint64) error {
+	d, reg, err := r.reg(name)
+	if nil != err {
+		return err
+	}
+	if !d.Access.Writable() {
+		return fmt.Errorf("register not writable: %s", name)
+	}
+	if d.Size < 8 && value >= uint64(1)<<(8*d.Size) {
+		return fmt.Errorf("register %s value out of range: 0x%X", name, value)
+	}
+	return reg.WriteBurst(d.Size, []uint64{value})
+}
+
+// ReadField reads the value of the given bit field of the given register,
+// shifted to bit 0.
+func (r *I2CRegMap) ReadField(name string, field string) (uint64, error) {
+	d := r.Map.Reg(name)
+	if nil == d {
+		return 0, fmt.Errorf("invalid register: %s", name)
+	}
+	f := d.Field(field)
+	if nil == f {
+		return 0, fmt.Errorf("invalid register %s field: %s", name, field)
+	}
+	v, err := r.Read(name)
+	if nil != err {
+		return 0, err
+	}
+	return f.Get(v), nil
+}
+
+// WriteField updates the given bit field of the given register with the given
+// value, which is shifted into position, using a read-modify-write of the
+// register (see I2CReg.Update).
+func (r *I2CRegMap) WriteField(name string, field string, value uint64) error {
+	d, reg, err := r.reg(name)
+	if nil != err {
+		return err
+	}
+	if RegReadWrite != d.Access {
+		return fmt.Errorf("register not readable and writable: %s", name)
+	}
+	f := d.Field(field)
+	if nil == f {
+		return fmt.Errorf("invalid register %s field: %s", name, field)
+	}
+	if value > f.Mask()>>f.Shift {
+		return fmt.Errorf("register %s field %s value out of range: %d",
+			name, field, value)
+	}
+	_, err = reg.Update(d.Size, f.Mask(), f.Set(0, value))
+	return err
+}
+
+// Dump reads every readable register and writes its formatted value (see
+// RegDef.Format) to the given writer w, one register per line.
+func (r *I2CRegMap) Dump(w io.Writer) error {
+	for i := range r.Map.Regs {
+		d := &r.Map.Regs[i]
+		if !d.Access.Readable() {
+			continue
+		}
+		v, err := r.Read(d.Name)
+		if nil != err {
+			return err
+		}
+		if _, err := fmt.Fprintln(w, d.Format(v)); nil != err {
+			return err
+		}
+	}
+	return nil
+}
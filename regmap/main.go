@@ -0,0 +1,70 @@
+// Command regmap generates a Go package declaring the register map described by
+// a JSON file (see ft232h.ParseRegMap), with typed accessors for the registers
+// of an I²C slave device. SPI devices are not supported.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/ardnew/ft232h"
+)
+
+func main() {
+
+	pkg := flag.String("pkg", "regs", "name of the generated Go package")
+	out := flag.String("o", "", "output file (default stdout)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"usage: %s [-pkg name] [-o file] regmap.json\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if 1 != flag.NArg() {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := generate(flag.Arg(0), *out, *pkg); nil != err {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func generate(in string, out string, pkg string) error {
+
+	data, err := ioutil.ReadFile(in)
+	if nil != err {
+		return err
+	}
+
+	m, err := ft232h.ParseRegMap(data)
+	if nil != err {
+		return fmt.Errorf("%s: %v", in, err)
+	}
+
+	// generate the entire source before creating the output file, so that an
+	// invalid register map does not leave behind an empty file.
+	var src bytes.Buffer
+	if err := render(&src, m, pkg); nil != err {
+		return fmt.Errorf("%s: %v", in, err)
+	}
+
+	var w io.Writer = os.Stdout
+	if "" != out {
+		f, err := os.Create(out)
+		if nil != err {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	_, err = src.WriteTo(w)
+	return err
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"reflect"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/ardnew/ft232h"
+)
+
+// ident converts the given register, field, or enum name (e.g.,
+// "MASK_ENABLE") to an exported Go identifier (e.g., "MaskEnable").
+func ident(name string) string {
+	var sb strings.Builder
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		r := []rune(strings.ToLower(word))
+		r[0] = unicode.ToUpper(r[0])
+		sb.WriteString(string(r))
+	}
+	id := sb.String()
+	if "" == id || !unicode.IsLetter([]rune(id)[0]) {
+		id = "X" + id
+	}
+	return id
+}
+
+// accessIdent returns the qualified identifier of the given access mode.
+func accessIdent(a ft232h.RegAccess) string {
+	switch a {
+	case ft232h.RegReadOnly:
+		return "ft232h.RegReadOnly"
+	case ft232h.RegWriteOnly:
+		return "ft232h.RegWriteOnly"
+	default:
+		return "ft232h.RegReadWrite"
+	}
+}
+
+// scope maps each identifier declared in a scope of the generated source
+// to a description of its origin.
+type scope map[string]string
+
+// declare adds the given identifier id of the given origin what to the scope,
+// returning a non-nil error if it is already declared.
+func (s scope) declare(id string, what string) error {
+	if prev, ok := s[id]; ok {
+		return fmt.Errorf("generated identifier %s of %s conflicts with %s",
+			id, what, prev)
+	}
+	s[id] = what
+	return nil
+}
+
+// checkIdents verifies that every identifier of the generated source is unique
+// within its scope: the package scope, and the method set of type Regs, which
+// includes the field and promoted methods of its embedded *ft232h.I2CRegMap.
+func checkIdents(m *ft232h.RegMap) error {
+
+	pkg := scope{
+		"RegMap":  "the register map",
+		"Regs":    "the register accessor type",
+		"NewRegs": "the register accessor constructor",
+	}
+	regs := scope{"I2CRegMap": "the embedded register map"}
+	t := reflect.TypeOf(&ft232h.I2CRegMap{})
+	for i := 0; i < t.NumMethod(); i++ {
+		regs[t.Method(i).Name] = "method I2CRegMap." + t.Method(i).Name
+	}
+
+	for i := range m.Regs {
+		r := &m.Regs[i]
+		n := ident(r.Name)
+		what := "register " + r.Name
+		if err := pkg.declare(n+"Addr", what); nil != err {
+			return err
+		}
+		if r.Access.Readable() {
+			if err := regs.declare(n, what); nil != err {
+				return err
+			}
+		}
+		if r.Access.Writable() {
+			if err := regs.declare("Set"+n, what); nil != err {
+				return err
+			}
+		}
+		for j := range r.Fields {
+			f := &r.Fields[j]
+			t := n + ident(f.Name)
+			what := fmt.Sprintf("field %s of register %s", f.Name, r.Name)
+			for _, id := range []string{t, t + "Shift", t + "Width"} {
+				if err := pkg.declare(id, what); nil != err {
+					return err
+				}
+			}
+			for _, e := range f.Enum {
+				if err := pkg.declare(t+ident(e.Name), fmt.Sprintf(
+					"value %s of field %s of register %s", e.Name, f.Name, r.Name),
+				); nil != err {
+					return err
+				}
+			}
+			if r.Access.Readable() {
+				if err := regs.declare(t, what); nil != err {
+					return err
+				}
+				if r.Access.Writable() {
+					if err := regs.declare("Set"+t, what); nil != err {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+var regMapTemplate = template.Must(template.New("regmap").Funcs(template.FuncMap{
+	"ident":  ident,
+	"access": accessIdent,
+}).Parse(`// Code generated by regmap; DO NOT EDIT.
+
+package {{ .Pkg }}
+
+import (
+	"fmt"
+
+	"github.com/ardnew/ft232h"
+)
+
+// RegMap is the register map of the {{ .Map.Name }}.
+var RegMap = &ft232h.RegMap{
+	Name:  {{ printf "%q" .Map.Name }},
+	Space: ft232h.Addr{{ .Map.Space.Bits }}Bit,
+	Order: ft232h.{{ .Map.Order }},
+	Regs: []ft232h.RegDef{
+	{{- range .Map.Regs }}
+		{
+			Name:   {{ printf "%q" .Name }},
+			Addr:   {{ printf "0x%02X" .Addr }},
+			Size:   {{ .Size }},
+			Order:  ft232h.{{ .Order }},
+			Access: {{ access .Access }},
+			{{- if .Doc }}
+			Doc:    {{ printf "%q" .Doc }},
+			{{- end }}
+			{{- if .Fields }}
+			Fields: []ft232h.RegField{
+			{{- range .Fields }}
+				{
+					Name:  {{ printf "%q" .Name }},
+					Shift: {{ .Shift }},
+					Width: {{ .Width }},
+					{{- if .Doc }}
+					Doc:   {{ printf "%q" .Doc }},
+					{{- end }}
+					{{- if .Enum }}
+					Enum: []ft232h.RegEnum{
+					{{- range .Enum }}
+						{Name: {{ printf "%q" .Name }}, Value: {{ .Value }}},
+					{{- end }}
+					},
+					{{- end }}
+				},
+			{{- end }}
+			},
+			{{- end }}
+		},
+	{{- end }}
+	},
+}
+
+// Constants defining the sub-address of each register.
+const (
+{{- range .Map.Regs }}
+	{{ ident .Name }}Addr = {{ printf "0x%02X" .Addr }}
+{{- end }}
+)
+{{ range $r := .Map.Regs }}{{ range .Fields }}
+{{ $t := printf "%s%s" (ident $r.Name) (ident .Name) -}}
+// {{ $t }} is the {{ .Name }} field of register {{ $r.Name }}.
+{{- if .Doc }}
+// {{ .Doc }}
+{{- end }}
+type {{ $t }} uint64
+
+// Constants defining the position of field {{ .Name }} in register {{ $r.Name }}.
+const (
+	{{ $t }}Shift = {{ .Shift }}
+	{{ $t }}Width = {{ .Width }}
+)
+{{- if .Enum }}
+
+// Constants defining the named values of field {{ .Name }}.
+const (
+{{- range .Enum }}
+	{{ $t }}{{ ident .Name }} {{ $t }} = {{ .Value }}
+{{- end }}
+)
+{{- end }}
+
+// String returns the name of the field value, if it has one.
+func (v {{ $t }}) String() string {
+	{{- if .Enum }}
+	switch v {
+	{{- range .Enum }}
+	case {{ $t }}{{ ident .Name }}:
+		return {{ printf "%q" .Name }}
+	{{- end }}
+	}
+	{{- end }}
+	return fmt.Sprintf("%d", uint64(v))
+}
+{{ end }}{{ end }}
+// Regs provides typed access to the registers of a {{ .Map.Name }} slave device.
+type Regs struct {
+	*ft232h.I2CRegMap
+}
+
+// NewRegs returns typed register access for the {{ .Map.Name }} with the given
+// slave address.
+func NewRegs(i2c *ft232h.I2C, slave ft232h.I2CAddr) (*Regs, error) {
+	m, err := i2c.RegMap(slave, RegMap)
+	if nil != err {
+		return nil, err
+	}
+	return &Regs{I2CRegMap: m}, nil
+}
+{{ range $r := .Map.Regs }}{{ $n := ident .Name }}
+{{- if .Access.Readable }}
+
+// {{ $n }} reads register {{ .Name }}.
+func (r *Regs) {{ $n }}() (uint64, error) {
+	return r.Read({{ printf "%q" .Name }})
+}
+{{- end }}
+{{- if .Access.Writable }}
+
+// Set{{ $n }} writes register {{ .Name }}.
+func (r *Regs) Set{{ $n }}(value uint64) error {
+	return r.Write({{ printf "%q" .Name }}, value)
+}
+{{- end }}
+{{- range .Fields }}{{ $t := printf "%s%s" $n (ident .Name) }}
+{{- if $r.Access.Readable }}
+
+// {{ $t }} reads field {{ .Name }} of register {{ $r.Name }}.
+func (r *Regs) {{ $t }}() ({{ $t }}, error) {
+	v, err := r.ReadField({{ printf "%q" $r.Name }}, {{ printf "%q" .Name }})
+	return {{ $t }}(v), err
+}
+{{- end }}
+{{- if and $r.Access.Readable $r.Access.Writable }}
+
+// Set{{ $t }} updates field {{ .Name }} of register {{ $r.Name }}.
+func (r *Regs) Set{{ $t }}(value {{ $t }}) error {
+	return r.WriteField({{ printf "%q" $r.Name }}, {{ printf "%q" .Name }}, uint64(value))
+}
+{{- end }}
+{{- end }}
+{{- end }}
+`))
+
+// render writes the Go source code of a package with the given name that
+// declares the given register map as an ft232h.RegMap literal, along with
+// constants for each register sub-address and bit field, a named type for each
+// bit field (with constants for its named values), and a Regs type with typed
+// accessors for each register and bit field of an I²C slave device.
+// Returns a non-nil error if any two names (or a name and one of the methods of
+// ft232h.I2CRegMap) produce the same Go identifier.
+func render(w io.Writer, m *ft232h.RegMap, pkg string) error {
+
+	if err := m.Validate(); nil != err {
+		return err
+	}
+
+	if err := checkIdents(m); nil != err {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := regMapTemplate.Execute(&buf, struct {
+		Pkg string
+		Map *ft232h.RegMap
+	}{pkg, m}); nil != err {
+		return err
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if nil != err {
+		return fmt.Errorf("invalid generated source: %v", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/ardnew/ft232h"
+)
+
+const testRegMapJSON = `{
+	"name": "TEST",
+	"space": "8-bit",
+	"order": "LSB",
+	"regs": [
+		{ "name": "CONFIG", "addr": 0, "size": 2, "order": "MSB", "fields": [
+			{ "name": "MODE", "shift": 0, "width": 3, "enum": [
+				{ "name": "OFF", "value": 0 },
+				{ "name": "CONT", "value": 7 }
+			] },
+			{ "name": "RST", "shift": 15, "width": 1 }
+		] },
+		{ "name": "STATUS", "addr": 1, "access": "r" },
+		{ "name": "ID", "addr": 255, "size": 4, "access": "r" }
+	]
+}`
+
+func TestRender(t *testing.T) {
+
+	for _, test := range []struct {
+		name  string
+		ident string
+	}{
+		{name: "CONFIG", ident: "Config"},
+		{name: "MASK_ENABLE", ident: "MaskEnable"},
+		{name: "die id", ident: "DieId"},
+		{name: "3V3_EN", ident: "X3v3En"},
+	} {
+		if ident := ident(test.name); test.ident != ident {
+			t.Fatalf("unexpected identifier: %q != %q", ident, test.ident)
+		}
+	}
+
+	m, err := ft232h.ParseRegMap([]byte(testRegMapJSON))
+	if nil != err {
+		t.Fatalf("ft232h.ParseRegMap(): %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := render(&buf, m, "test"); nil != err {
+		t.Fatalf("render(): %v", err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "", buf.Bytes(), 0); nil != err {
+		t.Fatalf("invalid generated source: %v", err)
+	}
+	for _, decl := range []string{
+		"func (r *Regs) Config() (uint64, error)",
+		"func (r *Regs) SetConfigMode(value ConfigMode) error",
+		"ConfigModeCont ConfigMode = 7",
+		"func (r *Regs) Status() (uint64, error)",
+	} {
+		if !bytes.Contains(buf.Bytes(), []byte(decl)) {
+			t.Fatalf("generated source missing: %s", decl)
+		}
+	}
+	if bytes.Contains(buf.Bytes(), []byte("SetStatus")) {
+		t.Fatalf("generated source contains writer of read-only register")
+	}
+
+	for _, test := range []struct {
+		name string
+		regs []ft232h.RegDef
+	}{
+		{name: "embedded-method", regs: []ft232h.RegDef{
+			{Name: "READ", Addr: 0x00, Size: 1, Access: ft232h.RegReadWrite},
+		}},
+		{name: "register-field", regs: []ft232h.RegDef{
+			{Name: "CONFIG", Addr: 0x00, Size: 1, Access: ft232h.RegReadWrite,
+				Fields: []ft232h.RegField{{Name: "MODE", Shift: 0, Width: 2}}},
+			{Name: "CONFIG_MODE", Addr: 0x01, Size: 1, Access: ft232h.RegReadWrite},
+		}},
+		{name: "field-addr", regs: []ft232h.RegDef{
+			{Name: "CONFIG", Addr: 0x00, Size: 1, Access: ft232h.RegReadOnly,
+				Fields: []ft232h.RegField{{Name: "ADDR", Shift: 0, Width: 2}}},
+		}},
+		{name: "names", regs: []ft232h.RegDef{
+			{Name: "die-id", Addr: 0x00, Size: 1, Access: ft232h.RegReadOnly},
+			{Name: "DIE_ID", Addr: 0x01, Size: 1, Access: ft232h.RegReadOnly},
+		}},
+	} {
+		t.Run(test.name, func(s *testing.T) {
+			m := &ft232h.RegMap{Name: "test", Space: ft232h.Addr8Bit, Order: ft232h.MSB,
+				Regs: test.regs}
+			err := render(&bytes.Buffer{}, m, "test")
+			if nil == err || !bytes.Contains([]byte(err.Error()), []byte("conflicts")) {
+				s.Fatalf("render(): expected identifier conflict: %v", err)
+			}
+		})
+	}
+}
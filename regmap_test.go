@@ -0,0 +1,140 @@
+package ft232h
+
+import "testing"
+
+const testRegMapJSON = `{
+	"name": "TEST",
+	"space": "8-bit",
+	"order": "LSB",
+	"regs": [
+		{ "name": "CONFIG", "addr": 0, "size": 2, "order": "MSB", "fields": [
+			{ "name": "MODE", "shift": 0, "width": 3, "enum": [
+				{ "name": "OFF", "value": 0 },
+				{ "name": "CONT", "value": 7 }
+			] },
+			{ "name": "RST", "shift": 15, "width": 1 }
+		] },
+		{ "name": "STATUS", "addr": 1, "access": "r" },
+		{ "name": "ID", "addr": 255, "size": 4, "access": "r" }
+	]
+}`
+
+func TestParseRegMap(t *testing.T) {
+
+	m, err := ParseRegMap([]byte(testRegMapJSON))
+	if nil != err {
+		t.Fatalf("ParseRegMap(): %v", err)
+	}
+
+	for _, test := range []struct {
+		name   string
+		addr   uint
+		size   uint
+		order  ByteOrder
+		access RegAccess
+	}{
+		{name: "CONFIG", addr: 0x00, size: 2, order: MSB, access: RegReadWrite},
+		{name: "STATUS", addr: 0x01, size: 1, order: LSB, access: RegReadOnly},
+		{name: "ID", addr: 0xFF, size: 4, order: LSB, access: RegReadOnly},
+	} {
+		t.Run(test.name, func(s *testing.T) {
+			d := m.Reg(test.name)
+			if nil == d {
+				s.Fatalf("register not found")
+			}
+			if test.addr != d.Addr || test.size != d.Size ||
+				test.order != d.Order || test.access != d.Access {
+				s.Fatalf("unexpected register: %+v", d)
+			}
+		})
+	}
+}
+
+func TestRegMapValidate(t *testing.T) {
+
+	for _, test := range []struct {
+		name string
+		regs []RegDef
+		ok   bool
+	}{
+		{name: "empty", ok: true},
+		{name: "valid", regs: []RegDef{
+			{Name: "A", Addr: 0x00, Size: 1, Fields: []RegField{{Name: "X", Shift: 0, Width: 8}}},
+			{Name: "B", Addr: 0xFF, Size: 8, Fields: []RegField{{Name: "X", Shift: 0, Width: 64}}},
+		}, ok: true},
+		{name: "duplicate-name", regs: []RegDef{
+			{Name: "A", Addr: 0x00, Size: 1}, {Name: "A", Addr: 0x01, Size: 1},
+		}, ok: false},
+		{name: "duplicate-addr", regs: []RegDef{
+			{Name: "A", Addr: 0x00, Size: 1}, {Name: "B", Addr: 0x00, Size: 1},
+		}, ok: false},
+		{name: "addr-space", regs: []RegDef{{Name: "A", Addr: 0x100, Size: 1}}, ok: false},
+		{name: "size", regs: []RegDef{{Name: "A", Size: 9}}, ok: false},
+		{name: "order", regs: []RegDef{{Name: "A", Size: 1, Order: 2}}, ok: false},
+		{name: "access", regs: []RegDef{{Name: "A", Size: 1, Access: 3}}, ok: false},
+		{name: "field-range", regs: []RegDef{
+			{Name: "A", Size: 1, Fields: []RegField{{Name: "X", Shift: 4, Width: 5}}},
+		}, ok: false},
+		{name: "field-width", regs: []RegDef{
+			{Name: "A", Size: 1, Fields: []RegField{{Name: "X", Shift: 4}}},
+		}, ok: false},
+		{name: "field-overlap", regs: []RegDef{
+			{Name: "A", Size: 1, Fields: []RegField{
+				{Name: "X", Shift: 0, Width: 4}, {Name: "Y", Shift: 3, Width: 2},
+			}},
+		}, ok: false},
+		{name: "field-name", regs: []RegDef{
+			{Name: "A", Size: 1, Fields: []RegField{
+				{Name: "X", Shift: 0, Width: 1}, {Name: "X", Shift: 1, Width: 1},
+			}},
+		}, ok: false},
+		{name: "enum-range", regs: []RegDef{
+			{Name: "A", Size: 1, Fields: []RegField{
+				{Name: "X", Shift: 0, Width: 2, Enum: []RegEnum{{Name: "E", Value: 4}}},
+			}},
+		}, ok: false},
+		{name: "enum-name", regs: []RegDef{
+			{Name: "A", Size: 1, Fields: []RegField{
+				{Name: "X", Shift: 0, Width: 2, Enum: []RegEnum{
+					{Name: "E", Value: 0}, {Name: "E", Value: 1},
+				}},
+			}},
+		}, ok: false},
+	} {
+		t.Run(test.name, func(s *testing.T) {
+			m := &RegMap{Name: test.name, Space: Addr8Bit, Regs: test.regs}
+			if err := m.Validate(); test.ok != (nil == err) {
+				s.Fatalf("unexpected result: %v", err)
+			}
+		})
+	}
+}
+
+func TestRegDefFormat(t *testing.T) {
+
+	m, err := ParseRegMap([]byte(testRegMapJSON))
+	if nil != err {
+		t.Fatalf("ParseRegMap(): %v", err)
+	}
+
+	d := m.Reg("CONFIG")
+	f := d.Field("MODE")
+	if v := f.Set(0x8000, 7); 0x8007 != v {
+		t.Fatalf("unexpected field set: 0x%04X", v)
+	}
+	if v := f.Get(0x8005); 5 != v {
+		t.Fatalf("unexpected field get: %d", v)
+	}
+
+	for _, test := range []struct {
+		value uint64
+		str   string
+	}{
+		{value: 0x8007, str: "CONFIG (0x00) = 0x8007 { MODE: 7 (CONT), RST: 1 }"},
+		{value: 0x0003, str: "CONFIG (0x00) = 0x0003 { MODE: 3, RST: 0 }"},
+	} {
+		if str := d.Format(test.value); test.str != str {
+			t.Fatalf("unexpected format: %q != %q", str, test.str)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package ft232h
+
+import (
+	"fmt"
+	"strings"
+)
+
+// I2CProbe identifies the method used to detect a slave device at an I²C slave
+// address, following the conventions of the Linux i2cdetect utility.
+type I2CProbe int
+
+// Constants defining the methods used to probe I²C slave addresses.
+const (
+	// I2CProbeAuto uses I2CProbeReadByte for addresses 0x30-0x37 and 0x50-0x5F
+	// (which may be write-protected EEPROMs corrupted by quick writes), and
+	// I2CProbeQuickWrite for all other addresses.
+	I2CProbeAuto I2CProbe = iota
+	// I2CProbeQuickWrite sends the slave address with the write bit set,
+	// followed immediately by a stop condition (SMBus "quick write").
+	I2CProbeQuickWrite
+	// I2CProbeReadByte sends the slave address with the read bit set and reads a
+	// single byte, which is NACKed, followed by a stop condition.
+	I2CProbeReadByte
+	// I2CProbeSkip does not probe the address.
+	I2CProbeSkip
+	I2CProbeDefault = I2CProbeAuto
+)
+
+// String returns a descriptive string of an I2CProbe.
+func (p I2CProbe) String() string {
+	switch p {
+	case I2CProbeAuto:
+		return "auto"
+	case I2CProbeQuickWrite:
+		return "quick write"
+	case I2CProbeReadByte:
+		return "read byte"
+	case I2CProbeSkip:
+		return "skip"
+	default:
+		return fmt.Sprintf("invalid probe (%d)", int(p))
+	}
+}
+
+// method returns the probe method used for the given slave address, resolving
+// I2CProbeAuto to either I2CProbeQuickWrite or I2CProbeReadByte.
+func (p I2CProbe) method(slave uint) I2CProbe {
+	if I2CProbeAuto != p {
+		return p
+	}
+	if (slave >= 0x30 && slave <= 0x37) || (slave >= 0x50 && slave <= 0x5F) {
+		return I2CProbeReadByte
+	}
+	return I2CProbeQuickWrite
+}
+
+// I2CScanRange overrides the probe method used for all I²C slave addresses from
+// First through Last (inclusive).
+type I2CScanRange struct {
+	First uint
+	Last  uint
+	Probe I2CProbe
+}
+
+// I2CScanOption holds the settings used to scan an I²C bus for slave devices.
+// If both First and Last are 0, the range of legal 7-bit slave addresses is
+// scanned (I2CSlaveAddressMin-I2CSlaveAddressMax).
+// Each address is probed using method Probe, unless the address is contained in
+// one of Ranges, in which case the method of the last such range is used.
+type I2CScanOption struct {
+	First  uint           // first slave address to probe
+	Last   uint           // last slave address to probe
+	Probe  I2CProbe       // default probe method
+	Ranges []I2CScanRange // probe method overrides for address ranges
+}
+
+// I2CScanOptionDefault returns the default settings used to scan an I²C bus,
+// equivalent to i2cdetect without options.
+func I2CScanOptionDefault() *I2CScanOption {
+	return &I2CScanOption{
+		First: I2CSlaveAddressMin,
+		Last:  I2CSlaveAddressMax,
+		Probe: I2CProbeDefault,
+	}
+}
+
+// probe returns the probe method used for the given slave address.
+func (opt *I2CScanOption) probe(slave uint) I2CProbe {
+	probe := opt.Probe
+	for _, r := range opt.Ranges {
+		if slave >= r.First && slave <= r.Last {
+			probe = r.Probe
+		}
+	}
+	return probe.method(slave)
+}
+
+// i2cScanAddrs is the number of 7-bit I²C slave addresses.
+const i2cScanAddrs = 0x80
+
+// I2CScan contains the result of an I²C bus scan, i.e. the set of slave
+// addresses that were probed, and which of those responded.
+type I2CScan struct {
+	probed [i2cScanAddrs]bool
+	found  [i2cScanAddrs]bool
+}
+
+// Probed returns true if the given slave address was probed.
+func (s *I2CScan) Probed(slave uint) bool {
+	return slave < i2cScanAddrs && s.probed[slave]
+}
+
+// Found returns true if a slave device responded at the given slave address.
+func (s *I2CScan) Found(slave uint) bool {
+	return slave < i2cScanAddrs && s.found[slave]
+}
+
+// Addrs returns the slave addresses that responded, in increasing order.
+func (s *I2CScan) Addrs() []I2CAddr {
+	var addr []I2CAddr
+	for a, ok := range s.found {
+		if ok {
+			addr = append(addr, I2CAddr(a))
+		}
+	}
+	return addr
+}
+
+// String returns the scan result formatted as the familiar 16×8 grid printed by
+// i2cdetect: responding addresses are printed in hexadecimal, addresses that did
+// not respond are printed as "--", and addresses not probed are left blank.
+func (s *I2CScan) String() string {
+	var sb strings.Builder
+	sb.WriteString("   ")
+	for col := 0; col < 16; col++ {
+		fmt.Fprintf(&sb, "  %x", col)
+	}
+	sb.WriteString("\n")
+	for row := 0; row < i2cScanAddrs; row += 16 {
+		fmt.Fprintf(&sb, "%02x:", row)
+		for col := 0; col < 16; col++ {
+			switch a := row + col; {
+			case s.found[a]:
+				fmt.Fprintf(&sb, " %02x", a)
+			case s.probed[a]:
+				sb.WriteString(" --")
+			default:
+				sb.WriteString("   ")
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// Scan probes each 7-bit I²C slave address in the range defined by the given
+// scan options, returning the set of addresses that responded.
+// If the given scan options are nil, the default options are used (see
+// I2CScanOptionDefault).
+// The I²C interface must be initialized before scanning.
+// If an error other than a missing acknowledgement occurs, the scan stops and
+// the partial result is returned along with the error.
+func (i2c *I2C) Scan(opt *I2CScanOption) (*I2CScan, error) {
+
+	if nil == opt {
+		opt = I2CScanOptionDefault()
+	}
+
+	first, last := opt.First, opt.Last
+	if 0 == first && 0 == last {
+		first, last = I2CSlaveAddressMin, I2CSlaveAddressMax
+	}
+	if first > last || last >= i2cScanAddrs {
+		return nil, fmt.Errorf("invalid scan range: 0x%02X-0x%02X", first, last)
+	}
+
+	for _, r := range append([]I2CScanRange{{Probe: opt.Probe}}, opt.Ranges...) {
+		if r.Probe < I2CProbeAuto || r.Probe > I2CProbeSkip {
+			return nil, fmt.Errorf("invalid probe method: %d", int(r.Probe))
+		}
+	}
+
+	scan := &I2CScan{}
+	for slave := first; slave <= last; slave++ {
+		probe := opt.probe(slave)
+		if I2CProbeSkip == probe {
+			continue
+		}
+		ok, err := _I2C_Probe(i2c, slave, I2CProbeReadByte == probe)
+		if nil != err {
+			return scan, err
+		}
+		scan.probed[slave] = true
+		scan.found[slave] = ok
+	}
+
+	return scan, nil
+}
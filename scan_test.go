@@ -0,0 +1,88 @@
+package ft232h
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestI2CScanOptionProbe(t *testing.T) {
+
+	opt := &I2CScanOption{
+		Probe: I2CProbeAuto,
+		Ranges: []I2CScanRange{
+			{First: 0x40, Last: 0x4F, Probe: I2CProbeReadByte},
+			{First: 0x48, Last: 0x48, Probe: I2CProbeSkip},
+			{First: 0x50, Last: 0x53, Probe: I2CProbeQuickWrite},
+		},
+	}
+
+	for _, test := range []struct {
+		slave uint
+		probe I2CProbe
+	}{
+		{slave: 0x08, probe: I2CProbeQuickWrite},
+		{slave: 0x30, probe: I2CProbeReadByte},
+		{slave: 0x37, probe: I2CProbeReadByte},
+		{slave: 0x38, probe: I2CProbeQuickWrite},
+		{slave: 0x40, probe: I2CProbeReadByte},
+		{slave: 0x48, probe: I2CProbeSkip},
+		{slave: 0x4F, probe: I2CProbeReadByte},
+		{slave: 0x50, probe: I2CProbeQuickWrite},
+		{slave: 0x54, probe: I2CProbeReadByte},
+		{slave: 0x5F, probe: I2CProbeReadByte},
+		{slave: 0x60, probe: I2CProbeQuickWrite},
+	} {
+		t.Run(fmt.Sprintf("0x%02X", test.slave), func(s *testing.T) {
+			if probe := opt.probe(test.slave); test.probe != probe {
+				s.Fatalf("unexpected probe: %q != %q", probe, test.probe)
+			}
+		})
+	}
+}
+
+func TestI2CScanString(t *testing.T) {
+
+	scan := &I2CScan{}
+	for a := uint(I2CSlaveAddressMin); a <= I2CSlaveAddressMax; a++ {
+		scan.probed[a] = true
+	}
+	scan.found[0x40] = true
+	scan.found[0x77] = true
+
+	row := func(pre string, cells ...string) string {
+		return pre + ":" + strings.Join(cells, "") + "\n"
+	}
+	rep := func(s string, n int) []string {
+		c := make([]string, n)
+		for i := range c {
+			c[i] = s
+		}
+		return c
+	}
+	cat := func(c ...[]string) []string {
+		var a []string
+		for _, s := range c {
+			a = append(a, s...)
+		}
+		return a
+	}
+
+	exp := "     0  1  2  3  4  5  6  7  8  9  a  b  c  d  e  f\n" +
+		row("00", cat(rep("   ", 8), rep(" --", 8))...) +
+		row("10", rep(" --", 16)...) +
+		row("20", rep(" --", 16)...) +
+		row("30", rep(" --", 16)...) +
+		row("40", cat([]string{" 40"}, rep(" --", 15))...) +
+		row("50", rep(" --", 16)...) +
+		row("60", rep(" --", 16)...) +
+		row("70", cat(rep(" --", 7), []string{" 77"}, rep("   ", 8))...)
+
+	if str := scan.String(); exp != str {
+		t.Fatalf("unexpected grid:\n%s\n!=\n%s", str, exp)
+	}
+
+	if addr := scan.Addrs(); 2 != len(addr) || 0x40 != addr[0] || 0x77 != addr[1] {
+		t.Fatalf("unexpected addresses: %v", addr)
+	}
+}
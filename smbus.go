@@ -0,0 +1,395 @@
+package ft232h
+
+import (
+	"fmt"
+	"time"
+)
+
+// Constants defining SMBus addresses reserved by the SMBus specification.
+const (
+	SMBusHostAddr  I2CAddr = 0x08 // SMBus host, receives Host Notify messages
+	SMBusAlertAddr I2CAddr = 0x0C // SMBus Alert Response Address (ARA)
+)
+
+// SMBusBlockMax is the maximum number of data bytes in an SMBus block transfer
+// (SMBus 3.0 and later; earlier versions limit blocks to 32 bytes).
+const SMBusBlockMax = 255
+
+// SMBus performs SMBus protocol transactions with a single slave device using
+// an I²C bus (see I2CBus). If PEC is true, a Packet Error Code (CRC-8) is
+// appended to each transaction written, and verified at the end of each
+// transaction read.
+// Words are transferred least significant byte first, as required by SMBus.
+type SMBus struct {
+	bus   I2CBus
+	slave I2CAddr
+	PEC   bool // generate and verify Packet Error Codes
+}
+
+// String returns a descriptive string of an SMBus.
+func (s *SMBus) String() string {
+	return fmt.Sprintf("{ Slave: %s, PEC: %t }", s.slave, s.PEC)
+}
+
+// SMBus returns an SMBus for the given 7-bit slave address.
+// The I²C interface must be initialized before transfer.
+func (i2c *I2C) SMBus(slave I2CAddr, pec bool) (*SMBus, error) {
+	if err := slave.validate(i2c.config.reserved); nil != err {
+		return nil, err
+	}
+	return newSMBus(i2c, slave, pec)
+}
+
+// newSMBus returns an SMBus for the given 7-bit slave address on the given I²C
+// bus.
+func newSMBus(bus I2CBus, slave I2CAddr, pec bool) (*SMBus, error) {
+	if slave.Is10Bit() {
+		return nil, fmt.Errorf("invalid SMBus slave address (10-bit): %s", slave)
+	}
+	return &SMBus{bus: bus, slave: slave, PEC: pec}, nil
+}
+
+// smbusPEC returns the SMBus Packet Error Code (CRC-8, polynomial x⁸+x²+x+1) of
+// the given data, continuing from the given crc (which is 0 initially).
+func smbusPEC(crc uint8, data ...uint8) uint8 {
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if 0 != crc&0x80 {
+				crc = (crc << 1) ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// addr returns the address byte sent to the slave, with the read bit set if
+// read is true.
+func (s *SMBus) addr(read bool) uint8 {
+	if read {
+		return uint8(s.slave<<1) | 0x01
+	}
+	return uint8(s.slave << 1)
+}
+
+// checkPEC verifies the PEC received from the slave against the PEC computed
+// by the host.
+func checkPEC(recv uint8, calc uint8) error {
+	if recv != calc {
+		return fmt.Errorf("invalid PEC: 0x%02X (expected 0x%02X)", recv, calc)
+	}
+	return nil
+}
+
+// xfer performs a transaction writing the given bytes w, followed by a repeated
+// start condition and reading count bytes (if count > 0), appending or
+// verifying the PEC as needed. Returns the bytes read, excluding the PEC.
+func (s *SMBus) xfer(w []uint8, count uint) ([]uint8, error) {
+
+	var msgs []I2CMsg
+	var crc uint8
+
+	if len(w) > 0 {
+		if s.PEC {
+			crc = smbusPEC(crc, s.addr(false))
+			crc = smbusPEC(crc, w...)
+			if 0 == count {
+				w = append(append([]uint8{}, w...), crc)
+			}
+		}
+		msgs = append(msgs, I2CMsg{Addr: s.slave, Data: w})
+	}
+
+	if count > 0 {
+		n := count
+		if s.PEC {
+			n++
+		}
+		msgs = append(msgs, I2CMsg{Addr: s.slave, Read: true, Data: make([]uint8, n)})
+	}
+
+	if err := s.bus.Transfer(msgs); nil != err {
+		return nil, err
+	}
+
+	if 0 == count {
+		return nil, nil
+	}
+
+	r := msgs[len(msgs)-1].Data
+	if s.PEC {
+		crc = smbusPEC(crc, s.addr(true))
+		crc = smbusPEC(crc, r[:count]...)
+		if err := checkPEC(r[count], crc); nil != err {
+			return nil, err
+		}
+	}
+	return r[:count], nil
+}
+
+// block performs a transaction writing the given bytes w, followed by a
+// repeated start condition and reading a block of data: a byte count followed
+// by that many data bytes (and the PEC, if enabled).
+func (s *SMBus) block(w []uint8) ([]uint8, error) {
+
+	var raw []uint8 // count, data, and PEC bytes read
+	var err error
+	if i2c, ok := s.bus.(*I2C); ok {
+		raw, err = s.blockI2C(i2c, w)
+	} else {
+		raw, err = s.blockBus(w)
+	}
+	if nil != err {
+		return nil, err
+	}
+
+	count := uint(raw[0])
+	data := raw[1:]
+	if s.PEC {
+		crc := smbusPEC(0, s.addr(false))
+		crc = smbusPEC(crc, w...)
+		crc = smbusPEC(crc, s.addr(true), uint8(count))
+		crc = smbusPEC(crc, data[:count]...)
+		if err := checkPEC(data[count], crc); nil != err {
+			return nil, err
+		}
+	}
+	return data[:count], nil
+}
+
+// blockI2C performs a block read transaction (see block) on the given FT232H I²C
+// interface, returning the count, data, and PEC bytes read.
+// Since the number of bytes to read is not known in advance, the transaction is
+// split into two command streams: the first ends after reading the byte count,
+// and the second reads the data and generates the stop condition.
+func (s *SMBus) blockI2C(i2c *I2C, w []uint8) (raw []uint8, err error) {
+
+	if nil != i2c.tracer {
+		defer func(beg time.Time) {
+			i2c.traceMsgs(beg, []I2CMsg{
+				{Addr: s.slave, Data: w},
+				{Addr: s.slave, Read: true, Data: raw},
+			}, err)
+		}(time.Now())
+	}
+
+	cmd := &i2cCmd{}
+	msgs := []I2CMsg{
+		{Addr: s.slave, Data: w},
+		{Addr: s.slave, Read: true, Data: make([]uint8, 1)},
+	}
+	cmd.address(s.slave, false, false, 0)
+	for i, b := range w {
+		cmd.write(b, i2cRespDataACK, 0, i)
+	}
+	cmd.address(s.slave, true, true, 1)
+	cmd.read(true, 1, 0)
+	cmd.flush()
+
+	resp, err := i2c.exec(cmd)
+	if nil == err {
+		err = cmd.parse(msgs, resp)
+	}
+	err = i2c.fail(err)
+
+	count := uint(msgs[1].Data[0])
+	n := count
+	if s.PEC {
+		n++
+	}
+	if nil != err {
+		n = 0
+	}
+
+	// the count byte was ACKed, so the slave is sending the next byte. read at
+	// least one byte and NACK the last byte read so that the slave releases SDA
+	// before the stop condition.
+	rd := &i2cCmd{}
+	for i := uint(0); i < n || 0 == i; i++ {
+		rd.read(i+1 < n, 0, int(i))
+	}
+	rd.stop()
+	rd.flush()
+
+	resp, e := i2c.exec(rd)
+	if nil != err {
+		return nil, err
+	}
+	if nil != e {
+		return nil, i2c.fail(e)
+	}
+	if uint(len(resp)) < n {
+		return nil, fmt.Errorf("incomplete response: %d of %d bytes", len(resp), n)
+	}
+	return append([]uint8{uint8(count)}, resp[:n]...), nil
+}
+
+// blockBus performs a block read transaction (see block) with a single Transfer
+// on any other I2CBus, returning the count, data, and PEC bytes read.
+// Since the number of bytes to read is not known in advance, a block of the
+// maximum size (SMBusBlockMax) is read, and the bytes sent by the slave
+// following the block are discarded.
+func (s *SMBus) blockBus(w []uint8) ([]uint8, error) {
+
+	n := 1 + SMBusBlockMax
+	if s.PEC {
+		n++
+	}
+	msgs := []I2CMsg{
+		{Addr: s.slave, Data: w},
+		{Addr: s.slave, Read: true, Data: make([]uint8, n)},
+	}
+	if err := s.bus.Transfer(msgs); nil != err {
+		return nil, err
+	}
+
+	raw := msgs[1].Data
+	n = 1 + int(raw[0])
+	if s.PEC {
+		n++
+	}
+	return raw[:n], nil
+}
+
+// Quick sends the slave address with the read bit set to the given value bit,
+// with no data (SMBus "quick command").
+func (s *SMBus) Quick(bit bool) error {
+	return s.bus.Transfer([]I2CMsg{{Addr: s.slave, Read: bit}})
+}
+
+// SendByte writes the given byte b without a command code (SMBus "send byte").
+func (s *SMBus) SendByte(b uint8) error {
+	_, err := s.xfer([]uint8{b}, 0)
+	return err
+}
+
+// ReceiveByte reads a byte without a command code (SMBus "receive byte").
+func (s *SMBus) ReceiveByte() (uint8, error) {
+	r, err := s.xfer(nil, 1)
+	if nil != err {
+		return 0, err
+	}
+	return r[0], nil
+}
+
+// WriteByteData writes the given byte b with the given command code (SMBus
+// "write byte").
+func (s *SMBus) WriteByteData(cmd uint8, b uint8) error {
+	_, err := s.xfer([]uint8{cmd, b}, 0)
+	return err
+}
+
+// ReadByteData reads a byte with the given command code (SMBus "read byte").
+func (s *SMBus) ReadByteData(cmd uint8) (uint8, error) {
+	r, err := s.xfer([]uint8{cmd}, 1)
+	if nil != err {
+		return 0, err
+	}
+	return r[0], nil
+}
+
+// WriteWordData writes the given word w with the given command code (SMBus
+// "write word").
+func (s *SMBus) WriteWordData(cmd uint8, w uint16) error {
+	_, err := s.xfer(append([]uint8{cmd}, LSB.Bytes(2, uint64(w))...), 0)
+	return err
+}
+
+// ReadWordData reads a word with the given command code (SMBus "read word").
+func (s *SMBus) ReadWordData(cmd uint8) (uint16, error) {
+	r, err := s.xfer([]uint8{cmd}, 2)
+	if nil != err {
+		return 0, err
+	}
+	return uint16(LSB.Uint(2, r)), nil
+}
+
+// ProcessCall writes the given word w with the given command code, and reads a
+// word in response in the same transaction (SMBus "process call").
+func (s *SMBus) ProcessCall(cmd uint8, w uint16) (uint16, error) {
+	r, err := s.xfer(append([]uint8{cmd}, LSB.Bytes(2, uint64(w))...), 2)
+	if nil != err {
+		return 0, err
+	}
+	return uint16(LSB.Uint(2, r)), nil
+}
+
+// blockData returns the given command code, byte count, and data of a block
+// written to the slave.
+func blockData(cmd uint8, data []uint8) ([]uint8, error) {
+	if len(data) > SMBusBlockMax {
+		return nil, fmt.Errorf("invalid SMBus block size: %d", len(data))
+	}
+	return append([]uint8{cmd, uint8(len(data))}, data...), nil
+}
+
+// BlockWrite writes the given block of data with the given command code,
+// preceded by its byte count (SMBus "block write").
+func (s *SMBus) BlockWrite(cmd uint8, data []uint8) error {
+	w, err := blockData(cmd, data)
+	if nil != err {
+		return err
+	}
+	_, err = s.xfer(w, 0)
+	return err
+}
+
+// BlockRead reads a block of data with the given command code (SMBus "block
+// read"). The byte count is sent by the slave and is not included in the data
+// returned.
+func (s *SMBus) BlockRead(cmd uint8) ([]uint8, error) {
+	return s.block([]uint8{cmd})
+}
+
+// BlockProcessCall writes the given block of data with the given command code,
+// and reads a block of data in response in the same transaction (SMBus "block
+// write-block read process call").
+func (s *SMBus) BlockProcessCall(cmd uint8, data []uint8) ([]uint8, error) {
+	w, err := blockData(cmd, data)
+	if nil != err {
+		return nil, err
+	}
+	return s.block(w)
+}
+
+// SMBusHostNotify is a Host Notify message sent by an SMBus device, acting as
+// master, to the SMBus host address (SMBusHostAddr).
+type SMBusHostNotify struct {
+	Addr   I2CAddr // address of the device sending the message
+	Status uint16  // device-specific status word
+}
+
+// String returns a descriptive string of an SMBusHostNotify.
+func (n *SMBusHostNotify) String() string {
+	return fmt.Sprintf("{ Addr: %s, Status: 0x%04X }", n.Addr, n.Status)
+}
+
+// ParseSMBusHostNotify parses the given bytes of a Host Notify message that
+// follow the host address: the device address byte and the status word, least
+// significant byte first.
+func ParseSMBusHostNotify(msg []uint8) (*SMBusHostNotify, error) {
+	if 3 != len(msg) {
+		return nil, fmt.Errorf("invalid host notify length: %d", len(msg))
+	}
+	if 0 != msg[0]&0x01 {
+		return nil, fmt.Errorf("invalid host notify address: 0x%02X", msg[0])
+	}
+	return &SMBusHostNotify{
+		Addr:   I2CAddr(msg[0] >> 1),
+		Status: uint16(LSB.Uint(2, msg[1:])),
+	}, nil
+}
+
+// SMBusAlert reads the Alert Response Address (SMBusAlertAddr), returning the
+// address of the device asserting the SMBALERT# signal. If several devices are
+// asserting it, the device with the lowest address wins arbitration; the others
+// continue to assert SMBALERT# and must be read with subsequent calls.
+func (i2c *I2C) SMBusAlert() (I2CAddr, error) {
+	r := make([]uint8, 1)
+	if err := i2c.Tx(SMBusAlertAddr, nil, r); nil != err {
+		return 0, err
+	}
+	return I2CAddr(r[0] >> 1), nil
+}
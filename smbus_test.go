@@ -0,0 +1,129 @@
+package ft232h
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSMBusPEC(t *testing.T) {
+
+	for _, test := range []struct {
+		data []uint8
+		pec  uint8
+	}{
+		{data: []uint8{}, pec: 0x00},
+		{data: []uint8("123456789"), pec: 0xF4},
+		{data: []uint8{0x00}, pec: 0x00},
+		{data: []uint8{0xFF}, pec: 0xF3},
+	} {
+		t.Run(fmt.Sprintf("% X", test.data), func(s *testing.T) {
+			if pec := smbusPEC(0, test.data...); test.pec != pec {
+				s.Fatalf("unexpected PEC: 0x%02X != 0x%02X", pec, test.pec)
+			}
+			// computing incrementally must yield the same result
+			crc := uint8(0)
+			for _, b := range test.data {
+				crc = smbusPEC(crc, b)
+			}
+			if test.pec != crc {
+				s.Fatalf("unexpected incremental PEC: 0x%02X != 0x%02X", crc, test.pec)
+			}
+		})
+	}
+}
+
+func TestSMBusBlockData(t *testing.T) {
+
+	if w, err := blockData(0x10, []uint8{0xAA, 0xBB}); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	} else if "[16 2 170 187]" != fmt.Sprint(w) {
+		t.Fatalf("unexpected block: %v", w)
+	}
+	if _, err := blockData(0x10, make([]uint8, SMBusBlockMax+1)); nil == err {
+		t.Fatalf("expected error for oversized block")
+	}
+}
+
+func TestParseSMBusHostNotify(t *testing.T) {
+
+	for _, test := range []struct {
+		msg    []uint8
+		addr   I2CAddr
+		status uint16
+		ok     bool
+	}{
+		{msg: []uint8{0x50, 0x34, 0x12}, addr: 0x28, status: 0x1234, ok: true},
+		{msg: []uint8{0x51, 0x34, 0x12}, ok: false},
+		{msg: []uint8{0x50, 0x34}, ok: false},
+	} {
+		t.Run(fmt.Sprintf("% X", test.msg), func(s *testing.T) {
+			n, err := ParseSMBusHostNotify(test.msg)
+			if test.ok != (nil == err) {
+				s.Fatalf("unexpected result: %v", err)
+			}
+			if test.ok && (test.addr != n.Addr || test.status != n.Status) {
+				s.Fatalf("unexpected host notify: %s", n)
+			}
+		})
+	}
+}
+
+// testSMBusBus is an I2CBus that records the transfers written to it and fills
+// the data of read messages with the given bytes.
+type testSMBusBus struct {
+	testI2CBus
+	read []uint8
+}
+
+func (b *testSMBusBus) Transfer(msgs []I2CMsg) error {
+	for _, m := range msgs {
+		if m.Read {
+			for i := range m.Data {
+				m.Data[i] = 0xFF // released SDA
+			}
+			copy(m.Data, b.read)
+		}
+	}
+	return b.testI2CBus.Transfer(msgs)
+}
+
+func TestSMBusBus(t *testing.T) {
+
+	// block read of 2 bytes, followed by its PEC
+	block := []uint8{0x02, 0xAA, 0xBB}
+	pec := smbusPEC(0, 0x80, 0x10, 0x81)
+	pec = smbusPEC(pec, block...)
+
+	bus := &testSMBusBus{read: append(block, pec)}
+	s, err := newSMBus(bus, 0x40, true)
+	if nil != err {
+		t.Fatalf("newSMBus(): %v", err)
+	}
+	data, err := s.BlockRead(0x10)
+	if nil != err {
+		t.Fatalf("BlockRead(): %v", err)
+	}
+	if "[170 187]" != fmt.Sprint(data) {
+		t.Fatalf("unexpected block: %v", data)
+	}
+	exp := fmt.Sprint([]string{"T 0x40 false 1",
+		fmt.Sprintf("T 0x40 true %d", SMBusBlockMax+2)})
+	if exp != fmt.Sprint(bus.log) {
+		t.Fatalf("unexpected transfers: %v", bus.log)
+	}
+
+	bus.read[3] ^= 0xFF
+	if _, err := s.BlockRead(0x10); nil == err {
+		t.Fatalf("expected PEC error")
+	}
+
+	s.PEC = false
+	bus.read = []uint8{0x34, 0x12}
+	if w, err := s.ReadWordData(0x20); nil != err || 0x1234 != w {
+		t.Fatalf("unexpected word: 0x%04X (%v)", w, err)
+	}
+
+	if _, err := newSMBus(bus, I2CAddr10(0x123), false); nil == err {
+		t.Fatalf("expected error for 10-bit address")
+	}
+}
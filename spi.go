@@ -1,7 +1,11 @@
 package ft232h
 
 import (
+	"errors"
 	"fmt"
+	"math/bits"
+	"sync"
+	"time"
 )
 
 // SPI stores interface configuration settings for an SPI master and provides
@@ -9,8 +13,12 @@ import (
 // The interface must be initialized by calling either Init or Config (not both)
 // before use.
 type SPI struct {
-	device *FT232H
-	config *spiConfig
+	device   *FT232H
+	config   *spiConfig
+	selected bool       // CS line currently asserted
+	tracer   Tracer     // records each transfer, if non-nil (see Trace)
+	devLock  sync.Mutex // serializes the transfers of each SPIDevice
+	active   *SPIDevice // device whose settings are in use, if any
 }
 
 // String returns a descriptive string of an SPI interface.
@@ -22,8 +30,9 @@ func (spi *SPI) String() string {
 // interface.
 type SPIConfig struct {
 	*SPIOption
-	Clock   uint32 // valid range: 0-30000000 (30 MHz)
-	Latency byte   // 1-255 USB HiSpeed, 2-255 USB FullSpeed
+	Clock    uint32        // valid range: 0-30000000 (30 MHz)
+	Latency  byte          // 1-255 USB HiSpeed, 2-255 USB FullSpeed
+	Rounding ClockRounding // policy used when Clock is not exactly possible
 }
 
 // SPIConfigDefault returns the default configuration settings for an SPI
@@ -33,6 +42,9 @@ func SPIConfigDefault() *SPIConfig {
 }
 
 // SPIConfig returns the current configuration settings of the SPI receiver.
+// The Clock field contains the effective clock rate generated by the MPSSE
+// engine, which may differ from the clock rate requested with Config (see type
+// ClockRounding).
 func (spi *SPI) GetConfig() *SPIConfig {
 	return spi.config.SPIConfig()
 }
@@ -44,14 +56,38 @@ const (
 	SPILatencyDefault byte   = 2
 )
 
+// spiClockPhases is the number of MPSSE clock phases per SPI data bit.
+const spiClockPhases = 2
+
+// spiClock returns the MPSSE clock settings used to generate the given SPI
+// clock rate with the given rounding policy. If the given rate is 0, the default
+// clock rate is used.
+func spiClock(rate uint32, round ClockRounding) (mpsseClock, error) {
+	if 0 == rate {
+		rate = SPIClockDefault
+	}
+	if rate > SPIClockMaximum {
+		return mpsseClock{}, fmt.Errorf("invalid clock rate: %d", rate)
+	}
+	return newMPSSEClock(rate, spiClockPhases, round)
+}
+
 // spiConfig holds all of the configuration settings for an SPI channel stored
 // privately in each instance of SPI.
 type spiConfig struct {
-	clockRate  uint32 // in Hertz
-	latency    uint8  // in ms
+	clockRate  uint32        // effective clock rate, in Hertz
+	clock      mpsseClock    // MPSSE clock settings generating clockRate
+	rounding   ClockRounding // policy used to select clock
+	latency    uint8         // in ms
 	options    spiOption
-	pin        uint32 // port D pins ("low byte lines of MPSSE")
-	chipSelect Pin    // may be DPin (MPSSE low byte) or CPin (GPIO)
+	pin        uint32        // port D pins ("low byte lines of MPSSE")
+	chipSelect Pin           // may be DPin (MPSSE low byte) or CPin (GPIO)
+	lsbFirst   bool          // transfer least significant bit of each byte first
+	csSetup    time.Duration // minimum delay from CS assertion to first clock
+	csHold     time.Duration // minimum delay from last clock to CS de-assertion
+	byteDelay  time.Duration // minimum delay between consecutive bytes
+	selector   ChipSelect    // CS strategy for many slaves (overrides chipSelect)
+	slave      uint          // slave index selected with selector
 }
 
 func (c spiConfig) String() string {
@@ -64,20 +100,26 @@ func (c spiConfig) String() string {
 	}
 
 	return fmt.Sprintf("{ Clock: \"%.*f %s\", Latency: \"%d ms\", Options: %s, "+
-		"Pin: %032b, ChipSelect: %q }",
-		pr, cr, rs, c.latency, c.options, c.pin, c.chipSelect)
+		"Pin: %032b, ChipSelect: %q, LSBFirst: %t, CSSetup: %q, CSHold: %q, "+
+		"ByteDelay: %q, Select: %v, Slave: %d }",
+		pr, cr, rs, c.latency, c.options, c.pin, c.chipSelect, c.lsbFirst,
+		c.csSetup, c.csHold, c.byteDelay, c.selector, c.slave)
 }
 
 // spiConfigDefault returns an spiConfig struct stored in the private
 // configuration field of an SPI instance with the default settings for all
 // fields.
 func spiConfigDefault() *spiConfig {
+	clock, _ := newMPSSEClock(SPIClockDefault, spiClockPhases, ClockRoundingDefault)
 	return &spiConfig{
-		clockRate:  SPIClockDefault,
+		clockRate:  clock.rate(),
+		clock:      clock,
+		rounding:   ClockRoundingDefault,
 		latency:    SPILatencyDefault,
 		options:    spiOptionDefault,
 		pin:        spiPinConfigDefault(),
 		chipSelect: spiCSDefault.cs(),
+		lsbFirst:   spiLSBFirstDefault,
 	}
 }
 
@@ -86,12 +128,19 @@ func spiConfigDefault() *spiConfig {
 func (c *spiConfig) SPIConfig() *SPIConfig {
 	return &SPIConfig{
 		SPIOption: &SPIOption{
-			CS:        c.options.cs(),
+			CS:        c.chipSelect,
 			ActiveLow: c.options.activeLow(),
 			Mode:      c.options.mode(),
+			LSBFirst:  c.lsbFirst,
+			CSSetup:   c.csSetup,
+			CSHold:    c.csHold,
+			ByteDelay: c.byteDelay,
+			Select:    c.selector,
+			Slave:     c.slave,
 		},
-		Clock:   c.clockRate,
-		Latency: c.latency,
+		Clock:    c.clockRate,
+		Latency:  c.latency,
+		Rounding: c.rounding,
 	}
 }
 
@@ -105,10 +154,31 @@ func (c *spiConfig) SPIConfig() *SPIConfig {
 // stop. In both cases, the current value of the ActiveLow flag determines if
 // the CS line driven LOW (ActiveLow true, DEFAULT) or HIGH (ActiveLow false)
 // when asserting and then de-asserting.
+//
+// The CS timing options CSSetup, CSHold, and ByteDelay define minimum delays
+// required by some (slow) SPI slave devices: from CS assertion to the first
+// clock, from the last clock to CS de-assertion, and between consecutive bytes,
+// respectively. If any of these are non-zero, the CS line is always controlled
+// manually, and the delays are generated on the bus by the MPSSE engine by
+// repeating commands that do not change any pins, in the same USB transfer as
+// the data. This makes them suitable for delays in the microsecond range, but
+// each delay adds to the size of the transfer, so leave them zero (DEFAULT)
+// unless required.
+//
+// If Select is non-nil, the CS line of slave device index Slave is controlled
+// with the given ChipSelect strategy (e.g., a decoder driven by GPIO pins)
+// instead of pin CS, which is then ignored (and may be nil). The ActiveLow flag
+// is also ignored, since the strategy defines its own polarity.
 type SPIOption struct {
-	CS        Pin  // CS pin to assert when writing (can be DPin or CPin (GPIO))
-	ActiveLow bool // CS asserted "active" by driving pin LOW or HIGH
-	Mode      byte // SPI operating mode (mode 0 and 2 support only)
+	CS        Pin           // CS pin to assert when writing (can be DPin or CPin (GPIO))
+	ActiveLow bool          // CS asserted "active" by driving pin LOW or HIGH
+	Mode      byte          // SPI operating mode (mode 0 and 2 support only)
+	LSBFirst  bool          // transfer least significant bit of each byte first
+	CSSetup   time.Duration // minimum delay from CS assertion to first clock
+	CSHold    time.Duration // minimum delay from last clock to CS de-assertion
+	ByteDelay time.Duration // minimum delay between consecutive bytes
+	Select    ChipSelect    // CS strategy for many slaves (overrides CS if non-nil)
+	Slave     uint          // slave index selected with Select
 }
 
 // spiOption stores the various SPI configuration options as a 32-bit bitmap.
@@ -250,10 +320,39 @@ const (
 	spiCSAssert   spiXferOption = 0x00000002 // assert CS before start
 	spiCSDeAssert spiXferOption = 0x00000004 // deassert CS after end
 
+	spiXferMSB spiXferOption = 0x00000000 // most significant bit first
+	spiXferLSB spiXferOption = 0x00000008 // least significant bit first
+
 	// default transfer options
-	spiXferDefault = spiXferBytes | spiCSManual
+	spiXferDefault = spiXferBytes | spiCSManual | spiXferMSB
+)
+
+// autoCS returns true if the CS line can be asserted and de-asserted by the
+// MPSSE engine as part of each transfer, which requires a DPin CS without any
+// ChipSelect strategy or CS timing options.
+func (c *spiConfig) autoCS() bool {
+	return nil == c.selector && c.chipSelect.IsMPSSE() &&
+		0 == c.csSetup && 0 == c.csHold && 0 == c.byteDelay
+}
+
+// spiMISOMask is the bitmask of the MISO line (D2) in the value of port D.
+const spiMISOMask = uint8(1) << 2
+
+// Constants defining the default bit order of SPI transfers.
+const (
+	spiLSBFirstDefault = false
 )
 
+// xferOption returns the default transfer options combined with those derived
+// from the dynamic configuration settings of the spiConfig receiver c.
+func (c *spiConfig) xferOption() spiXferOption {
+	opt := spiXferDefault
+	if c.lsbFirst {
+		opt |= spiXferLSB
+	}
+	return opt
+}
+
 // Change changes the currently configured CS pin.
 // It can be called while the SPI interface is open without having to first
 // close and reopen the device.
@@ -261,6 +360,8 @@ const (
 // Write for details.
 func (spi *SPI) Change(cs Pin) error {
 
+	spi.active = nil
+
 	// clear current CS selection
 	spi.config.options &= ^(spiCSMask)
 
@@ -292,6 +393,8 @@ func (spi *SPI) Change(cs Pin) error {
 // close and reopen the device.
 func (spi *SPI) Option(opt *SPIOption) error {
 
+	spi.active = nil
+
 	activeOpt := spiCSActiveHigh
 	if opt.ActiveLow {
 		activeOpt = spiCSActiveLow
@@ -302,9 +405,31 @@ func (spi *SPI) Option(opt *SPIOption) error {
 		return fmt.Errorf("invalid SPI mode: Mode %d", opt.Mode)
 	}
 
-	spi.config.options = activeOpt | modeOpt
+	if opt.CSSetup < 0 || opt.CSHold < 0 || opt.ByteDelay < 0 {
+		return fmt.Errorf("invalid CS timing: CSSetup %s, CSHold %s, ByteDelay %s",
+			opt.CSSetup, opt.CSHold, opt.ByteDelay)
+	}
 
-	return spi.Change(opt.CS)
+	cs := opt.CS
+	if nil != opt.Select {
+		if err := validSlave(opt.Select, opt.Slave); nil != err {
+			return err
+		}
+		if nil == cs {
+			// libMPSSE still requires a CS pin, even though it is never toggled
+			cs = spiCSDefault.cs()
+		}
+	}
+
+	spi.config.options = activeOpt | modeOpt
+	spi.config.lsbFirst = opt.LSBFirst
+	spi.config.csSetup = opt.CSSetup
+	spi.config.csHold = opt.CSHold
+	spi.config.byteDelay = opt.ByteDelay
+	spi.config.selector = opt.Select
+	spi.config.slave = opt.Slave
+
+	return spi.Change(cs)
 }
 
 // Config initializes the SPI interface with the given configuration to a state
@@ -319,15 +444,13 @@ func (spi *SPI) Config(cfg *SPIConfig) error {
 		cfg = SPIConfigDefault()
 	}
 
-	if 0 == cfg.Clock {
-		spi.config.clockRate = SPIClockDefault
-	} else {
-		if cfg.Clock <= SPIClockMaximum {
-			spi.config.clockRate = cfg.Clock
-		} else {
-			return fmt.Errorf("invalid clock rate: %d", cfg.Clock)
-		}
+	clock, err := spiClock(cfg.Clock, cfg.Rounding)
+	if nil != err {
+		return err
 	}
+	spi.config.clockRate = clock.rate()
+	spi.config.clock = clock
+	spi.config.rounding = cfg.Rounding
 
 	if 0 == cfg.Latency {
 		spi.config.latency = SPILatencyDefault
@@ -363,40 +486,428 @@ func (spi *SPI) Close() error {
 	return spi.device.Close()
 }
 
-// Read reads the given count number of bytes from the SPI interface.
-// There is no maximum length for the number of bytes to read.
+// spiPadPeriod is the minimum time taken by the MPSSE engine to execute a
+// set-pins command, which is repeated to delay the commands that follow it on
+// the bus: each command is 3 bytes long, and at most one byte is processed per
+// cycle of the 60 MHz master clock.
+const spiPadPeriod = 50 * time.Nanosecond
+
+// Constants related to SPI transfers with manual CS control.
+const (
+	spiShiftMax = 65536 // maximum number of bytes per data shifting command
+	spiCmdMax   = 65536 // command buffer size after which commands are sent
+)
+
+// spiCmd accumulates the MPSSE commands of an SPI transfer with manual CS
+// control, so that CS changes, delays, and data are sent in a single USB write.
+type spiCmd struct {
+	buf  []uint8
+	pins []uint8     // most recent set-pins command, repeated as padding
+	in   [][]uint8   // buffers receiving the bytes read by the commands
+	size uint        // number of bytes read by the commands
+	xfer uint        // number of bytes shifted by the commands
+	gpio *GPIOConfig // GPIO configuration once executed, if changed
+	cs   []bool      // CS line asserted once executed, if changed
+}
+
+// set appends a command setting the value and direction of the pins of port D
+// (if op is mpsseSetDataBitsLowByte) or port C (if mpsseSetDataBitsHighByte).
+func (c *spiCmd) set(op uint8, val uint8, dir uint8) {
+	c.pins = []uint8{op, val, dir}
+	c.buf = append(c.buf, c.pins...)
+}
+
+// pad appends commands that delay the commands that follow by at least the
+// given duration d, by repeating the most recent set-pins command.
+func (c *spiCmd) pad(d time.Duration) {
+	for t := time.Duration(0); t < d; t += spiPadPeriod {
+		c.buf = append(c.buf, c.pins...)
+	}
+}
+
+// shift appends the given data shifting command op, which writes the bytes of
+// out (if non-nil) and reads the bytes into in (if non-nil). If both are
+// non-nil, they must have equal length.
+func (c *spiCmd) shift(op uint8, out []uint8, in []uint8) {
+	n := uint(len(out))
+	if nil == out {
+		n = uint(len(in))
+	}
+	if 0 == n {
+		return
+	}
+	lo, hi := mpsseLen(n)
+	c.buf = append(c.buf, op, lo, hi)
+	c.buf = append(c.buf, out...)
+	if nil != in {
+		c.in = append(c.in, in)
+		c.size += n
+	}
+	c.xfer += n
+}
+
+// get appends a command reading the value of the pins of port D (if op is
+// mpsseGetDataBitsLowByte) or port C (if mpsseGetDataBitsHighByte) into the
+// first byte of in.
+func (c *spiCmd) get(op uint8, in []uint8) {
+	c.buf = append(c.buf, op)
+	c.in = append(c.in, in[:1])
+	c.size++
+}
+
+// reset discards all commands, keeping the most recent set-pins command.
+func (c *spiCmd) reset() {
+	c.buf, c.in, c.size, c.xfer, c.gpio, c.cs = c.buf[:0], nil, 0, 0, nil, nil
+}
+
+// dataOp returns the MPSSE data shifting command used to write and/or read
+// bytes in the configured SPI mode and bit order.
+func (c *spiConfig) dataOp(write bool, read bool) uint8 {
+	var op uint8
+	// modes 0 and 3 capture data on the rising edge and propagate on the falling
+	// edge, modes 1 and 2 the opposite.
+	rise := spiMode0 == spiOption(c.options.mode()) ||
+		spiMode3 == spiOption(c.options.mode())
+	switch {
+	case write && read && rise:
+		op = mpsseDataBytesInPosOutNeg
+	case write && read:
+		op = mpsseDataBytesInNegOutPos
+	case write && rise:
+		op = mpsseDataOutBytesNegEdge
+	case write:
+		op = mpsseDataOutBytesPosEdge
+	case rise:
+		op = mpsseDataInBytesPosEdge
+	default:
+		op = mpsseDataInBytesNegEdge
+	}
+	if c.lsbFirst {
+		op |= mpsseDataLSBFirst
+	}
+	return op
+}
+
+// lowByte returns the value and direction of the port D pins with SCLK at its
+// idle level and, if the CS pin is a DPin, with CS asserted (if assert is true)
+// or de-asserted (if assert is false).
+func (c *spiConfig) lowByte(assert bool) (val uint8, dir uint8) {
+	dir, val = uint8(c.pin), uint8(c.pin>>8)
+	// SCLK idles HIGH in modes 2 and 3 (CPOL=1)
+	if 0 != c.options.mode()&uint8(spiMode2) {
+		val |= D(0).Mask()
+	} else {
+		val &^= D(0).Mask()
+	}
+	if cs, ok := c.chipSelect.(DPin); ok && nil == c.selector {
+		dir |= cs.Mask()
+		if assert != c.options.activeLow() {
+			val |= cs.Mask()
+		} else {
+			val &^= cs.Mask()
+		}
+	}
+	return val, dir
+}
+
+// cmd returns a new spiCmd whose padding repeats the current state of port D.
+func (spi *SPI) cmd() *spiCmd {
+	val, dir := spi.config.lowByte(spi.selected)
+	return &spiCmd{pins: []uint8{mpsseSetDataBitsLowByte, val, dir}}
+}
+
+// exec sends the commands in c to the MPSSE engine, copies the bytes read by
+// the commands into their buffers, and then resets c. Returns the number of
+// bytes shifted by the commands, and a non-nil error if unsuccessful.
+func (spi *SPI) exec(c *spiCmd) (uint, error) {
+	defer c.reset()
+	if 0 == len(c.buf) {
+		return 0, nil
+	}
+	buf := c.buf
+	if c.size > 0 {
+		buf = append(buf, mpsseSendImmediate)
+	}
+	if _, err := _FT_Write(spi.device.info, buf); nil != err {
+		return 0, err
+	}
+	if nil != c.gpio {
+		spi.device.GPIO.config.Write(c.gpio.Dir, c.gpio.Val)
+	}
+	if nil != c.cs {
+		spi.selected = c.cs[0]
+	}
+	if c.size > 0 {
+		data, err := _FT_Read(spi.device.info, c.size)
+		if nil != err {
+			return 0, err
+		}
+		for _, in := range c.in {
+			data = data[copy(in, data):]
+		}
+	}
+	return c.xfer, nil
+}
+
+// chipSelect appends commands to c that assert (if assert is true) or de-assert
+// (if assert is false) the currently configured CS line, using the currently
+// configured CS polarity.
+// If a ChipSelect strategy is configured, the CS line of the configured slave
+// index is changed with the sequence of port C (GPIO) values of that strategy.
+// Otherwise, if the CS pin is a DPin, the value of port D is changed, or else
+// the CS pin is a CPin, and the value of port C (GPIO) is changed.
+func (spi *SPI) chipSelect(c *spiCmd, assert bool) error {
+
+	c.cs = []bool{assert}
+
+	cs, sel := spi.config.chipSelect, spi.config.selector
+	if nil == sel && cs.IsMPSSE() {
+		val, dir := spi.config.lowByte(assert)
+		c.set(mpsseSetDataBitsLowByte, val, dir)
+		return nil
+	}
+
+	var seq []uint8
+	cfg := *spi.device.GPIO.config
+	if nil != sel {
+		var err error
+		if seq, err = sel.Sequence(&cfg, spi.config.slave, assert); nil != err {
+			return err
+		}
+	} else {
+		// drive the pin HIGH to assert CS if active-high, or LOW if active-low
+		if err := cfg.Set(cs.(CPin), Output, assert != spi.config.options.activeLow()); nil != err {
+			return err
+		}
+		seq = []uint8{cfg.Val}
+	}
+	// set only the pins configured as OUTPUT (see GPIO.Write)
+	for _, val := range seq {
+		c.set(mpsseSetDataBitsHighByte, val&cfg.Dir, cfg.Dir)
+	}
+	cfg.Val &= cfg.Dir
+	c.gpio = &cfg
+	return nil
+}
+
+// assert appends commands to c that assert the CS line, followed by the
+// configured CSSetup delay.
+func (spi *SPI) assert(c *spiCmd) error {
+	if err := spi.chipSelect(c, true); nil != err {
+		return err
+	}
+	c.pad(spi.config.csSetup)
+	return nil
+}
+
+// deassert appends commands to c that wait for the configured CSHold delay,
+// followed by de-asserting the CS line.
+func (spi *SPI) deassert(c *spiCmd) error {
+	c.pad(spi.config.csHold)
+	return spi.chipSelect(c, false)
+}
+
+// Select asserts the currently configured CS line, using the currently
+// configured CS polarity, followed by the configured CSSetup delay.
+// The CS line remains asserted until Deselect is called, or until a transfer is
+// performed with its stop argument true. This allows a transaction to span any
+// number of transfers, each performed with both start and stop false.
+func (spi *SPI) Select() error {
+	c := spi.cmd()
+	if err := spi.assert(c); nil != err {
+		return err
+	}
+	_, err := spi.exec(c)
+	return err
+}
+
+// Deselect de-asserts the currently configured CS line, using the currently
+// configured CS polarity, after the configured CSHold delay.
+func (spi *SPI) Deselect() error {
+	c := spi.cmd()
+	if err := spi.deassert(c); nil != err {
+		return err
+	}
+	_, err := spi.exec(c)
+	return err
+}
+
+// MISO returns the level of the MISO line (true if HIGH, false if LOW) while
+// the currently configured CS line is asserted, without clocking the bus. This
+// can be used to poll slaves that signal a busy/ready state on MISO, whose
+// polarity is defined by the slave (e.g., SD cards hold MISO LOW while busy).
+// If the CS line is not already asserted (see Select), it is asserted only for
+// the duration of the poll. Otherwise, the CS line remains asserted.
+func (spi *SPI) MISO() (bool, error) {
+
+	in := make([]uint8, 1)
+	c, err := spi.misoCmd(in)
+	if nil != err {
+		return false, err
+	}
+	if _, err := spi.exec(c); nil != err {
+		return false, err
+	}
+	return 0 != in[0]&spiMISOMask, nil
+}
+
+// misoCmd returns the commands that read the value of port D, including the
+// MISO line, into the first byte of in. If the CS line is not already asserted,
+// the commands assert the CS line before and de-assert it after the read.
+func (spi *SPI) misoCmd(in []uint8) (*spiCmd, error) {
+
+	sel := spi.selected
+	c := spi.cmd()
+	if !sel {
+		if err := spi.assert(c); nil != err {
+			return nil, err
+		}
+	}
+	c.get(mpsseGetDataBitsLowByte, in)
+	if !sel {
+		if err := spi.deassert(c); nil != err {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// manual performs an SPI transfer with manual CS control, writing the bytes of
+// out (if non-nil) and/or reading bytes into in (if non-nil), and returns the
+// number of bytes successfully transferred. If both are non-nil, they must have
+// equal length.
 // If start is true, the CS line is asserted before transfer.
 // If stop is true, the CS line is de-asserted after transfer.
-// Returns the slice of bytes successfully read and a non-nil error if there was
-// an error.
-func (spi *SPI) Read(count uint, start bool, stop bool) ([]uint8, error) {
-
-	cs := spi.config.chipSelect
-	opt := spiXferDefault
-	ass := 0 == uint32(spiCSActiveLow&spi.config.options)
+// The CS timing options (CSSetup, CSHold, ByteDelay) are padded with commands
+// executed by the MPSSE engine between the CS changes and data, so that the
+// delays are guaranteed minimums on the bus regardless of USB latency.
+func (spi *SPI) manual(out []uint8, in []uint8, start bool, stop bool) (n uint, err error) {
+
+	count := uint(len(out))
+	if nil == out {
+		count = uint(len(in))
+	}
+	op := spi.config.dataOp(nil != out, nil != in)
 
+	c := spi.cmd()
 	if start {
-		if cs.IsMPSSE() {
-			opt |= spiCSAssert
-		} else {
-			opt &= ^spiCSAssert
-			if err := spi.device.GPIO.Set(cs.(CPin), ass); nil != err {
-				return nil, err
+		if err := spi.assert(c); nil != err {
+			return 0, err
+		}
+	}
+
+	for beg := uint(0); beg < count; {
+		if beg = spi.data(c, op, out, in, beg); beg < count {
+			k, err := spi.exec(c)
+			if nil != err {
+				return n, err
 			}
+			n += k
 		}
 	}
 
 	if stop {
-		if cs.IsMPSSE() {
-			opt |= spiCSDeAssert
-		} else {
-			opt &= ^spiCSDeAssert
-			// deassert on return
-			defer func() { spi.device.GPIO.Set(cs.(CPin), !ass) }()
+		if err := spi.deassert(c); nil != err {
+			return n, err
+		}
+	}
+	k, err := spi.exec(c)
+	if nil != err {
+		return n, err
+	}
+	return n + k, nil
+}
+
+// data appends data shifting commands op to c, which write the bytes of out
+// (if non-nil) and/or read bytes into in (if non-nil), beginning at position
+// beg, with the configured ByteDelay between consecutive bytes. Commands are
+// appended until all bytes are shifted or the buffer of c is full, and the
+// position following the last byte shifted is returned.
+func (spi *SPI) data(c *spiCmd, op uint8, out []uint8, in []uint8, beg uint) uint {
+
+	count := uint(len(out))
+	if nil == out {
+		count = uint(len(in))
+	}
+	delay := spi.config.byteDelay
+
+	for beg < count && len(c.buf) < spiCmdMax {
+		end := count
+		if delay > 0 {
+			if beg > 0 {
+				c.pad(delay)
+			}
+			end = beg + 1
+		} else if end-beg > spiShiftMax {
+			end = beg + spiShiftMax
+		}
+		var o, i []uint8
+		if nil != out {
+			o = out[beg:end]
+		}
+		if nil != in {
+			i = in[beg:end]
 		}
+		c.shift(op, o, i)
+		beg = end
+	}
+	return beg
+}
+
+// xfer performs an SPI transfer of count bytes using the given function fn,
+// with CS on a DPin asserted/de-asserted by the MPSSE engine as part of the
+// transfer itself (see autoCS). The function must transfer the bytes at
+// positions beg (inclusive) through end (exclusive) using the given transfer
+// options, and return the number of bytes successfully transferred.
+// If start is true, the CS line is asserted before transfer.
+// If stop is true, the CS line is de-asserted after transfer.
+func (spi *SPI) xfer(count uint, start bool, stop bool,
+	fn func(beg uint, end uint, opt spiXferOption) (uint, error)) (uint, error) {
+
+	opt := spi.config.xferOption()
+	if start {
+		opt |= spiCSAssert
+		spi.selected = true
+	}
+	if stop {
+		opt |= spiCSDeAssert
+		defer func() { spi.selected = false }()
+	}
+	return fn(0, count, opt)
+}
+
+// Read reads the given count number of bytes from the SPI interface.
+// There is no maximum length for the number of bytes to read.
+// If start is true, the CS line is asserted before transfer.
+// If stop is true, the CS line is de-asserted after transfer.
+// Returns the slice of bytes successfully read and a non-nil error if there was
+// an error.
+func (spi *SPI) Read(count uint, start bool, stop bool) (_ []uint8, err error) {
+
+	data := make([]uint8, count)
+
+	var n uint
+	if nil != spi.tracer {
+		defer func(beg time.Time) {
+			spi.trace(beg, &TraceEvent{Op: TraceRead,
+				Start: start, Stop: stop, Rx: data[:n], Count: n, Err: err})
+		}(time.Now())
 	}
 
-	return _SPI_Read(spi, count, opt)
+	if !spi.config.autoCS() {
+		n, err = spi.manual(nil, data, start, stop)
+	} else {
+		n, err = spi.xfer(count, start, stop,
+			func(beg uint, end uint, opt spiXferOption) (uint, error) {
+				recv, err := _SPI_Read(spi, end-beg, opt)
+				return uint(copy(data[beg:end], recv)), err
+			})
+	}
+
+	if nil != err {
+		return data[:n], err
+	}
+	return data, nil
 }
 
 // ReadFrom returns the result of Read after configuring the active CS line.
@@ -419,34 +930,22 @@ func (spi *SPI) ReadFrom(cs Pin, count uint, start bool, stop bool) ([]uint8, er
 // If stop is true, the CS line is de-asserted after transfer.
 // Returns the slice of bytes successfully written and a non-nil error if there
 // was an error.
-func (spi *SPI) Write(data []uint8, start bool, stop bool) (uint, error) {
+func (spi *SPI) Write(data []uint8, start bool, stop bool) (n uint, err error) {
 
-	cs := spi.config.chipSelect
-	opt := spiXferDefault
-	ass := 0 == uint32(spiCSActiveLow&spi.config.options)
-
-	if start {
-		if cs.IsMPSSE() {
-			opt |= spiCSAssert
-		} else {
-			opt &= ^spiCSAssert
-			if err := spi.device.GPIO.Set(cs.(CPin), ass); nil != err {
-				return 0, err
-			}
-		}
+	if nil != spi.tracer {
+		defer func(beg time.Time) {
+			spi.trace(beg, &TraceEvent{Op: TraceWrite,
+				Start: start, Stop: stop, Tx: data, Count: n, Err: err})
+		}(time.Now())
 	}
 
-	if stop {
-		if cs.IsMPSSE() {
-			opt |= spiCSDeAssert
-		} else {
-			opt &= ^spiCSDeAssert
-			// deassert on return
-			defer func() { spi.device.GPIO.Set(cs.(CPin), !ass) }()
-		}
+	if !spi.config.autoCS() {
+		return spi.manual(data, nil, start, stop)
 	}
-
-	return _SPI_Write(spi, data, opt)
+	return spi.xfer(uint(len(data)), start, stop,
+		func(beg uint, end uint, opt spiXferOption) (uint, error) {
+			return _SPI_Write(spi, data[beg:end], opt)
+		})
 }
 
 // WriteTo returns the result of Write after configuring the active CS line.
@@ -471,34 +970,52 @@ func (spi *SPI) WriteTo(cs Pin, data []uint8, start bool, stop bool) (uint, erro
 // If stop is true, the CS line is de-asserted after transfer.
 // Returns the slice of bytes successfully read and a non-nil error if there was
 // an error.
-func (spi *SPI) Swap(data []uint8, start bool, stop bool) ([]uint8, error) {
+func (spi *SPI) Swap(data []uint8, start bool, stop bool) (_ []uint8, err error) {
 
-	cs := spi.config.chipSelect
-	opt := spiXferDefault
-	ass := 0 == uint32(spiCSActiveLow&spi.config.options)
+	recv := make([]uint8, len(data))
 
-	if start {
-		if cs.IsMPSSE() {
-			opt |= spiCSAssert
-		} else {
-			opt &= ^spiCSAssert
-			if err := spi.device.GPIO.Set(cs.(CPin), ass); nil != err {
-				return nil, err
-			}
-		}
+	var n uint
+	if nil != spi.tracer {
+		defer func(beg time.Time) {
+			spi.trace(beg, &TraceEvent{Op: TraceSwap, Start: start, Stop: stop,
+				Tx: data, Rx: recv[:n], Count: n, Err: err})
+		}(time.Now())
 	}
 
-	if stop {
-		if cs.IsMPSSE() {
-			opt |= spiCSDeAssert
-		} else {
-			opt &= ^spiCSDeAssert
-			// deassert on return
-			defer func() { spi.device.GPIO.Set(cs.(CPin), !ass) }()
+	if !spi.config.autoCS() {
+		n, err = spi.manual(data, recv, start, stop)
+		if nil != err {
+			return recv[:n], err
 		}
+		return recv, nil
 	}
 
-	return _SPI_Swap(spi, data, opt)
+	n, err = spi.xfer(uint(len(data)), start, stop,
+		func(beg uint, end uint, opt spiXferOption) (uint, error) {
+			if 0 == opt&spiXferLSB {
+				swap, err := _SPI_Swap(spi, data[beg:end], opt)
+				return uint(copy(recv[beg:end], swap)), err
+			}
+			// libMPSSE cannot shift LSB first in full-duplex transfers, so the bits
+			// of each byte are reversed before and after an MSB-first transfer.
+			swap, err := _SPI_Swap(spi, spiReverse(data[beg:end]), opt&^spiXferLSB)
+			return uint(copy(recv[beg:end], spiReverse(swap))), err
+		})
+
+	if nil != err {
+		return recv[:n], err
+	}
+	return recv, nil
+}
+
+// spiReverse returns a copy of the given data with the bit order of each byte
+// reversed.
+func spiReverse(data []uint8) []uint8 {
+	rev := make([]uint8, len(data))
+	for i, b := range data {
+		rev[i] = bits.Reverse8(b)
+	}
+	return rev
 }
 
 // SwapWith returns the result of Swap after configuring the active CS line.
@@ -514,3 +1031,475 @@ func (spi *SPI) SwapWith(cs Pin, data []uint8, start bool, stop bool) ([]uint8,
 	}
 	return spi.Swap(data, start, stop)
 }
+
+// Slave changes the slave index selected with the currently configured
+// ChipSelect strategy (see SPIOption), returning a non-nil error if there is no
+// strategy configured or if the index is not addressable.
+func (spi *SPI) Slave(slave uint) error {
+
+	if nil == spi.config.selector {
+		return fmt.Errorf("no chip-select strategy configured")
+	}
+	if err := validSlave(spi.config.selector, slave); nil != err {
+		return err
+	}
+	spi.active = nil
+	spi.config.slave = slave
+	return nil
+}
+
+// ReadFromSlave returns the result of Read after selecting the given slave
+// index with the currently configured ChipSelect strategy.
+// The slave selection persists after reading.
+func (spi *SPI) ReadFromSlave(slave uint, count uint, start bool, stop bool) ([]uint8, error) {
+
+	if start || stop {
+		if err := spi.Slave(slave); nil != err {
+			return nil, err
+		}
+	}
+	return spi.Read(count, start, stop)
+}
+
+// WriteToSlave returns the result of Write after selecting the given slave
+// index with the currently configured ChipSelect strategy.
+// The slave selection persists after writing.
+func (spi *SPI) WriteToSlave(slave uint, data []uint8, start bool, stop bool) (uint, error) {
+
+	if start || stop {
+		if err := spi.Slave(slave); nil != err {
+			return 0, err
+		}
+	}
+	return spi.Write(data, start, stop)
+}
+
+// SwapWithSlave returns the result of Swap after selecting the given slave
+// index with the currently configured ChipSelect strategy.
+// The slave selection persists after swapping.
+func (spi *SPI) SwapWithSlave(slave uint, data []uint8, start bool, stop bool) ([]uint8, error) {
+
+	if start || stop {
+		if err := spi.Slave(slave); nil != err {
+			return nil, err
+		}
+	}
+	return spi.Swap(data, start, stop)
+}
+
+// SPIDevice represents a single SPI slave device attached to the bus of an SPI
+// master, along with its own clock rate, SPI mode, bit order, and CS pin and
+// polarity.
+// Multiple SPIDevice may share the same SPI master. Before each transfer, the
+// SPI master is reconfigured with the settings of the SPIDevice, unless they
+// are still in use since its previous transfer.
+// The methods of SPIDevice are safe for concurrent use by multiple goroutines,
+// even with different SPIDevice sharing the same SPI master, since each method
+// reconfigures and uses the SPI master exclusively. However, a transaction
+// spanning several calls (e.g., Select, Write, then Deselect) is not atomic,
+// and the SPI master itself must not be used directly by other goroutines.
+type SPIDevice struct {
+	spi    *SPI
+	config *SPIConfig
+	rate   uint32 // effective clock rate
+}
+
+// String returns a descriptive string of an SPIDevice.
+func (dev *SPIDevice) String() string {
+	if nil != dev.config.Select {
+		return fmt.Sprintf("{ SPI: %p, Slave: %d, Clock: %d, Mode: %d, "+
+			"LSBFirst: %t }", dev.spi, dev.config.Slave, dev.config.Clock,
+			dev.config.Mode, dev.config.LSBFirst)
+	}
+	return fmt.Sprintf("{ SPI: %p, CS: %q, Clock: %d, ActiveLow: %t, "+
+		"Mode: %d, LSBFirst: %t }", dev.spi, dev.config.CS, dev.config.Clock,
+		dev.config.ActiveLow, dev.config.Mode, dev.config.LSBFirst)
+}
+
+// Device constructs a new SPIDevice for communicating with the SPI slave device
+// selected by the given cs pin, using the settings in the given configuration.
+// The CS field of the given configuration is ignored and replaced with cs.
+// If the given configuration is nil, the default configuration is used (see
+// SPIConfigDefault).
+// The SPI master is not reconfigured until the first transfer with the device.
+func (spi *SPI) Device(cs Pin, cfg *SPIConfig) (*SPIDevice, error) {
+
+	if nil == cs || !cs.Valid() {
+		return nil, fmt.Errorf("invalid CS pin: %v", cs)
+	}
+
+	if cs.IsMPSSE() {
+		if csOpt := cs.(DPin).spiOptionCS(); !csOpt.Valid() {
+			return nil, fmt.Errorf("invalid CS pin: %s [%08b][%d]", cs, csOpt, csOpt)
+		}
+	}
+
+	return spi.newDevice(cfg, func(opt *SPIOption) {
+		opt.CS = cs
+		opt.Select = nil
+	})
+}
+
+// SlaveDevice constructs a new SPIDevice for communicating with the SPI slave
+// device selected by the given slave index, using the ChipSelect strategy and
+// other settings in the given configuration.
+// The Slave field of the given configuration is ignored and replaced with
+// slave. Returns a non-nil error if the configuration has no ChipSelect
+// strategy or if the index is not addressable.
+// The SPI master is not reconfigured until the first transfer with the device.
+func (spi *SPI) SlaveDevice(slave uint, cfg *SPIConfig) (*SPIDevice, error) {
+
+	if nil == cfg || nil == cfg.SPIOption || nil == cfg.Select {
+		return nil, fmt.Errorf("no chip-select strategy configured")
+	}
+
+	if err := validSlave(cfg.Select, slave); nil != err {
+		return nil, err
+	}
+
+	return spi.newDevice(cfg, func(opt *SPIOption) {
+		opt.Slave = slave
+	})
+}
+
+// newDevice constructs a new SPIDevice using a copy of the settings in the given
+// configuration cfg, which are then modified by the given function sel to
+// identify the slave device.
+func (spi *SPI) newDevice(cfg *SPIConfig, sel func(opt *SPIOption)) (*SPIDevice, error) {
+
+	if nil == cfg {
+		cfg = SPIConfigDefault()
+	}
+
+	opt := &SPIOption{}
+	if nil != cfg.SPIOption {
+		*opt = *cfg.SPIOption
+	} else {
+		*opt = *SPIConfigDefault().SPIOption
+	}
+	sel(opt)
+
+	if spiOption(opt.Mode) > spiModeMask {
+		return nil, fmt.Errorf("invalid SPI mode: Mode %d", opt.Mode)
+	}
+
+	clock, err := spiClock(cfg.Clock, cfg.Rounding)
+	if nil != err {
+		return nil, err
+	}
+
+	latency := cfg.Latency
+	if 0 == latency {
+		latency = SPILatencyDefault
+	}
+
+	return &SPIDevice{
+		spi: spi,
+		config: &SPIConfig{
+			SPIOption: opt,
+			Clock:     clock.rate(),
+			Latency:   latency,
+			Rounding:  cfg.Rounding,
+		},
+		rate: clock.rate(),
+	}, nil
+}
+
+// Config returns a copy of the configuration settings of the SPIDevice.
+func (dev *SPIDevice) Config() *SPIConfig {
+	opt := *dev.config.SPIOption
+	return &SPIConfig{
+		SPIOption: &opt,
+		Clock:     dev.config.Clock,
+		Latency:   dev.config.Latency,
+		Rounding:  dev.config.Rounding,
+	}
+}
+
+// Constants defining how the SPI master must be reconfigured to activate an
+// SPIDevice.
+const (
+	spiActivateNone   = iota // settings already in use
+	spiActivateOption        // change dynamic options with Option
+	spiActivateConfig        // (re)initialize the interface with Config
+)
+
+// plan returns how the SPI master must be reconfigured to use the settings of
+// the SPIDevice receiver dev.
+// If the clock rate or latency differ, or if the SPI interface has not yet been
+// initialized, the interface must be (re)initialized. Otherwise, if the SPI
+// master was last configured by another device (or directly), the dynamic
+// options must be changed.
+func (dev *SPIDevice) plan() int {
+
+	cur := dev.spi.GetConfig()
+
+	if ModeSPI != dev.spi.device.mode ||
+		cur.Clock != dev.rate || cur.Latency != dev.config.Latency {
+		return spiActivateConfig
+	}
+
+	// the dynamic options are still in use only if this device was the last to
+	// change them, since any other change clears the active device.
+	if dev != dev.spi.active {
+		return spiActivateOption
+	}
+
+	return spiActivateNone
+}
+
+// activate reconfigures the SPI master with the settings of the SPIDevice
+// receiver dev if they are not already in use (see plan).
+func (dev *SPIDevice) activate() error {
+
+	var err error
+	switch dev.plan() {
+	case spiActivateConfig:
+		err = dev.spi.Config(dev.Config())
+	case spiActivateOption:
+		err = dev.spi.Option(dev.Config().SPIOption)
+	}
+	if nil == err {
+		dev.spi.active = dev
+	}
+	return err
+}
+
+// lock acquires exclusive use of the SPI master shared by the SPIDevice
+// receiver dev and activates its settings. The returned function must be called
+// to release the SPI master.
+func (dev *SPIDevice) lock() (func(), error) {
+
+	dev.spi.devLock.Lock()
+	if err := dev.activate(); nil != err {
+		dev.spi.devLock.Unlock()
+		return nil, err
+	}
+	return dev.spi.devLock.Unlock, nil
+}
+
+// Read implements io.Reader by reading len(p) bytes from the SPI slave device
+// into p, asserting CS before and de-asserting CS after the transfer.
+// Returns the number of bytes read and a non-nil error if there was an error.
+func (dev *SPIDevice) Read(p []byte) (int, error) {
+
+	unlock, err := dev.lock()
+	if nil != err {
+		return 0, err
+	}
+	defer unlock()
+
+	data, err := dev.spi.Read(uint(len(p)), true, true)
+	return copy(p, data), err
+}
+
+// Write implements io.Writer by writing all bytes of p to the SPI slave device,
+// asserting CS before and de-asserting CS after the transfer.
+// Returns the number of bytes written and a non-nil error if there was an error.
+func (dev *SPIDevice) Write(p []byte) (int, error) {
+
+	unlock, err := dev.lock()
+	if nil != err {
+		return 0, err
+	}
+	defer unlock()
+
+	n, err := dev.spi.Write(p, true, true)
+	return int(n), err
+}
+
+// Select asserts the CS line of the SPI slave device (see SPI.Select).
+func (dev *SPIDevice) Select() error {
+
+	unlock, err := dev.lock()
+	if nil != err {
+		return err
+	}
+	defer unlock()
+	return dev.spi.Select()
+}
+
+// Deselect de-asserts the CS line of the SPI slave device (see SPI.Deselect).
+func (dev *SPIDevice) Deselect() error {
+
+	unlock, err := dev.lock()
+	if nil != err {
+		return err
+	}
+	defer unlock()
+	return dev.spi.Deselect()
+}
+
+// MISO returns the level of the MISO line while the CS line of the SPI slave
+// device is asserted (see SPI.MISO).
+func (dev *SPIDevice) MISO() (bool, error) {
+
+	unlock, err := dev.lock()
+	if nil != err {
+		return false, err
+	}
+	defer unlock()
+	return dev.spi.MISO()
+}
+
+// Tx performs a single transaction with the SPI slave device, asserting CS
+// before and de-asserting CS after the entire transaction.
+// If w and r have equal length, the transfer is full-duplex, i.e. each byte of
+// w is written while simultaneously reading each byte into r (see Swap).
+// Otherwise, the transfer is half-duplex: all bytes of w are written, followed
+// by reading len(r) bytes into r, without de-asserting CS in between.
+// Either slice may be empty (or nil) to perform only a read or only a write.
+func (dev *SPIDevice) Tx(w []byte, r []byte) error {
+
+	unlock, err := dev.lock()
+	if nil != err {
+		return err
+	}
+	defer unlock()
+
+	wn, rn := len(w), len(r)
+
+	switch {
+	case 0 == wn && 0 == rn:
+		return nil
+
+	case wn == rn:
+		data, err := dev.spi.Swap(w, true, true)
+		copy(r, data)
+		return err
+
+	case 0 == rn:
+		_, err := dev.spi.Write(w, true, true)
+		return err
+
+	case 0 == wn:
+		data, err := dev.spi.Read(uint(rn), true, true)
+		copy(r, data)
+		return err
+
+	default:
+		if _, err := dev.spi.Write(w, true, false); nil != err {
+			return err
+		}
+		data, err := dev.spi.Read(uint(rn), false, true)
+		copy(r, data)
+		return err
+	}
+}
+
+// SPIFrame is a single write transfer queued on an SPIStream.
+// Once the frame has been written, the stream sets the Count and Err fields and
+// returns the frame on the stream's Done channel. The Data buffer must not be
+// modified until then.
+type SPIFrame struct {
+	Data    []uint8      // bytes to write
+	Start   bool         // assert CS before transfer
+	Stop    bool         // de-assert CS after transfer
+	Prepare func() error // optional, called before transfer (e.g., set DC pin)
+	Count   uint         // number of bytes written (set by SPIStream)
+	Err     error        // non-nil if the transfer failed (set by SPIStream)
+}
+
+// SPIStream writes frames to the SPI interface asynchronously from a background
+// goroutine, allowing the caller to prepare the next frame while the previous
+// one is transferred over USB.
+// Frames are written in the order they are sent, and every frame sent is
+// returned on the Done channel once it has been written (or has failed).
+// The SPI interface must not be used by any other goroutine while the stream is
+// open, except from within a frame's Prepare function.
+type SPIStream struct {
+	write  func(f *SPIFrame) (uint, error) // writes a frame (see run)
+	send   chan *SPIFrame
+	done   chan *SPIFrame
+	mutex  sync.Mutex // guards closed and sending on send
+	closed bool
+}
+
+// ErrSPIStreamClosed is returned when sending a frame on a closed SPIStream.
+var ErrSPIStreamClosed = errors.New("spi stream closed")
+
+// Constants related to SPI streams.
+const (
+	SPIStreamDepthDefault uint = 2 // double buffering
+)
+
+// Stream starts a new SPIStream on the SPI interface, which allows up to depth
+// frames to be pending (queued or in transfer) without blocking the sender.
+// If depth is 0, SPIStreamDepthDefault is used.
+// The stream must be closed with Close when no longer needed.
+func (spi *SPI) Stream(depth uint) *SPIStream {
+	return newSPIStream(depth, func(f *SPIFrame) (uint, error) {
+		return spi.Write(f.Data, f.Start, f.Stop)
+	})
+}
+
+// newSPIStream starts a new SPIStream with the given depth (see Stream) that
+// writes each frame using the given function write.
+func newSPIStream(depth uint, write func(f *SPIFrame) (uint, error)) *SPIStream {
+
+	if 0 == depth {
+		depth = SPIStreamDepthDefault
+	}
+
+	s := &SPIStream{
+		write: write,
+		// the goroutine holds one frame while writing, so depth frames are pending
+		// when the channel buffer is full.
+		send: make(chan *SPIFrame, depth-1),
+		done: make(chan *SPIFrame, depth),
+	}
+
+	go s.run()
+
+	return s
+}
+
+// run writes each frame received from the send channel until it is closed,
+// returning each frame on the done channel, which is closed on return.
+func (s *SPIStream) run() {
+	defer close(s.done)
+	for f := range s.send {
+		f.Count, f.Err = 0, nil
+		if nil != f.Prepare {
+			f.Err = f.Prepare()
+		}
+		if nil == f.Err {
+			f.Count, f.Err = s.write(f)
+		}
+		s.done <- f
+	}
+}
+
+// Send queues the given frame f for transfer, blocking while the number of
+// pending frames equals the stream's depth. Returns ErrSPIStreamClosed if the
+// stream has been closed, in which case the frame is not queued.
+func (s *SPIStream) Send(f *SPIFrame) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return ErrSPIStreamClosed
+	}
+	s.send <- f
+	return nil
+}
+
+// Done returns the channel on which frames are returned once written, in the
+// order they were sent. The caller must receive every frame it sends, or else
+// the stream will eventually block.
+// The channel is closed after the stream is closed and all frames are written.
+func (s *SPIStream) Done() <-chan *SPIFrame {
+	return s.done
+}
+
+// Close stops accepting new frames. Frames already sent are still written and
+// returned on the Done channel, which is closed afterwards. To wait for all
+// pending frames to complete, receive from Done until it is closed.
+// Close may be called more than once; subsequent calls have no effect.
+func (s *SPIStream) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.send)
+	}
+}
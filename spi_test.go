@@ -0,0 +1,345 @@
+package ft232h
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSPIReverse(t *testing.T) {
+
+	data := []uint8{0x00, 0x01, 0x80, 0xA5, 0x3C, 0x0F, 0x12}
+	rev := spiReverse(data)
+	if exp := []uint8{0x00, 0x80, 0x01, 0xA5, 0x3C, 0xF0, 0x48}; !bytes.Equal(exp, rev) {
+		t.Fatalf("unexpected bits: % 02X", rev)
+	}
+	if !bytes.Equal(data, spiReverse(rev)) {
+		t.Fatalf("unexpected bits: % 02X", spiReverse(rev))
+	}
+}
+
+// testCS is a ChipSelect that is not comparable, selecting slaves with the GPIO
+// pins given by each element.
+type testCS []uint8
+
+func (cs testCS) Slaves() uint { return uint(len(cs)) }
+
+func (cs testCS) Sequence(cfg *GPIOConfig, slave uint, assert bool) ([]uint8, error) {
+	for i, pin := range cs {
+		if err := cfg.Set(C(uint(pin)), Output, !assert || uint(i) != slave); nil != err {
+			return nil, err
+		}
+	}
+	return []uint8{cfg.Val}, nil
+}
+
+func TestSPIDeviceActivate(t *testing.T) {
+
+	spi := &SPI{device: &FT232H{}, config: spiConfigDefault()}
+
+	// a ChipSelect that is not comparable must not be compared
+	sel := SPIConfigDefault()
+	sel.Select = testCS{1, 2}
+	slave, err := spi.SlaveDevice(1, sel)
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	slow := SPIConfigDefault()
+	slow.Clock = 1000000
+	slow.LSBFirst = true
+	slow.CSSetup = time.Microsecond
+
+	fast, err := spi.Device(D(3), nil)
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	other, err := spi.Device(D(4), nil)
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lsb, err := spi.Device(D(4), slow)
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	slow.Clock = 0 // default clock rate, with the options of lsb
+	opt, err := spi.Device(D(4), slow)
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// apply the settings the way activate does, but without invoking the driver
+	// (which requires hardware), by changing the options while the interface is
+	// not open and then marking the interface initialized.
+	apply := func(dev *SPIDevice) error {
+		cfg := dev.Config()
+		clock, err := spiClock(cfg.Clock, cfg.Rounding)
+		if nil != err {
+			return err
+		}
+		spi.config.clockRate, spi.config.clock = clock.rate(), clock
+		spi.config.latency = cfg.Latency
+		spi.device.mode = ModeNone
+		if err := spi.Option(cfg.SPIOption); nil != err {
+			return err
+		}
+		spi.device.mode = ModeSPI
+		spi.active = dev
+		return nil
+	}
+
+	for _, test := range []struct {
+		dev  *SPIDevice
+		plan int
+	}{
+		{dev: fast, plan: spiActivateConfig}, // not initialized
+		{dev: fast, plan: spiActivateNone},
+		{dev: other, plan: spiActivateOption}, // CS differs
+		{dev: other, plan: spiActivateNone},
+		{dev: lsb, plan: spiActivateConfig}, // clock differs
+		{dev: opt, plan: spiActivateConfig}, // clock differs
+		{dev: lsb, plan: spiActivateConfig},
+		{dev: lsb, plan: spiActivateNone},
+		{dev: other, plan: spiActivateConfig},
+		{dev: opt, plan: spiActivateOption}, // LSBFirst and CSSetup differ
+		{dev: fast, plan: spiActivateOption},
+		{dev: slave, plan: spiActivateOption},
+		{dev: slave, plan: spiActivateNone},
+		{dev: fast, plan: spiActivateOption},
+	} {
+		name := test.dev.String()
+		if plan := test.dev.plan(); test.plan != plan {
+			t.Fatalf("%s: unexpected plan: %d != %d", name, plan, test.plan)
+		}
+		if err := apply(test.dev); nil != err {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		cur := spi.GetConfig()
+		if (nil == cur.Select && !cur.CS.Equals(test.dev.config.CS)) ||
+			cur.Slave != test.dev.config.Slave || test.dev.rate != cur.Clock ||
+			cur.LSBFirst != test.dev.config.LSBFirst ||
+			cur.CSSetup != test.dev.config.CSSetup {
+			t.Fatalf("%s: unexpected settings: %s", name, spi.config)
+		}
+	}
+}
+
+func TestSPICmd(t *testing.T) {
+
+	pad := func(cmd []uint8, n int) []uint8 {
+		var b []uint8
+		for i := 0; i < n; i++ {
+			b = append(b, cmd...)
+		}
+		return b
+	}
+	cat := func(cmd ...[]uint8) []uint8 {
+		var b []uint8
+		for _, c := range cmd {
+			b = append(b, c...)
+		}
+		return b
+	}
+
+	// port D with CS (D3) asserted and de-asserted, SCLK idle LOW or HIGH
+	asrt, dsrt := []uint8{0x80, 0x00, 0x0B}, []uint8{0x80, 0x08, 0x0B}
+	asrtHi, dsrtHi := []uint8{0x80, 0x01, 0x0B}, []uint8{0x80, 0x09, 0x0B}
+
+	for _, test := range []struct {
+		name string
+		opt  SPIOption
+		out  []uint8
+		in   uint
+		cmd  []uint8
+	}{
+		{
+			name: "none",
+			opt:  SPIOption{CS: C(2), ActiveLow: true},
+			out:  []uint8{0xA5},
+			cmd: cat([]uint8{0x82, 0x00, 0x04, 0x11, 0x00, 0x00, 0xA5},
+				[]uint8{0x82, 0x04, 0x04}),
+		},
+		{
+			name: "setup",
+			opt:  SPIOption{CS: D(3), ActiveLow: true, CSSetup: 100 * time.Nanosecond},
+			out:  []uint8{0xA5, 0x5A},
+			cmd: cat(asrt, pad(asrt, 2),
+				[]uint8{0x11, 0x01, 0x00, 0xA5, 0x5A}, dsrt),
+		},
+		{
+			name: "hold",
+			opt:  SPIOption{CS: D(3), ActiveLow: true, CSHold: 120 * time.Nanosecond},
+			in:   1,
+			cmd:  cat(asrt, []uint8{0x20, 0x00, 0x00}, pad(asrt, 3), dsrt),
+		},
+		{
+			name: "byte",
+			opt: SPIOption{CS: D(3), ActiveLow: true, Mode: 2, LSBFirst: true,
+				ByteDelay: 60 * time.Nanosecond},
+			out: []uint8{0x01, 0x02, 0x03},
+			in:  3,
+			cmd: cat(asrtHi, []uint8{0x3C, 0x00, 0x00, 0x01}, pad(asrtHi, 2),
+				[]uint8{0x3C, 0x00, 0x00, 0x02}, pad(asrtHi, 2),
+				[]uint8{0x3C, 0x00, 0x00, 0x03}, dsrtHi),
+		},
+		{
+			name: "select",
+			opt:  SPIOption{Select: testCS{0, 1}, Slave: 1},
+			out:  []uint8{0x42},
+			cmd: []uint8{0x82, 0x01, 0x03, 0x11, 0x00, 0x00, 0x42,
+				0x82, 0x03, 0x03},
+		},
+		{
+			name: "gpio",
+			opt:  SPIOption{CS: C(2), CSSetup: 50 * time.Nanosecond},
+			out:  []uint8{0xFF},
+			cmd: cat([]uint8{0x82, 0x04, 0x04, 0x82, 0x04, 0x04},
+				[]uint8{0x11, 0x00, 0x00, 0xFF, 0x82, 0x00, 0x04}),
+		},
+	} {
+		t.Run(test.name, func(s *testing.T) {
+			spi := &SPI{
+				device: &FT232H{GPIO: &GPIO{config: GPIOConfigDefault()}},
+				config: spiConfigDefault(),
+			}
+			if err := spi.Option(&test.opt); nil != err {
+				s.Fatalf("unexpected error: %v", err)
+			}
+			if spi.config.autoCS() {
+				s.Fatalf("unexpected automatic CS")
+			}
+			var in []uint8
+			if test.in > 0 {
+				in = make([]uint8, test.in)
+			}
+			c := spi.cmd()
+			if err := spi.assert(c); nil != err {
+				s.Fatalf("unexpected error: %v", err)
+			}
+			op := spi.config.dataOp(nil != test.out, nil != in)
+			if n := spi.data(c, op, test.out, in, 0); test.in != n && uint(len(test.out)) != n {
+				s.Fatalf("unexpected position: %d", n)
+			}
+			if err := spi.deassert(c); nil != err {
+				s.Fatalf("unexpected error: %v", err)
+			}
+			if !bytes.Equal(test.cmd, c.buf) {
+				s.Fatalf("unexpected commands: % 02X", c.buf)
+			}
+			if test.in != c.size {
+				s.Fatalf("unexpected response size: %d", c.size)
+			}
+		})
+	}
+
+	spi := &SPI{device: &FT232H{}, config: spiConfigDefault()}
+	if !spi.config.autoCS() {
+		t.Fatalf("expected automatic CS")
+	}
+}
+
+func TestSPIMISO(t *testing.T) {
+
+	for _, test := range []struct {
+		name     string
+		opt      SPIOption
+		selected bool
+		cmd      []uint8
+	}{
+		{
+			name: "poll",
+			opt:  SPIOption{CS: D(3), ActiveLow: true},
+			cmd:  []uint8{0x80, 0x00, 0x0B, 0x81, 0x80, 0x08, 0x0B},
+		},
+		{
+			name:     "selected",
+			opt:      SPIOption{CS: D(3), ActiveLow: true},
+			selected: true,
+			cmd:      []uint8{0x81},
+		},
+		{
+			name: "setup",
+			opt:  SPIOption{CS: D(4), CSSetup: 50 * time.Nanosecond},
+			cmd: []uint8{0x80, 0x18, 0x1B, 0x80, 0x18, 0x1B, 0x81,
+				0x80, 0x08, 0x1B},
+		},
+	} {
+		t.Run(test.name, func(s *testing.T) {
+			spi := &SPI{device: &FT232H{}, config: spiConfigDefault()}
+			if err := spi.Option(&test.opt); nil != err {
+				s.Fatalf("unexpected error: %v", err)
+			}
+			spi.selected = test.selected
+			in := make([]uint8, 1)
+			c, err := spi.misoCmd(in)
+			if nil != err {
+				s.Fatalf("unexpected error: %v", err)
+			}
+			if !bytes.Equal(test.cmd, c.buf) {
+				s.Fatalf("unexpected commands: % 02X", c.buf)
+			}
+			if 1 != c.size || 1 != len(c.in) || &in[0] != &c.in[0][0] {
+				s.Fatalf("unexpected response: %d", c.size)
+			}
+		})
+	}
+}
+
+func TestSPIStream(t *testing.T) {
+
+	var order []uint8
+	gate := make(chan bool)
+	busy := make(chan bool, 8)
+	s := newSPIStream(2, func(f *SPIFrame) (uint, error) {
+		busy <- true
+		<-gate
+		order = append(order, f.Data[0])
+		return uint(len(f.Data)), nil
+	})
+
+	// one frame in transfer and one queued fill a stream of depth 2
+	for i := uint8(0); i < 2; i++ {
+		if err := s.Send(&SPIFrame{Data: []uint8{i}}); nil != err {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if 0 == i {
+			<-busy
+		}
+	}
+
+	sent := make(chan error)
+	go func() { sent <- s.Send(&SPIFrame{Data: []uint8{2}}) }()
+	select {
+	case err := <-sent:
+		t.Fatalf("unexpected send (stream full): %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	gate <- true
+	if err := <-sent; nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s.Close()
+	s.Close()
+	if err := s.Send(&SPIFrame{Data: []uint8{3}}); ErrSPIStreamClosed != err {
+		t.Fatalf("expected closed stream: %v", err)
+	}
+
+	// frames sent before Close are still written, then Done is closed
+	go func() {
+		for i := 0; i < 2; i++ {
+			<-busy
+			gate <- true
+		}
+	}()
+	var done []uint8
+	for f := range s.Done() {
+		if nil != f.Err || 1 != f.Count {
+			t.Fatalf("unexpected frame: %+v", f)
+		}
+		done = append(done, f.Data[0])
+	}
+	if exp := []uint8{0, 1, 2}; !bytes.Equal(exp, done) || !bytes.Equal(exp, order) {
+		t.Fatalf("unexpected order: %v, %v", done, order)
+	}
+}
@@ -0,0 +1,544 @@
+package ft232h
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JTAGTarget is the interface of a JTAG adapter used by the SVF and XSVF
+// players, implemented by the JTAG interface of an FT232H (*JTAG).
+type JTAGTarget interface {
+	Reset() error
+	Goto(state TAPState) error
+	RunTest(state TAPState, cycles uint, min time.Duration) error
+	ShiftIR(in []uint8, bits uint, end TAPState) ([]uint8, error)
+	ShiftDR(in []uint8, bits uint, end TAPState) ([]uint8, error)
+	SetClock(rate uint32) (uint32, error)
+	State() TAPState
+}
+
+// SVFError is returned by an SVF player when a statement fails, identifying the
+// line number on which the statement begins.
+type SVFError struct {
+	Line int    // line number (from 1) of the statement
+	Cmd  string // command of the statement (e.g., "SDR")
+	Err  error  // cause of the failure (e.g., *TDOMismatchError)
+}
+
+// Error returns a descriptive string of an SVFError.
+func (e *SVFError) Error() string {
+	return fmt.Sprintf("svf: line %d: %s: %v", e.Line, e.Cmd, e.Err)
+}
+
+// TDOMismatchError is returned by the SVF and XSVF players when the bits shifted
+// out of TDO do not match the expected bits, selected by a mask.
+// The bits are formatted as hexadecimal strings, as in SVF (MSB first).
+type TDOMismatchError struct {
+	Bits     uint   // number of bits shifted
+	TDO      string // bits shifted out of TDO
+	Expected string // expected bits
+	Mask     string // bits compared
+}
+
+// Error returns a descriptive string of a TDOMismatchError.
+func (e *TDOMismatchError) Error() string {
+	return fmt.Sprintf("TDO mismatch (%d bits): got (%s), expected (%s), mask (%s)",
+		e.Bits, e.TDO, e.Expected, e.Mask)
+}
+
+// tdoCompare returns a *TDOMismatchError if any of the given number of bits of
+// out differs from exp, considering only the bits set in mask (or all bits if
+// mask is nil).
+func tdoCompare(out []uint8, exp []uint8, mask []uint8, bits uint) error {
+	for i := uint(0); i < bits; i++ {
+		if (nil == mask || jtagBit(mask, i)) && jtagBit(out, i) != jtagBit(exp, i) {
+			if nil == mask {
+				mask = jtagFill(0, bits)
+			}
+			return &TDOMismatchError{
+				Bits:     bits,
+				TDO:      svfHexString(out, bits),
+				Expected: svfHexString(exp, bits),
+				Mask:     svfHexString(mask, bits),
+			}
+		}
+	}
+	return nil
+}
+
+// svfClockMax is the TCK rate used when an SVF FREQUENCY statement does not
+// specify a rate.
+const svfClockMax uint32 = 30000000 // 30 MHz
+
+// SVF plays Serial Vector Format (SVF) files, as exported by CPLD and FPGA
+// vendor tools, on a JTAG scan chain.
+//
+// The supported statements are SIR and SDR (with TDI, TDO, MASK, and SMASK),
+// HIR, HDR, TIR, and TDR (header and trailer bits), ENDIR and ENDDR, RUNTEST,
+// STATE, FREQUENCY, and TRST (ignored, except TRST ON, which is not supported).
+// Statements fail with an *SVFError identifying the line number of the
+// statement, and TDO mismatches are reported as a *TDOMismatchError.
+type SVF struct {
+	target   JTAGTarget
+	endIR    TAPState // end state of SIR
+	endDR    TAPState // end state of SDR
+	runState TAPState // run state of RUNTEST
+	runEnd   TAPState // end state of RUNTEST
+	hir, hdr svfScan  // header bits of IR, DR scans
+	tir, tdr svfScan  // trailer bits of IR, DR scans
+	sir, sdr svfScan  // IR, DR scans
+}
+
+// NewSVF returns a new SVF player using the given JTAG target, which must
+// already be initialized.
+func NewSVF(target JTAGTarget) *SVF {
+	return &SVF{
+		target:   target,
+		endIR:    TAPIdle,
+		endDR:    TAPIdle,
+		runState: TAPIdle,
+		runEnd:   TAPIdle,
+	}
+}
+
+// Play reads SVF statements from r and executes them in order, until either EOF
+// or a statement fails.
+// The state of the player (e.g., the end states and the TDI, MASK, and SMASK
+// values of previous scans) persists across calls to Play.
+func (svf *SVF) Play(r io.Reader) error {
+	return svfParse(r, svf.exec)
+}
+
+// exec executes a single SVF statement consisting of the given words, beginning
+// on the given line.
+func (svf *SVF) exec(line int, words []string) error {
+
+	var (
+		cmd  = strings.ToUpper(words[0])
+		args = words[1:]
+		err  error
+	)
+
+	switch cmd {
+	case "ENDIR":
+		svf.endIR, err = svfEndState(args)
+	case "ENDDR":
+		svf.endDR, err = svfEndState(args)
+	case "STATE":
+		err = svf.state(args)
+	case "FREQUENCY":
+		err = svf.frequency(args)
+	case "HIR":
+		err = svf.hir.parse(args)
+	case "HDR":
+		err = svf.hdr.parse(args)
+	case "TIR":
+		err = svf.tir.parse(args)
+	case "TDR":
+		err = svf.tdr.parse(args)
+	case "SIR":
+		if err = svf.sir.parse(args); nil == err {
+			err = svf.scan(svf.target.ShiftIR, svf.endIR, &svf.hir, &svf.sir, &svf.tir)
+		}
+	case "SDR":
+		if err = svf.sdr.parse(args); nil == err {
+			err = svf.scan(svf.target.ShiftDR, svf.endDR, &svf.hdr, &svf.sdr, &svf.tdr)
+		}
+	case "RUNTEST":
+		err = svf.runTest(args)
+	case "TRST":
+		if len(args) != 1 {
+			err = fmt.Errorf("invalid arguments: %v", args)
+		} else if "ON" == strings.ToUpper(args[0]) {
+			err = fmt.Errorf("TRST not supported")
+		}
+	default:
+		err = fmt.Errorf("unsupported command")
+	}
+
+	if nil != err {
+		return &SVFError{Line: line, Cmd: cmd, Err: err}
+	}
+	return nil
+}
+
+// state executes an SVF STATE statement, moving the TAP state machine through
+// each of the given states.
+func (svf *SVF) state(args []string) error {
+	if 0 == len(args) {
+		return fmt.Errorf("missing state")
+	}
+	for i, a := range args {
+		s, err := svfState(a)
+		if nil != err {
+			return err
+		}
+		if len(args)-1 == i && !s.stable() {
+			return fmt.Errorf("invalid end state: %s", s)
+		}
+		if err := svf.target.Goto(s); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+// frequency executes an SVF FREQUENCY statement, setting the max TCK rate.
+func (svf *SVF) frequency(args []string) error {
+	rate := svfClockMax
+	switch len(args) {
+	case 0:
+	case 2:
+		if "HZ" != strings.ToUpper(args[1]) {
+			return fmt.Errorf("invalid units: %s", args[1])
+		}
+		f, err := strconv.ParseFloat(args[0], 64)
+		if nil != err || f < 1 {
+			return fmt.Errorf("invalid frequency: %s", args[0])
+		}
+		if f < float64(svfClockMax) {
+			rate = uint32(f)
+		}
+	default:
+		return fmt.Errorf("invalid arguments: %v", args)
+	}
+	_, err := svf.target.SetClock(rate)
+	return err
+}
+
+// runTest executes an SVF RUNTEST statement.
+func (svf *SVF) runTest(args []string) error {
+
+	var (
+		cycles uint
+		min    time.Duration
+		run    = svf.runState
+		end    = svf.runEnd
+		max    bool // parsing MAXIMUM time (ignored)
+	)
+
+	if len(args) > 0 {
+		if s, err := svfState(args[0]); nil == err {
+			run, end = s, s
+			args = args[1:]
+		}
+	}
+
+	for len(args) > 0 {
+		switch strings.ToUpper(args[0]) {
+		case "MAXIMUM":
+			max, args = true, args[1:]
+			continue
+		case "ENDSTATE":
+			if len(args) < 2 {
+				return fmt.Errorf("missing end state")
+			}
+			s, err := svfState(args[1])
+			if nil != err {
+				return err
+			}
+			end, args = s, args[2:]
+			continue
+		}
+		if len(args) < 2 {
+			return fmt.Errorf("missing units: %s", args[0])
+		}
+		f, err := strconv.ParseFloat(args[0], 64)
+		if nil != err || f < 0 {
+			return fmt.Errorf("invalid count: %s", args[0])
+		}
+		switch strings.ToUpper(args[1]) {
+		case "TCK":
+			cycles = uint(f)
+		case "SEC":
+			if !max {
+				min = time.Duration(math.Round(f * float64(time.Second)))
+			}
+		default:
+			return fmt.Errorf("unsupported units: %s", args[1])
+		}
+		args = args[2:]
+	}
+
+	if !run.stable() || !end.stable() {
+		return fmt.Errorf("invalid state: %s, %s", run, end)
+	}
+	svf.runState, svf.runEnd = run, end
+
+	if err := svf.target.RunTest(run, cycles, min); nil != err {
+		return err
+	}
+	if end != run {
+		return svf.target.Goto(end)
+	}
+	return nil
+}
+
+// scan shifts the concatenated header, scan, and trailer bits using the given
+// shift function, ending in the given state, and verifies the bits shifted out
+// of TDO if expected bits were specified.
+func (svf *SVF) scan(shift func([]uint8, uint, TAPState) ([]uint8, error),
+	end TAPState, scans ...*svfScan) error {
+
+	var (
+		bits  uint
+		check bool
+	)
+	for _, s := range scans {
+		bits += s.bits
+		check = check || nil != s.tdo
+	}
+	if 0 == bits {
+		return svf.target.Goto(end)
+	}
+
+	tdi := make([]uint8, (bits+7)/8)
+	tdo := make([]uint8, len(tdi))
+	mask := make([]uint8, len(tdi))
+	var at uint
+	for _, s := range scans {
+		svfCopy(tdi, at, s.tdi, s.bits)
+		if nil != s.tdo {
+			svfCopy(tdo, at, s.tdo, s.bits)
+			svfCopy(mask, at, s.mask, s.bits)
+		}
+		at += s.bits
+	}
+
+	out, err := shift(tdi, bits, end)
+	if nil != err || !check {
+		return err
+	}
+	return tdoCompare(out, tdo, mask, bits)
+}
+
+// svfScan holds the values of an SVF scan statement (SIR, SDR, HIR, HDR, TIR,
+// or TDR). Each value is a bit string (LSB first).
+type svfScan struct {
+	bits  uint
+	tdi   []uint8
+	tdo   []uint8 // nil if TDO is not checked
+	mask  []uint8
+	smask []uint8
+}
+
+// parse updates the scan with the arguments of an SVF scan statement. The TDI,
+// MASK, and SMASK values persist from previous statements of the same length,
+// and TDO is only checked if specified.
+func (s *svfScan) parse(args []string) error {
+
+	if 0 == len(args) {
+		return fmt.Errorf("missing length")
+	}
+	n, err := strconv.ParseUint(args[0], 10, 32)
+	if nil != err {
+		return fmt.Errorf("invalid length: %s", args[0])
+	}
+	bits := uint(n)
+	if bits != s.bits || nil == s.mask {
+		s.bits = bits
+		s.tdi = nil
+		s.mask = jtagFill(0, bits)
+		s.smask = jtagFill(0, bits)
+	}
+	s.tdo = nil
+
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) || !strings.HasPrefix(args[i+1], "(") {
+			return fmt.Errorf("missing value: %s", args[i])
+		}
+		v, err := svfHex(args[i+1][1:], bits)
+		if nil != err {
+			return err
+		}
+		switch strings.ToUpper(args[i]) {
+		case "TDI":
+			s.tdi = v
+		case "TDO":
+			s.tdo = v
+		case "MASK":
+			s.mask = v
+		case "SMASK":
+			s.smask = v
+		default:
+			return fmt.Errorf("invalid parameter: %s", args[i])
+		}
+	}
+
+	if nil == s.tdi && bits > 0 {
+		return fmt.Errorf("missing TDI")
+	}
+	return nil
+}
+
+// svfState returns the TAPState with the given SVF name.
+func svfState(name string) (TAPState, error) {
+	name = strings.ToUpper(name)
+	for s := TAPReset; s < TAPUnknown; s++ {
+		if name == s.String() {
+			return s, nil
+		}
+	}
+	return TAPUnknown, fmt.Errorf("invalid state: %s", name)
+}
+
+// svfEndState returns the stable TAPState given as the only argument of an SVF
+// ENDIR or ENDDR statement.
+func svfEndState(args []string) (TAPState, error) {
+	if 1 != len(args) {
+		return TAPUnknown, fmt.Errorf("invalid arguments: %v", args)
+	}
+	s, err := svfState(args[0])
+	if nil != err {
+		return TAPUnknown, err
+	}
+	if !s.stable() {
+		return TAPUnknown, fmt.Errorf("invalid end state: %s", s)
+	}
+	return s, nil
+}
+
+// svfHex returns the bit string (LSB first) of the given number of bits encoded
+// by an SVF hexadecimal value (MSB first). Missing leading digits are zero, and
+// extra leading digits must be zero.
+func svfHex(hex string, bits uint) ([]uint8, error) {
+	out := make([]uint8, (bits+7)/8)
+	for i := uint(0); i < uint(len(hex)); i++ {
+		d, err := strconv.ParseUint(hex[uint(len(hex))-1-i:uint(len(hex))-i], 16, 8)
+		if nil != err {
+			return nil, fmt.Errorf("invalid hex value: %s", hex)
+		}
+		for j := uint(0); j < 4; j++ {
+			if 0 == (d>>j)&1 {
+				continue
+			}
+			if b := 4*i + j; b < bits {
+				out[b/8] |= 1 << (b % 8)
+			} else {
+				return nil, fmt.Errorf("invalid hex value (exceeds %d bits): %s", bits, hex)
+			}
+		}
+	}
+	return out, nil
+}
+
+// svfHexString returns the SVF hexadecimal value (MSB first) of the given number
+// of bits of a bit string (LSB first).
+func svfHexString(data []uint8, bits uint) string {
+	var sb strings.Builder
+	for i := (bits + 3) / 4; i > 0; i-- {
+		var d uint8
+		for j := uint(0); j < 4; j++ {
+			if b := 4*(i-1) + j; b < bits && jtagBit(data, b) {
+				d |= 1 << j
+			}
+		}
+		sb.WriteString(strconv.FormatUint(uint64(d), 16))
+	}
+	return strings.ToUpper(sb.String())
+}
+
+// svfCopy copies the given number of bits of src to dst, beginning at bit at of
+// dst. Both are bit strings (LSB first).
+func svfCopy(dst []uint8, at uint, src []uint8, bits uint) {
+	for i := uint(0); i < bits; i++ {
+		if jtagBit(src, i) {
+			dst[(at+i)/8] |= 1 << ((at + i) % 8)
+		}
+	}
+}
+
+// svfParse reads SVF statements from r, calling fn with the words of each
+// statement and the line number on which it begins. Comments (beginning with
+// "!" or "//") are removed, and each parenthesized hexadecimal value is
+// returned as a single word beginning with "(", without whitespace or the
+// closing parenthesis.
+func svfParse(r io.Reader, fn func(line int, words []string) error) error {
+
+	var (
+		br    = bufio.NewReader(r)
+		line  int
+		start int      // line on which the current statement begins
+		words []string // words of the current statement
+		word  []byte   // current word
+		paren bool     // in parenthesized value
+	)
+
+	flush := func() {
+		if len(word) > 0 {
+			if 0 == len(words) {
+				start = line
+			}
+			words = append(words, string(word))
+			word = word[:0]
+		}
+	}
+
+	for {
+		text, err := br.ReadString('\n')
+		if "" != text {
+			line++
+			if i := strings.Index(text, "!"); i >= 0 {
+				text = text[:i]
+			}
+			if i := strings.Index(text, "//"); i >= 0 {
+				text = text[:i]
+			}
+			for i := 0; i < len(text); i++ {
+				c := text[i]
+				switch {
+				case paren:
+					if ')' == c {
+						paren = false
+						flush()
+					} else if !svfSpace(c) {
+						word = append(word, c)
+					}
+				case '(' == c:
+					flush()
+					paren = true
+					word = append(word, c)
+				case ';' == c:
+					flush()
+					if len(words) > 0 {
+						if err := fn(start, words); nil != err {
+							return err
+						}
+					}
+					words = words[:0]
+				case svfSpace(c):
+					flush()
+				default:
+					word = append(word, c)
+				}
+			}
+		}
+		if io.EOF == err {
+			break
+		}
+		if nil != err {
+			return err
+		}
+	}
+
+	flush()
+	if paren || len(words) > 0 {
+		return &SVFError{Line: start, Cmd: strings.ToUpper(words[0]),
+			Err: fmt.Errorf("unterminated statement")}
+	}
+	return nil
+}
+
+// svfSpace returns true if the given byte is an ASCII whitespace character.
+func svfSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\r', '\v', '\f':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,354 @@
+package ft232h
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Constants defining the instructions of a simulated JTAG device.
+const (
+	simIDCode uint = 0x01
+	simData   uint = 0x02 // 8-bit read/write register
+)
+
+// simDevice is a simulated JTAG device with an IDCODE, BYPASS, and an 8-bit
+// data register.
+type simDevice struct {
+	irLen  uint
+	idCode uint
+	ir     uint
+	data   uint
+}
+
+// capture returns the bits (LSB first) captured by the IR or DR of a device.
+func (d *simDevice) capture(ir bool) []bool {
+	switch {
+	case ir:
+		return simBits(0x01, d.irLen)
+	case simIDCode == d.ir:
+		return simBits(d.idCode, 32)
+	case simData == d.ir:
+		return simBits(d.data, 8)
+	}
+	return []bool{false} // BYPASS
+}
+
+// update loads the bits shifted into the IR or DR of a device.
+func (d *simDevice) update(ir bool, bits []bool) {
+	var v uint
+	for i, b := range bits {
+		if b {
+			v |= 1 << uint(i)
+		}
+	}
+	switch {
+	case ir:
+		d.ir = v
+	case simData == d.ir:
+		d.data = v
+	}
+}
+
+// simBits returns the given number of bits of v, LSB first.
+func simBits(v uint, n uint) []bool {
+	b := make([]bool, n)
+	for i := range b {
+		b[i] = 0 != (v>>uint(i))&1
+	}
+	return b
+}
+
+// simRun records the arguments of a call to RunTest.
+type simRun struct {
+	state  TAPState
+	cycles uint
+	min    time.Duration
+}
+
+// simTAP is a simulated scan chain implementing JTAGTarget, with its devices
+// ordered from TDO (first) to TDI.
+type simTAP struct {
+	chain  []*simDevice
+	state  TAPState
+	reg    []bool // bits of the register being shifted
+	clock  uint32
+	runs   []simRun
+	shifts int
+	states []TAPState // every state entered, in order
+}
+
+// newSimTAP returns a simulated scan chain of a 5-bit IR device in BYPASS, a
+// 4-bit IR target device, and a 3-bit IR device in BYPASS.
+func newSimTAP() *simTAP {
+	return &simTAP{
+		chain: []*simDevice{
+			{irLen: 5, idCode: 0x06413041},
+			{irLen: 4, idCode: 0x4BA00477},
+			{irLen: 3, idCode: 0x0362D093},
+		},
+		state: TAPUnknown,
+	}
+}
+
+func (t *simTAP) Reset() error {
+	for _, d := range t.chain {
+		d.ir = simIDCode
+	}
+	t.state = TAPReset
+	t.states = append(t.states, TAPReset)
+	return nil
+}
+
+func (t *simTAP) Goto(state TAPState) error {
+	if TAPReset == state {
+		return t.Reset()
+	}
+	t.walk(state)
+	return nil
+}
+
+// walk moves the state machine along the shortest path to the given state,
+// capturing and updating the registers as it passes through each Capture and
+// Update state.
+func (t *simTAP) walk(to TAPState) {
+	s := t.state
+	if TAPUnknown == s {
+		s = TAPReset // path begins with five 1s
+	}
+	for _, tms := range tapPath(t.state, to) {
+		s = s.next(tms)
+		t.states = append(t.states, s)
+		switch s {
+		case TAPCaptureDR, TAPCaptureIR:
+			t.reg = nil
+			for _, d := range t.chain {
+				t.reg = append(t.reg, d.capture(TAPCaptureIR == s)...)
+			}
+		case TAPUpdateDR, TAPUpdateIR:
+			reg := t.reg
+			for _, d := range t.chain {
+				n := uint(len(d.capture(TAPUpdateIR == s)))
+				d.update(TAPUpdateIR == s, reg[:n])
+				reg = reg[n:]
+			}
+		}
+	}
+	t.state = to
+}
+
+func (t *simTAP) RunTest(state TAPState, cycles uint, min time.Duration) error {
+	t.runs = append(t.runs, simRun{state: state, cycles: cycles, min: min})
+	return t.Goto(state)
+}
+
+func (t *simTAP) ShiftIR(in []uint8, bits uint, end TAPState) ([]uint8, error) {
+	return t.shift(TAPShiftIR, in, bits, end), nil
+}
+
+func (t *simTAP) ShiftDR(in []uint8, bits uint, end TAPState) ([]uint8, error) {
+	return t.shift(TAPShiftDR, in, bits, end), nil
+}
+
+func (t *simTAP) SetClock(rate uint32) (uint32, error) {
+	t.clock = rate
+	return rate, nil
+}
+
+func (t *simTAP) State() TAPState {
+	return t.state
+}
+
+func (t *simTAP) shift(shift TAPState, in []uint8, bits uint, end TAPState) []uint8 {
+	t.walk(shift)
+	seq := t.reg
+	for i := uint(0); i < bits; i++ {
+		seq = append(seq, jtagBit(in, i))
+	}
+	out := make([]uint8, (bits+7)/8)
+	for i := uint(0); i < bits; i++ {
+		if seq[i] {
+			out[i/8] |= 1 << (i % 8)
+		}
+	}
+	t.reg = append([]bool{}, seq[bits:]...)
+	if end != shift {
+		// the last bit is shifted while moving to Exit1
+		t.state = TAPExit1DR
+		if TAPShiftIR == shift {
+			t.state = TAPExit1IR
+		}
+		t.states = append(t.states, t.state)
+		t.walk(end)
+	}
+	t.shifts++
+	return out
+}
+
+func TestSVFParse(t *testing.T) {
+
+	type stmt struct {
+		line  int
+		words string
+	}
+	var got []stmt
+	err := svfParse(strings.NewReader(
+		"! header comment\n"+
+			"TRST OFF;\n"+
+			"SIR 8 TDI (A5) ; // trailing comment\n"+
+			"SDR 64\n"+
+			"\tTDI (0123 4567\n"+
+			"89AB CDEF)\n"+
+			"\tTDO (00) MASK\n"+
+			"(FF); RUNTEST 10 TCK;\n"+
+			"STATE IDLE;"),
+		func(line int, words []string) error {
+			got = append(got, stmt{line: line, words: strings.Join(words, " ")})
+			return nil
+		})
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	exp := []stmt{
+		{line: 2, words: "TRST OFF"},
+		{line: 3, words: "SIR 8 TDI (A5"},
+		{line: 4, words: "SDR 64 TDI (0123456789ABCDEF TDO (00 MASK (FF"},
+		{line: 8, words: "RUNTEST 10 TCK"},
+		{line: 9, words: "STATE IDLE"},
+	}
+	if len(exp) != len(got) {
+		t.Fatalf("unexpected statements: %v", got)
+	}
+	for i := range exp {
+		if exp[i] != got[i] {
+			t.Fatalf("unexpected statement: %v", got[i])
+		}
+	}
+
+	err = svfParse(strings.NewReader("SIR 8\nTDI (A5);\nSDR 8 TDI (00"),
+		func(int, []string) error { return nil })
+	if e, ok := err.(*SVFError); !ok || 3 != e.Line {
+		t.Fatalf("expected error on line 3: %v", err)
+	}
+}
+
+func TestSVFHex(t *testing.T) {
+
+	for _, test := range []struct {
+		hex  string
+		bits uint
+		data []uint8
+		str  string
+	}{
+		{hex: "A5", bits: 8, data: []uint8{0xA5}, str: "A5"},
+		{hex: "1F", bits: 5, data: []uint8{0x1F}, str: "1F"},
+		{hex: "5", bits: 12, data: []uint8{0x05, 0x00}, str: "005"},
+		{hex: "000123", bits: 10, data: []uint8{0x23, 0x01}, str: "123"},
+		{hex: "4BA00477", bits: 32, data: []uint8{0x77, 0x04, 0xA0, 0x4B}, str: "4BA00477"},
+		{hex: "", bits: 0, data: []uint8{}, str: ""},
+	} {
+		t.Run(test.hex, func(s *testing.T) {
+			data, err := svfHex(test.hex, test.bits)
+			if nil != err {
+				s.Fatalf("unexpected error: %v", err)
+			}
+			if string(test.data) != string(data) {
+				s.Fatalf("unexpected data: % 02X", data)
+			}
+			if str := svfHexString(data, test.bits); test.str != str {
+				s.Fatalf("unexpected string: %s", str)
+			}
+		})
+	}
+
+	for _, hex := range []string{"3F", "G1"} {
+		if _, err := svfHex(hex, 5); nil == err {
+			t.Fatalf("expected error: %s", hex)
+		}
+	}
+}
+
+func TestSVF(t *testing.T) {
+
+	tap := newSimTAP()
+	svf := NewSVF(tap)
+	err := svf.Play(strings.NewReader(`
+		! select the DATA register of the middle device
+		TRST OFF;
+		ENDIR IDLE;
+		ENDDR IDLE;
+		STATE RESET IDLE;
+		FREQUENCY 1.00E+06 HZ;
+		HIR 5 TDI (1F) TDO (01) MASK (1F);
+		TIR 3 TDI (7);
+		HDR 1 TDI (0);
+		TDR 1 TDI (0);
+		SIR 4 TDI (1) TDO (1);
+		SDR 32 TDI (00000000) TDO (4BA00477) MASK (0FFFFFFF);
+		SIR 4 TDI (2) SMASK (F);
+		SDR 8 TDI (A5);
+		SDR 8 TDI (3C) TDO (A5);
+		SDR 8 TDO (3C);
+		ENDDR DRPAUSE;
+		SDR 8 TDI (C3);
+		RUNTEST 100 TCK;
+		RUNTEST DRPAUSE 20 TCK 1.0E-3 SEC MAXIMUM 1 SEC ENDSTATE IDLE;
+		FREQUENCY;
+	`))
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if 0x1F != tap.chain[0].ir || simData != tap.chain[1].ir ||
+		0x07 != tap.chain[2].ir || 0xC3 != tap.chain[1].data {
+		t.Fatalf("unexpected chain: %+v %+v %+v", *tap.chain[0], *tap.chain[1], *tap.chain[2])
+	}
+	if TAPIdle != tap.State() || svfClockMax != tap.clock {
+		t.Fatalf("unexpected state/clock: %s, %d", tap.State(), tap.clock)
+	}
+	exp := []simRun{
+		{state: TAPIdle, cycles: 100},
+		{state: TAPPauseDR, cycles: 20, min: time.Millisecond},
+	}
+	if len(exp) != len(tap.runs) {
+		t.Fatalf("unexpected runs: %v", tap.runs)
+	}
+	for i := range exp {
+		if exp[i] != tap.runs[i] {
+			t.Fatalf("unexpected run: %v", tap.runs[i])
+		}
+	}
+
+	for _, test := range []struct {
+		name string
+		svf  string
+		line int
+		tdo  bool
+	}{
+		{name: "mismatch", svf: "SIR 12 TDI (E5F);\n\nSDR 10 TDI (000) TDO (186);", line: 3, tdo: true},
+		{name: "masked", svf: "SIR 12 TDI (E5F);\nSDR 10 TDI (000) TDO (3FF) MASK (000);", line: 0},
+		{name: "missing-tdi", svf: "SDR 9 TDO (000);", line: 1},
+		{name: "end-state", svf: "\nENDIR IREXIT1;", line: 2},
+		{name: "runtest-sck", svf: "RUNTEST 10 SCK;", line: 1},
+		{name: "unsupported", svf: "SIR 4 TDI (0);\nPIOMAP (IN A);", line: 2},
+	} {
+		t.Run(test.name, func(s *testing.T) {
+			tap := newSimTAP()
+			tap.Reset()
+			err := NewSVF(tap).Play(strings.NewReader(test.svf))
+			if 0 == test.line {
+				if nil != err {
+					s.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			e, ok := err.(*SVFError)
+			if !ok || test.line != e.Line {
+				s.Fatalf("expected error on line %d: %v", test.line, err)
+			}
+			if _, ok := e.Err.(*TDOMismatchError); test.tdo != ok {
+				s.Fatalf("unexpected error: %v", e.Err)
+			}
+		})
+	}
+}
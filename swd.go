@@ -0,0 +1,529 @@
+package ft232h
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// SWD stores interface configuration settings for an ARM Serial Wire Debug
+// (SWD) host and provides methods for accessing the debug port (DP) and access
+// port (AP) registers of a target.
+// The SWD signals are on port "D": SWCLK on D0, and SWDIO on both D1 (output,
+// connected through a resistor, e.g. 470 Ω) and D2 (input, connected directly).
+// D1 is tristated while the target drives SWDIO.
+// The interface must be initialized by calling either Init or Config (not both)
+// before use. Connect must then be called to switch the target from JTAG to
+// SWD and read its debug port identification register.
+type SWD struct {
+	device *FT232H
+	config *swdConfig
+	sel    uint32 // cached value of the DP SELECT register
+	selOK  bool   // true if sel is valid
+}
+
+// String returns a descriptive string of an SWD interface.
+func (swd *SWD) String() string {
+	return fmt.Sprintf("{ FT232H: %p, Config: %s }", swd.device, swd.config)
+}
+
+// SWDConfig holds all of the configuration settings for initializing an SWD
+// interface.
+type SWDConfig struct {
+	Clock    uint32        // SWCLK rate, valid range: 92-30000000 (30 MHz)
+	Latency  byte          // 1-255 USB HiSpeed, 2-255 USB FullSpeed
+	Rounding ClockRounding // policy used when Clock is not exactly possible
+	Retries  uint          // max retries of a transfer receiving a WAIT response
+}
+
+// Constants defining the default configuration settings of an SWD interface.
+const (
+	SWDClockDefault   uint32 = 1000000 // 1 MHz
+	SWDLatencyDefault byte   = 2
+	SWDRetriesDefault uint   = 100
+)
+
+// SWDConfigDefault returns the default configuration settings for an SWD
+// interface.
+func SWDConfigDefault() *SWDConfig {
+	return swdConfigDefault().SWDConfig()
+}
+
+// GetConfig returns the current configuration settings of the SWD interface.
+// The Clock field contains the effective SWCLK rate generated by the MPSSE
+// engine.
+func (swd *SWD) GetConfig() *SWDConfig {
+	return swd.config.SWDConfig()
+}
+
+// swdConfig holds the configuration settings of an SWD interface.
+type swdConfig struct {
+	clock    mpsseClock
+	latency  uint8
+	rounding ClockRounding
+	retries  uint
+}
+
+// String returns a descriptive string of an swdConfig.
+func (c swdConfig) String() string {
+	return fmt.Sprintf("{ Clock: %s, Latency: \"%d ms\", Rounding: %s, Retries: %d }",
+		c.clock, c.latency, c.rounding, c.retries)
+}
+
+// swdConfigDefault returns the default configuration settings of an SWD
+// interface.
+func swdConfigDefault() *swdConfig {
+	clock, _ := newMPSSEClock(SWDClockDefault, 2, ClockRoundingDefault)
+	return &swdConfig{
+		clock:    clock,
+		latency:  SWDLatencyDefault,
+		rounding: ClockRoundingDefault,
+		retries:  SWDRetriesDefault,
+	}
+}
+
+// SWDConfig returns the exported configuration settings of an swdConfig.
+func (c *swdConfig) SWDConfig() *SWDConfig {
+	return &SWDConfig{
+		Clock:    c.clock.rate(),
+		Latency:  c.latency,
+		Rounding: c.rounding,
+		Retries:  c.retries,
+	}
+}
+
+// Constants defining the SWD signals on port "D", and the pin levels and
+// directions used to initialize them.
+const (
+	swdCLK  uint8 = 0x01 // D0, SWCLK output
+	swdOut  uint8 = 0x02 // D1, SWDIO output (through resistor)
+	swdIn   uint8 = 0x04 // D2, SWDIO input
+	swdDir        = swdCLK | swdOut
+	swdVal        = swdOut // SWCLK idles LOW, SWDIO HIGH
+	swdIdle uint  = 8      // idle cycles (SWDIO LOW) after each transfer
+)
+
+// Constants defining the acknowledgement (ACK) responses of an SWD target.
+const (
+	swdAckOK    uint8 = 0x1
+	swdAckWait  uint8 = 0x2
+	swdAckFault uint8 = 0x4
+)
+
+// Errors returned by SWD transfers. After ErrSWDFault, the sticky error flags
+// of the debug port must be cleared (see ClearErrors), and after ErrSWDNoAck or
+// ErrSWDParity, the line must be reset (see Connect) before any other transfer
+// will succeed.
+var (
+	// ErrSWDWait is returned when the target responds WAIT to more than the
+	// configured number of retries of a transfer.
+	ErrSWDWait = errors.New("swd target responded WAIT")
+	// ErrSWDFault is returned when the target responds FAULT to a transfer.
+	ErrSWDFault = errors.New("swd target responded FAULT")
+	// ErrSWDNoAck is returned when the target does not respond to a transfer.
+	ErrSWDNoAck = errors.New("swd target did not respond")
+	// ErrSWDParity is returned when the parity of data read from the target is
+	// invalid.
+	ErrSWDParity = errors.New("swd parity error")
+)
+
+// Constants defining the addresses of the debug port (DP) registers.
+const (
+	SWDDPIDR    uint8 = 0x0 // identification (read)
+	SWDAbort    uint8 = 0x0 // abort, clear sticky errors (write)
+	SWDCtrlStat uint8 = 0x4 // control/status
+	SWDSelect   uint8 = 0x8 // AP select (write)
+	SWDRdBuff   uint8 = 0xC // read buffer (read)
+)
+
+// Constants defining the bits of the DP ABORT and CTRL/STAT registers.
+const (
+	swdAbortClear   uint32 = 0x0000001E // STKCMPCLR, STKERRCLR, WDERRCLR, ORUNERRCLR
+	swdAbortOrunClr uint32 = 0x00000010 // ORUNERRCLR
+	swdOrunDetect   uint32 = 1 << 0
+	swdCDbgPwrUpReq uint32 = 1 << 28
+	swdCDbgPwrUpAck uint32 = 1 << 29
+	swdCSysPwrUpReq uint32 = 1 << 30
+	swdCSysPwrUpAck uint32 = 1 << 31
+	swdPowerUpTries uint   = 100
+)
+
+// Config changes the configuration settings of the SWD interface and
+// (re)initializes it.
+// If cfg is nil, the default configuration is used (see SWDConfigDefault), and
+// any zero Clock, Latency, or Retries field is replaced by its default value.
+func (swd *SWD) Config(cfg *SWDConfig) error {
+
+	if err := swd.configure(cfg); nil != err {
+		return err
+	}
+
+	return swd.Init()
+}
+
+// configure validates the given configuration and, only if it is valid, stores
+// it as the current configuration without initializing the SWD interface.
+// If the given configuration is nil, the default configuration is used.
+func (swd *SWD) configure(cfg *SWDConfig) error {
+
+	if nil == cfg {
+		cfg = SWDConfigDefault()
+	}
+
+	rate := cfg.Clock
+	if 0 == rate {
+		rate = SWDClockDefault
+	}
+
+	clock, err := newMPSSEClock(rate, 2, cfg.Rounding)
+	if nil != err {
+		return err
+	}
+
+	swd.config.clock = clock
+	swd.config.rounding = cfg.Rounding
+
+	if 0 == cfg.Latency {
+		swd.config.latency = SWDLatencyDefault
+	} else {
+		swd.config.latency = cfg.Latency
+	}
+
+	if 0 == cfg.Retries {
+		swd.config.retries = SWDRetriesDefault
+	} else {
+		swd.config.retries = cfg.Retries
+	}
+
+	return nil
+}
+
+// Init initializes the SWD interface to a state ready for use.
+// If Config has not been called, the default configuration is used (see
+// SWDConfigDefault).
+// If the interface is already initialized, it is first closed before
+// initializing the interface.
+func (swd *SWD) Init() error {
+
+	// close any open channels before trying to init
+	if err := swd.device.Close(); nil != err {
+		return err
+	}
+
+	if err := mpsseInit(swd.device.info, swd.config.latency,
+		swd.config.clock, swdVal, swdDir); nil != err {
+		return err
+	}
+
+	swd.device.mode = ModeSWD
+	swd.selOK = false
+
+	return swd.device.GPIO.Init() // reset GPIO
+}
+
+// Close closes both the SWD interface and the connection to the FT232H device.
+func (swd *SWD) Close() error {
+	swd.selOK = false
+	return swd.device.Close()
+}
+
+// LineReset resets the SWD line by clocking at least 50 cycles with SWDIO
+// HIGH, followed by idle cycles. A debug port read of SWDDPIDR must follow a
+// line reset.
+func (swd *SWD) LineReset() error {
+	cmd := &swdCmd{}
+	cmd.drive(true)
+	cmd.lineReset()
+	cmd.idle()
+	_, err := swd.exec(cmd)
+	swd.selOK = false
+	return err
+}
+
+// SwitchFromJTAG sends the JTAG-to-SWD select sequence, surrounded by line
+// resets, which switches a target with a SWJ-DP from JTAG to SWD.
+func (swd *SWD) SwitchFromJTAG() error {
+	cmd := &swdCmd{}
+	cmd.drive(true)
+	cmd.lineReset()
+	cmd.shift([]uint8{0x9E, 0xE7}, 16, false) // 0xE79E, LSB first
+	cmd.lineReset()
+	cmd.idle()
+	_, err := swd.exec(cmd)
+	swd.selOK = false
+	return err
+}
+
+// Connect switches the target from JTAG to SWD, reads its debug port
+// identification register (DPIDR), and clears any sticky errors.
+func (swd *SWD) Connect() (uint32, error) {
+	if err := swd.SwitchFromJTAG(); nil != err {
+		return 0, err
+	}
+	id, err := swd.ReadDP(SWDDPIDR)
+	if nil != err {
+		return 0, err
+	}
+	return id, swd.ClearErrors()
+}
+
+// ClearErrors clears the sticky error flags of the debug port, which must be
+// done after a transfer fails with ErrSWDFault.
+func (swd *SWD) ClearErrors() error {
+	return swd.WriteDP(SWDAbort, swdAbortClear)
+}
+
+// PowerUp requests power-up of the debug and system domains of the target, and
+// waits for the requests to be acknowledged.
+// Overrun detection is also enabled, so that the target expects the data phase
+// that every transfer clocks, even when it responds WAIT.
+func (swd *SWD) PowerUp() error {
+	req := swdCDbgPwrUpReq | swdCSysPwrUpReq | swdOrunDetect
+	if err := swd.WriteDP(SWDCtrlStat, req); nil != err {
+		return err
+	}
+	for i := uint(0); i < swdPowerUpTries; i++ {
+		stat, err := swd.ReadDP(SWDCtrlStat)
+		if nil != err {
+			return err
+		}
+		if ack := swdCDbgPwrUpAck | swdCSysPwrUpAck; ack == stat&ack {
+			return nil
+		}
+	}
+	return fmt.Errorf("swd power-up not acknowledged")
+}
+
+// ReadDP reads the debug port register at the given address (0x0-0xC).
+func (swd *SWD) ReadDP(addr uint8) (uint32, error) {
+	return swd.transfer(false, true, addr, 0)
+}
+
+// WriteDP writes the given value to the debug port register at the given
+// address (0x0-0xC).
+func (swd *SWD) WriteDP(addr uint8, val uint32) error {
+	_, err := swd.transfer(false, false, addr, val)
+	if SWDSelect == addr {
+		swd.sel, swd.selOK = val, nil == err
+	}
+	return err
+}
+
+// ReadAP reads the register at the given address (0x00-0xFC) of the access port
+// with the given index.
+func (swd *SWD) ReadAP(ap uint8, addr uint8) (uint32, error) {
+	val, err := swd.readAP(ap, addr, 1)
+	if nil != err {
+		return 0, err
+	}
+	return val[0], nil
+}
+
+// WriteAP writes the given value to the register at the given address
+// (0x00-0xFC) of the access port with the given index.
+func (swd *SWD) WriteAP(ap uint8, addr uint8, val uint32) error {
+	if err := swd.selectAP(ap, addr); nil != err {
+		return err
+	}
+	_, err := swd.transfer(true, false, addr, val)
+	return err
+}
+
+// readAP reads the register at the given address of the access port with the
+// given index n times in succession. Since AP reads are posted, each read
+// returns the result of the previous read, and the result of the last read is
+// read from the DP RDBUFF register.
+func (swd *SWD) readAP(ap uint8, addr uint8, n uint) ([]uint32, error) {
+	if err := swd.selectAP(ap, addr); nil != err {
+		return nil, err
+	}
+	val := make([]uint32, n)
+	if _, err := swd.transfer(true, true, addr, 0); nil != err {
+		return nil, err
+	}
+	for i := uint(1); i < n; i++ {
+		v, err := swd.transfer(true, true, addr, 0)
+		if nil != err {
+			return nil, err
+		}
+		val[i-1] = v
+	}
+	v, err := swd.ReadDP(SWDRdBuff)
+	if nil != err {
+		return nil, err
+	}
+	val[n-1] = v
+	return val, nil
+}
+
+// selectAP writes the DP SELECT register to select the given access port and
+// the register bank containing the given address, if not already selected.
+func (swd *SWD) selectAP(ap uint8, addr uint8) error {
+	sel := uint32(ap)<<24 | uint32(addr&0xF0)
+	if swd.selOK && sel == swd.sel {
+		return nil
+	}
+	return swd.WriteDP(SWDSelect, sel)
+}
+
+// transfer performs a single SWD transfer to or from a DP or AP register,
+// retrying up to the configured number of times while the target responds
+// WAIT. Each attempt requires only one USB round trip (see swdTransfer).
+func (swd *SWD) transfer(ap bool, read bool, addr uint8, val uint32) (uint32, error) {
+
+	req := swdRequest(ap, read, addr)
+
+	for i := uint(0); ; i++ {
+
+		out, err := swd.exec(swdTransfer(req, read, val))
+		if nil != err {
+			return 0, err
+		}
+
+		switch swdAck(out) {
+		case swdAckOK:
+			if !read {
+				return 0, nil
+			}
+			v, ok := swdParse(out, swdDataBit)
+			if !ok {
+				swd.selOK = false
+				return 0, ErrSWDParity
+			}
+			return v, nil
+		case swdAckWait:
+			// the data phase clocked after WAIT sets the sticky overrun flag, which
+			// must be cleared before any other transfer.
+			if ap || read || SWDAbort != addr {
+				if err := swd.WriteDP(SWDAbort, swdAbortOrunClr); nil != err {
+					return 0, err
+				}
+			}
+			if i < swd.config.retries {
+				continue
+			}
+			return 0, ErrSWDWait
+		case swdAckFault:
+			return 0, ErrSWDFault
+		default:
+			swd.selOK = false
+			return 0, ErrSWDNoAck
+		}
+	}
+}
+
+// swdDataBit is the index of the first bit of data read in the bits sampled
+// during an SWD transfer, following the request, turnaround, and ACK.
+const swdDataBit uint = 12
+
+// swdTransfer returns the command stream of a single SWD transfer with the given
+// request header, writing val if read is false. The request, ACK, and data
+// phase are queued together, so that the transfer requires only one USB round
+// trip. The data phase is therefore clocked even if the target does not respond
+// OK, which the target expects with overrun detection enabled (see PowerUp).
+func swdTransfer(req uint8, read bool, val uint32) *swdCmd {
+	cmd := &swdCmd{}
+	cmd.drive(true)
+	cmd.shift([]uint8{req}, 8, false)
+	cmd.drive(false)
+	cmd.shift(nil, 4, false) // turnaround and ACK
+	if read {
+		cmd.shift(nil, 33, false) // data and parity
+	}
+	cmd.shift(nil, 1, false) // turnaround
+	cmd.drive(true)
+	if !read {
+		cmd.shift(swdData(val), 33, false)
+	}
+	cmd.idle()
+	return cmd
+}
+
+// exec sends the given command stream to the MPSSE engine and returns the bits
+// sampled from SWDIO.
+func (swd *SWD) exec(cmd *swdCmd) ([]uint8, error) {
+	cmd.flush()
+	if _, err := _FT_Write(swd.device.info, cmd.buf); nil != err {
+		return nil, err
+	}
+	resp, err := _FT_Read(swd.device.info, uint(len(cmd.resp)))
+	if nil != err {
+		return nil, err
+	}
+	return cmd.parse(resp), nil
+}
+
+// swdRequest returns the 8-bit request header of an SWD transfer (LSB first):
+// start bit, APnDP, RnW, A[3:2], parity, stop bit, and park bit.
+func swdRequest(ap bool, read bool, addr uint8) uint8 {
+	req := (addr & 0x0C) << 1
+	if ap {
+		req |= 0x02
+	}
+	if read {
+		req |= 0x04
+	}
+	if 0 != bits.OnesCount8(req)&1 {
+		req |= 0x20
+	}
+	return req | 0x81
+}
+
+// swdAck returns the 3-bit ACK sampled after the 8-bit request header and the
+// turnaround cycle.
+func swdAck(out []uint8) uint8 {
+	var ack uint8
+	for i := uint(0); i < 3; i++ {
+		if jtagBit(out, 9+i) {
+			ack |= 1 << i
+		}
+	}
+	return ack
+}
+
+// swdData returns the 33 bits (LSB first) of the given data value followed by
+// its parity bit.
+func swdData(val uint32) []uint8 {
+	return []uint8{uint8(val), uint8(val >> 8), uint8(val >> 16), uint8(val >> 24),
+		uint8(bits.OnesCount32(val) & 1)}
+}
+
+// swdParse returns the data value contained in the 33 bits (LSB first) sampled
+// from SWDIO beginning with bit off, and false if its parity bit is invalid.
+func swdParse(out []uint8, off uint) (uint32, bool) {
+	var val uint32
+	for i := uint(0); i < 32; i++ {
+		if jtagBit(out, off+i) {
+			val |= 1 << i
+		}
+	}
+	return val, jtagBit(out, off+32) == (0 != bits.OnesCount32(val)&1)
+}
+
+// swdCmd is a command stream sent to the MPSSE engine to perform SWD
+// operations. SWD uses the same data shifting commands as JTAG, driving SWDIO
+// from TDI (D1) on the falling edge of SWCLK and sampling it from TDO (D2) on
+// the rising edge.
+type swdCmd struct {
+	jtagCmd
+}
+
+// drive appends a command that enables (if on is true) or tristates the SWDIO
+// output (D1).
+func (c *swdCmd) drive(on bool) {
+	dir := swdCLK
+	if on {
+		dir |= swdOut
+	}
+	c.buf = append(c.buf, mpsseSetDataBitsLowByte, swdVal, dir)
+}
+
+// lineReset appends commands that clock 56 cycles with SWDIO HIGH.
+func (c *swdCmd) lineReset() {
+	c.shift(jtagFill(0, 56), 56, false)
+}
+
+// idle appends commands that clock idle cycles with SWDIO LOW.
+func (c *swdCmd) idle() {
+	c.shift(nil, swdIdle, false)
+}
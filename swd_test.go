@@ -0,0 +1,171 @@
+package ft232h
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestSWDRequest(t *testing.T) {
+
+	for _, test := range []struct {
+		ap, read bool
+		addr     uint8
+		req      uint8
+	}{
+		{ap: false, read: true, addr: SWDDPIDR, req: 0xA5},
+		{ap: false, read: false, addr: SWDAbort, req: 0x81},
+		{ap: false, read: true, addr: SWDCtrlStat, req: 0x8D},
+		{ap: false, read: false, addr: SWDSelect, req: 0xB1},
+		{ap: false, read: true, addr: SWDRdBuff, req: 0xBD},
+		{ap: true, read: false, addr: memAPTAR, req: 0x8B},
+		{ap: true, read: true, addr: memAPDRW, req: 0x9F},
+		{ap: true, read: true, addr: memAPIDR, req: 0x9F},
+	} {
+		t.Run(fmt.Sprintf("%t-%t-0x%02X", test.ap, test.read, test.addr), func(s *testing.T) {
+			if req := swdRequest(test.ap, test.read, test.addr); test.req != req {
+				s.Fatalf("unexpected request: 0x%02X", req)
+			}
+		})
+	}
+
+	cmd := &swdCmd{}
+	cmd.drive(true)
+	cmd.shift([]uint8{0xA5}, 8, false)
+	cmd.drive(false)
+	cmd.shift(nil, 4, false)
+	if exp := []uint8{0x80, 0x02, 0x03, 0x39, 0x00, 0x00, 0xA5,
+		0x80, 0x02, 0x01, 0x3B, 0x03, 0x00}; !bytes.Equal(exp, cmd.buf) {
+		t.Fatalf("unexpected commands: % 02X", cmd.buf)
+	}
+
+	// request (read back), turnaround, then ACK bits (LSB first)
+	for ack, out := range map[uint8][]uint8{
+		swdAckOK:    {0xA5, 0x02},
+		swdAckWait:  {0xA5, 0x04},
+		swdAckFault: {0xA5, 0x08},
+		0x7:         {0xA5, 0x0F},
+	} {
+		if a := swdAck(out); ack != a {
+			t.Fatalf("unexpected ACK: %d", a)
+		}
+	}
+}
+
+func TestSWDData(t *testing.T) {
+
+	for _, val := range []uint32{0x00000000, 0x00000001, 0x2BA01477, 0xFFFFFFFF, 0x80000000} {
+		data := swdData(val)
+		if v, ok := swdParse(data, 0); !ok || val != v {
+			t.Fatalf("unexpected data: 0x%08X (%t)", v, ok)
+		}
+		data[4] ^= 1
+		if _, ok := swdParse(data, 0); ok {
+			t.Fatalf("expected parity error: 0x%08X", val)
+		}
+	}
+	if exp := []uint8{0x77, 0x14, 0xA0, 0x2B, 0x00}; !bytes.Equal(exp, swdData(0x2BA01477)) {
+		t.Fatalf("unexpected data: % 02X", swdData(0x2BA01477))
+	}
+}
+
+func TestSWDTransfer(t *testing.T) {
+
+	for _, test := range []struct {
+		name string
+		read bool
+		bits uint // bits sampled
+	}{
+		{name: "read", read: true, bits: 8 + 4 + 33 + 1 + swdIdle},
+		{name: "write", read: false, bits: 8 + 4 + 1 + 33 + swdIdle},
+	} {
+		t.Run(test.name, func(s *testing.T) {
+			cmd := swdTransfer(swdRequest(true, test.read, memAPDRW), test.read, 0x2BA01477)
+			var bits uint
+			for _, n := range cmd.resp {
+				bits += uint(n)
+			}
+			if test.bits != bits {
+				s.Fatalf("unexpected number of bits sampled: %d != %d", bits, test.bits)
+			}
+			cmd.flush()
+			if n := bytes.Count(cmd.buf, []uint8{mpsseSendImmediate}); 1 != n ||
+				mpsseSendImmediate != cmd.buf[len(cmd.buf)-1] {
+				s.Fatalf("expected a single round trip: % 02X", cmd.buf)
+			}
+		})
+	}
+
+	// request (read back), turnaround, ACK OK, then data and parity
+	out := make([]uint8, 6)
+	out[0], out[1] = 0x9F, 0x02
+	for i, b := range swdData(0x2BA01477) {
+		for j := uint(0); j < 8; j++ {
+			if k := swdDataBit + 8*uint(i) + j; 0 != (b>>j)&1 && k < swdDataBit+33 {
+				out[k/8] |= 1 << (k % 8)
+			}
+		}
+	}
+	if swdAckOK != swdAck(out) {
+		t.Fatalf("unexpected ACK: %d", swdAck(out))
+	}
+	if v, ok := swdParse(out, swdDataBit); !ok || 0x2BA01477 != v {
+		t.Fatalf("unexpected data: 0x%08X (%t)", v, ok)
+	}
+}
+
+func TestMemAPBlock(t *testing.T) {
+
+	for _, test := range []struct {
+		addr uint32
+		n, k uint
+	}{
+		{addr: 0x20000000, n: 1, k: 1},
+		{addr: 0x20000000, n: 256, k: 256},
+		{addr: 0x20000000, n: 300, k: 256},
+		{addr: 0x200003FC, n: 4, k: 1},
+		{addr: 0x20000100, n: 1000, k: 192},
+	} {
+		if k := memAPBlock(test.addr, test.n); test.k != k {
+			t.Fatalf("unexpected block at 0x%08X: %d", test.addr, k)
+		}
+	}
+}
+
+func TestSWDConfig(t *testing.T) {
+
+	swd := &SWD{config: swdConfigDefault()}
+	init := *swd.config
+
+	if err := swd.configure(&SWDConfig{Clock: 40000000,
+		Rounding: ClockAtLeast}); nil == err {
+		t.Fatalf("expected error for invalid configuration")
+	}
+	if init != *swd.config {
+		t.Fatalf("configuration changed: %s != %s", *swd.config, init)
+	}
+
+	for _, test := range []struct {
+		name string
+		cfg  *SWDConfig
+		want SWDConfig
+	}{
+		{name: "nil", cfg: nil, want: *SWDConfigDefault()},
+		{name: "zero", cfg: &SWDConfig{}, want: *SWDConfigDefault()},
+		{name: "retries", cfg: &SWDConfig{Clock: 6000000, Latency: 16},
+			want: SWDConfig{Clock: 6000000, Latency: 16,
+				Retries: SWDRetriesDefault}},
+		{name: "clock", cfg: &SWDConfig{Retries: 5},
+			want: SWDConfig{Clock: SWDClockDefault,
+				Latency: SWDLatencyDefault, Retries: 5}},
+	} {
+		t.Run(test.name, func(s *testing.T) {
+			if err := swd.configure(test.cfg); nil != err {
+				s.Fatalf("configure(): %v", err)
+			}
+			if got := swd.GetConfig(); test.want != *got {
+				s.Fatalf("unexpected configuration: %+v != %+v", *got, test.want)
+			}
+		})
+	}
+}
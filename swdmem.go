@@ -0,0 +1,174 @@
+package ft232h
+
+import (
+	"fmt"
+)
+
+// SWDMemAP provides access to the memory of an SWD target through a memory
+// access port (MEM-AP), using 32-bit transfers.
+type SWDMemAP struct {
+	swd   *SWD
+	ap    uint8
+	csw   uint32 // value of the CSW register written
+	cswOK bool   // true if csw is valid
+}
+
+// MemAP returns a memory access port of the SWD target with the given index.
+func (swd *SWD) MemAP(ap uint8) *SWDMemAP {
+	return &SWDMemAP{swd: swd, ap: ap}
+}
+
+// String returns a descriptive string of an SWDMemAP.
+func (m *SWDMemAP) String() string {
+	return fmt.Sprintf("{ AP: %d, CSW: 0x%08X }", m.ap, m.csw)
+}
+
+// Constants defining the addresses and bits of the MEM-AP registers.
+const (
+	memAPCSW        uint8  = 0x00 // control/status word
+	memAPTAR        uint8  = 0x04 // transfer address
+	memAPDRW        uint8  = 0x0C // data read/write
+	memAPIDR        uint8  = 0xFC // identification
+	memAPCSWMask    uint32 = 0x00000037
+	memAPCSWSize32  uint32 = 0x00000002 // 32-bit transfers
+	memAPCSWAddrInc uint32 = 0x00000010 // auto-increment TAR (single)
+	memAPWrap       uint32 = 0x400      // TAR auto-increment boundary (bytes)
+)
+
+// Constants defining the Cortex-M debug registers used to halt and resume a
+// core.
+const (
+	swdDHCSR       uint32 = 0xE000EDF0 // Debug Halting Control and Status
+	swdDHCSRKey    uint32 = 0xA05F0000 // DBGKEY, required for writes
+	swdDHCSRDebug  uint32 = 1 << 0     // C_DEBUGEN
+	swdDHCSRHalt   uint32 = 1 << 1     // C_HALT
+	swdDHCSRHalted uint32 = 1 << 17    // S_HALT
+)
+
+// IDR returns the identification register of the MEM-AP, which is 0 if the
+// access port does not exist.
+func (m *SWDMemAP) IDR() (uint32, error) {
+	return m.swd.ReadAP(m.ap, memAPIDR)
+}
+
+// Invalidate discards the cached CSW register, so that it is written before the
+// next memory access. This must be called if the CSW register is written
+// directly (see SWD.WriteAP).
+func (m *SWDMemAP) Invalidate() {
+	m.cswOK = false
+}
+
+// setup writes the CSW register for 32-bit auto-incrementing transfers, if not
+// already written, preserving its other bits.
+func (m *SWDMemAP) setup() error {
+	if m.cswOK {
+		return nil
+	}
+	csw, err := m.swd.ReadAP(m.ap, memAPCSW)
+	if nil != err {
+		return err
+	}
+	csw = csw&^memAPCSWMask | memAPCSWSize32 | memAPCSWAddrInc
+	if err := m.swd.WriteAP(m.ap, memAPCSW, csw); nil != err {
+		return err
+	}
+	m.csw, m.cswOK = csw, true
+	return nil
+}
+
+// Read32 reads the 32-bit word at the given (word-aligned) address.
+func (m *SWDMemAP) Read32(addr uint32) (uint32, error) {
+	val, err := m.Read(addr, 1)
+	if nil != err {
+		return 0, err
+	}
+	return val[0], nil
+}
+
+// Write32 writes a 32-bit word to the given (word-aligned) address.
+func (m *SWDMemAP) Write32(addr uint32, val uint32) error {
+	return m.Write(addr, []uint32{val})
+}
+
+// Read reads n 32-bit words beginning at the given (word-aligned) address.
+func (m *SWDMemAP) Read(addr uint32, n uint) ([]uint32, error) {
+	if 0 != addr&3 {
+		return nil, fmt.Errorf("invalid address (not word-aligned): 0x%08X", addr)
+	}
+	if err := m.setup(); nil != err {
+		return nil, err
+	}
+	val := make([]uint32, 0, n)
+	for n > 0 {
+		k := memAPBlock(addr, n)
+		if err := m.swd.WriteAP(m.ap, memAPTAR, addr); nil != err {
+			m.cswOK = false
+			return nil, err
+		}
+		v, err := m.swd.readAP(m.ap, memAPDRW, k)
+		if nil != err {
+			m.cswOK = false
+			return nil, err
+		}
+		val = append(val, v...)
+		addr += uint32(4 * k)
+		n -= k
+	}
+	return val, nil
+}
+
+// Write writes the given 32-bit words beginning at the given (word-aligned)
+// address.
+func (m *SWDMemAP) Write(addr uint32, data []uint32) error {
+	if 0 != addr&3 {
+		return fmt.Errorf("invalid address (not word-aligned): 0x%08X", addr)
+	}
+	if err := m.setup(); nil != err {
+		return err
+	}
+	for len(data) > 0 {
+		k := memAPBlock(addr, uint(len(data)))
+		if err := m.swd.WriteAP(m.ap, memAPTAR, addr); nil != err {
+			m.cswOK = false
+			return err
+		}
+		for _, v := range data[:k] {
+			if err := m.swd.WriteAP(m.ap, memAPDRW, v); nil != err {
+				m.cswOK = false
+				return err
+			}
+		}
+		addr += uint32(4 * k)
+		data = data[k:]
+	}
+	return nil
+}
+
+// memAPBlock returns the number of words, at most n, that can be transferred
+// beginning at the given address before TAR auto-increment wraps.
+func memAPBlock(addr uint32, n uint) uint {
+	if k := uint(memAPWrap-addr%memAPWrap) / 4; k < n {
+		return k
+	}
+	return n
+}
+
+// Halt halts the Cortex-M core, enabling halting debug.
+func (m *SWDMemAP) Halt() error {
+	return m.Write32(swdDHCSR, swdDHCSRKey|swdDHCSRDebug|swdDHCSRHalt)
+}
+
+// Resume resumes execution of the halted Cortex-M core, leaving halting debug
+// enabled.
+func (m *SWDMemAP) Resume() error {
+	return m.Write32(swdDHCSR, swdDHCSRKey|swdDHCSRDebug)
+}
+
+// Halted returns true if the Cortex-M core is halted.
+func (m *SWDMemAP) Halted() (bool, error) {
+	dhcsr, err := m.Read32(swdDHCSR)
+	if nil != err {
+		return false, err
+	}
+	return 0 != dhcsr&swdDHCSRHalted, nil
+}
@@ -0,0 +1,444 @@
+package ft232h
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceBus identifies the interface on which a traced transfer was performed.
+type TraceBus uint8
+
+// Constants defining the interfaces that can be traced.
+const (
+	TraceI2C TraceBus = iota + 1
+	TraceSPI
+)
+
+// String returns a descriptive string of a TraceBus.
+func (b TraceBus) String() string {
+	switch b {
+	case TraceI2C:
+		return "I2C"
+	case TraceSPI:
+		return "SPI"
+	}
+	return fmt.Sprintf("TraceBus(%d)", uint8(b))
+}
+
+// TraceOp identifies the direction of a traced transfer.
+type TraceOp uint8
+
+// Constants defining the direction of traced transfers.
+const (
+	TraceRead  TraceOp = iota + 1 // data received from slave
+	TraceWrite                    // data sent to slave
+	TraceSwap                     // data sent and received simultaneously (SPI)
+)
+
+// String returns a descriptive string of a TraceOp.
+func (o TraceOp) String() string {
+	switch o {
+	case TraceRead:
+		return "R"
+	case TraceWrite:
+		return "W"
+	case TraceSwap:
+		return "RW"
+	}
+	return fmt.Sprintf("TraceOp(%d)", uint8(o))
+}
+
+// TraceEvent records a single transfer performed on a traced interface.
+// Multi-message I²C transactions (Transfer, Tx) are recorded as one event per
+// message, sharing the same Time and Dur; the transaction's error, if any, is
+// recorded with its last message.
+// The Tx and Rx slices are copies, which remain valid after the caller reuses
+// the buffers of the transfer.
+type TraceEvent struct {
+	Time  time.Time     // time the transfer began
+	Dur   time.Duration // time taken to perform the transfer
+	Bus   TraceBus      // interface used for transfer
+	Op    TraceOp       // direction of transfer
+	Addr  I2CAddr       // I²C slave address
+	CS    Pin           // SPI chip-select pin (nil if none)
+	Slave int           // SPI slave index with a ChipSelect strategy, or -1
+	Start bool          // start condition (I²C) or CS assertion (SPI)
+	Stop  bool          // stop condition (I²C) or CS de-assertion (SPI)
+	Tx    []uint8       // bytes written
+	Rx    []uint8       // bytes read
+	Count uint          // bytes successfully transferred
+	Err   error         // non-nil if the transfer failed
+}
+
+// String returns a decoded, single-line description of a TraceEvent, e.g.:
+//
+//	15:04:05.000000 I2C 0x40 W S [01 02] P (2 bytes, 120µs)
+func (e *TraceEvent) String() string {
+
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "%s %s ", e.Time.Format("15:04:05.000000"), e.Bus)
+	switch e.Bus {
+	case TraceI2C:
+		sb.WriteString(e.Addr.String())
+	case TraceSPI:
+		if e.Slave >= 0 {
+			fmt.Fprintf(&sb, "#%d", e.Slave)
+		} else if nil != e.CS {
+			sb.WriteString(e.CS.String())
+		} else {
+			sb.WriteString("-")
+		}
+	}
+	fmt.Fprintf(&sb, " %s", e.Op)
+	if e.Start {
+		sb.WriteString(" S")
+	}
+	if nil != e.Tx || TraceWrite == e.Op || TraceSwap == e.Op {
+		fmt.Fprintf(&sb, " [% 02X]", e.Tx)
+	}
+	if nil != e.Rx || TraceRead == e.Op || TraceSwap == e.Op {
+		fmt.Fprintf(&sb, " <% 02X>", e.Rx)
+	}
+	if e.Stop {
+		sb.WriteString(" P")
+	}
+	fmt.Fprintf(&sb, " (%d bytes, %s)", e.Count, e.Dur)
+	if nil != e.Err {
+		fmt.Fprintf(&sb, ": %v", e.Err)
+	}
+	return sb.String()
+}
+
+// Tracer is the interface implemented by sinks of traced transfers.
+// Trace is called synchronously after each transfer on a traced interface
+// completes, so it should return quickly. The event, including its data, must
+// not be modified, but may be retained.
+type Tracer interface {
+	Trace(e *TraceEvent)
+}
+
+// TracerFunc is a function that implements Tracer.
+type TracerFunc func(e *TraceEvent)
+
+// Trace calls f(e).
+func (f TracerFunc) Trace(e *TraceEvent) { f(e) }
+
+// TraceLog is a Tracer that writes each event as a line of text (see
+// TraceEvent.String) to the given writer.
+func TraceLog(w io.Writer) Tracer {
+	return TracerFunc(func(e *TraceEvent) {
+		fmt.Fprintln(w, e)
+	})
+}
+
+// TraceRing is a Tracer that retains the most recent events in a fixed-size
+// ring buffer. It is safe for concurrent use.
+type TraceRing struct {
+	mu     sync.Mutex
+	events []*TraceEvent
+	next   int  // index of next event written
+	full   bool // true if the buffer has wrapped around
+}
+
+// NewTraceRing returns a TraceRing retaining at most size events.
+func NewTraceRing(size uint) *TraceRing {
+	if 0 == size {
+		size = 1
+	}
+	return &TraceRing{events: make([]*TraceEvent, size)}
+}
+
+// Trace adds the given event to the ring buffer, discarding the oldest event if
+// the buffer is full.
+func (r *TraceRing) Trace(e *TraceEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events[r.next] = e
+	r.next++
+	if r.next == len(r.events) {
+		r.next, r.full = 0, true
+	}
+}
+
+// Events returns the events in the ring buffer, oldest first.
+func (r *TraceRing) Events() []*TraceEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]*TraceEvent{}, r.events[:r.next]...)
+	}
+	return append(append([]*TraceEvent{}, r.events[r.next:]...), r.events[:r.next]...)
+}
+
+// Reset discards all events in the ring buffer.
+func (r *TraceRing) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.events {
+		r.events[i] = nil
+	}
+	r.next, r.full = 0, false
+}
+
+// traceFileMagic identifies a trace file written by TraceWriter.
+const traceFileMagic = "FT232HTR"
+
+// traceFileVersion is the version of the trace file format.
+const traceFileVersion uint16 = 1
+
+// traceRecord is the fixed-size header of each event in a trace file, followed
+// by TxLen bytes written, RxLen bytes read, and ErrLen bytes of error message.
+// All fields are little-endian.
+type traceRecord struct {
+	Time   int64 // Unix time (nanoseconds)
+	Dur    int64 // nanoseconds
+	Bus    uint8
+	Op     uint8
+	Flags  uint8 // bit 0: start, bit 1: stop
+	Port   uint8 // 'D' or 'C' if CS is a DPin or CPin, otherwise 0
+	CS     uint8 // CS pin mask
+	_      uint8
+	Addr   uint16
+	Slave  int32
+	Count  uint32
+	TxLen  uint32
+	RxLen  uint32
+	ErrLen uint32
+}
+
+// Constants defining the flags of a traceRecord.
+const (
+	traceFlagStart uint8 = 1 << iota
+	traceFlagStop
+)
+
+// TraceWriter is a Tracer that writes events to a binary trace file for
+// offline analysis, which can be read with TraceReader. It is safe for
+// concurrent use.
+type TraceWriter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	err error
+}
+
+// NewTraceWriter writes the trace file header to the given writer, returning a
+// TraceWriter that writes each event to it.
+func NewTraceWriter(w io.Writer) (*TraceWriter, error) {
+	if _, err := io.WriteString(w, traceFileMagic); nil != err {
+		return nil, err
+	}
+	if err := binary.Write(w, binary.LittleEndian, traceFileVersion); nil != err {
+		return nil, err
+	}
+	return &TraceWriter{w: w}, nil
+}
+
+// Trace writes the given event to the trace file. If writing fails, the error
+// is retained (see Err) and all subsequent events are discarded.
+func (t *TraceWriter) Trace(e *TraceEvent) {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if nil != t.err {
+		return
+	}
+
+	var msg string
+	if nil != e.Err {
+		msg = e.Err.Error()
+	}
+
+	rec := traceRecord{
+		Time:   e.Time.UnixNano(),
+		Dur:    int64(e.Dur),
+		Bus:    uint8(e.Bus),
+		Op:     uint8(e.Op),
+		Addr:   uint16(e.Addr),
+		Slave:  int32(e.Slave),
+		Count:  uint32(e.Count),
+		TxLen:  uint32(len(e.Tx)),
+		RxLen:  uint32(len(e.Rx)),
+		ErrLen: uint32(len(msg)),
+	}
+	if e.Start {
+		rec.Flags |= traceFlagStart
+	}
+	if e.Stop {
+		rec.Flags |= traceFlagStop
+	}
+	if nil != e.CS {
+		rec.Port, rec.CS = 'C', e.CS.Mask()
+		if e.CS.IsMPSSE() {
+			rec.Port = 'D'
+		}
+	}
+
+	if t.err = binary.Write(t.w, binary.LittleEndian, &rec); nil != t.err {
+		return
+	}
+	for _, b := range [][]uint8{e.Tx, e.Rx, []uint8(msg)} {
+		if _, t.err = t.w.Write(b); nil != t.err {
+			return
+		}
+	}
+}
+
+// Err returns the first error encountered writing the trace file, if any.
+func (t *TraceWriter) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// TraceReader reads events from a trace file written by TraceWriter.
+type TraceReader struct {
+	r io.Reader
+}
+
+// NewTraceReader reads and verifies the trace file header from the given
+// reader, returning a TraceReader that reads each event from it.
+func NewTraceReader(r io.Reader) (*TraceReader, error) {
+	magic := make([]uint8, len(traceFileMagic))
+	if _, err := io.ReadFull(r, magic); nil != err {
+		return nil, err
+	}
+	if traceFileMagic != string(magic) {
+		return nil, fmt.Errorf("invalid trace file: %q", magic)
+	}
+	var ver uint16
+	if err := binary.Read(r, binary.LittleEndian, &ver); nil != err {
+		return nil, err
+	}
+	if traceFileVersion != ver {
+		return nil, fmt.Errorf("invalid trace file version: %d", ver)
+	}
+	return &TraceReader{r: r}, nil
+}
+
+// Next reads the next event from the trace file, returning io.EOF if there are
+// no more events. Errors are restored from their messages, except ErrAddrNACK,
+// which is restored as itself.
+func (t *TraceReader) Next() (*TraceEvent, error) {
+
+	var rec traceRecord
+	if err := binary.Read(t.r, binary.LittleEndian, &rec); nil != err {
+		return nil, err
+	}
+
+	read := func(n uint32) ([]uint8, error) {
+		if 0 == n {
+			return nil, nil
+		}
+		b := make([]uint8, n)
+		if _, err := io.ReadFull(t.r, b); nil != err {
+			if io.EOF == err {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		return b, nil
+	}
+
+	e := &TraceEvent{
+		Time:  time.Unix(0, rec.Time),
+		Dur:   time.Duration(rec.Dur),
+		Bus:   TraceBus(rec.Bus),
+		Op:    TraceOp(rec.Op),
+		Addr:  I2CAddr(rec.Addr),
+		Slave: int(rec.Slave),
+		Start: 0 != rec.Flags&traceFlagStart,
+		Stop:  0 != rec.Flags&traceFlagStop,
+		Count: uint(rec.Count),
+	}
+	switch rec.Port {
+	case 'D':
+		e.CS = DPin(rec.CS)
+	case 'C':
+		e.CS = CPin(rec.CS)
+	}
+
+	var err error
+	if e.Tx, err = read(rec.TxLen); nil != err {
+		return nil, err
+	}
+	if e.Rx, err = read(rec.RxLen); nil != err {
+		return nil, err
+	}
+	msg, err := read(rec.ErrLen)
+	if nil != err {
+		return nil, err
+	}
+	if len(msg) > 0 {
+		if ErrAddrNACK.Error() == string(msg) {
+			e.Err = ErrAddrNACK
+		} else {
+			e.Err = errors.New(string(msg))
+		}
+	}
+	return e, nil
+}
+
+// Trace sets the Tracer that records every transfer performed on the I²C
+// interface, or disables tracing if t is nil.
+func (i2c *I2C) Trace(t Tracer) {
+	i2c.tracer = t
+}
+
+// traceData returns a copy of the given transfer data, so that a recorded
+// TraceEvent does not alias a buffer the caller may reuse.
+func traceData(data []uint8) []uint8 {
+	return append([]uint8(nil), data...)
+}
+
+// trace records a single I²C transfer that began at the given time.
+func (i2c *I2C) trace(beg time.Time, e *TraceEvent) {
+	e.Time, e.Dur, e.Bus, e.Slave = beg, time.Since(beg), TraceI2C, -1
+	e.Tx, e.Rx = traceData(e.Tx), traceData(e.Rx)
+	i2c.tracer.Trace(e)
+}
+
+// traceMsgs records the messages of an I²C transaction that began at the given
+// time, with the transaction's error recorded with its last message.
+func (i2c *I2C) traceMsgs(beg time.Time, msgs []I2CMsg, err error) {
+	dur := time.Since(beg)
+	for i, m := range msgs {
+		e := &TraceEvent{
+			Time: beg, Dur: dur, Bus: TraceI2C, Op: TraceWrite, Addr: m.Addr,
+			Slave: -1, Start: true, Stop: i+1 == len(msgs), Tx: traceData(m.Data),
+		}
+		if m.Read {
+			e.Op, e.Tx, e.Rx = TraceRead, nil, e.Tx
+		}
+		if nil == err {
+			e.Count = uint(len(m.Data))
+		} else if e.Stop {
+			e.Err = err
+		}
+		i2c.tracer.Trace(e)
+	}
+}
+
+// Trace sets the Tracer that records every transfer performed on the SPI
+// interface, or disables tracing if t is nil.
+func (spi *SPI) Trace(t Tracer) {
+	spi.tracer = t
+}
+
+// trace records a single SPI transfer that began at the given time, using the
+// currently configured CS line.
+func (spi *SPI) trace(beg time.Time, e *TraceEvent) {
+	e.Time, e.Dur, e.Bus = beg, time.Since(beg), TraceSPI
+	e.CS, e.Slave = spi.config.chipSelect, -1
+	if nil != spi.config.selector {
+		e.CS, e.Slave = nil, int(spi.config.slave)
+	}
+	e.Tx, e.Rx = traceData(e.Tx), traceData(e.Rx)
+	spi.tracer.Trace(e)
+}
@@ -0,0 +1,73 @@
+//go:build go1.21
+// +build go1.21
+
+package ft232h
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// TraceSlog is a Tracer that logs each event to a log/slog handler, with the
+// fields of the event as attributes. Events are logged at Level, or at
+// slog.LevelError if the transfer failed.
+type TraceSlog struct {
+	Handler slog.Handler
+	Level   slog.Level
+}
+
+// NewTraceSlog returns a TraceSlog logging to the given handler at
+// slog.LevelDebug.
+func NewTraceSlog(h slog.Handler) *TraceSlog {
+	return &TraceSlog{Handler: h, Level: slog.LevelDebug}
+}
+
+// Trace logs the given event.
+func (t *TraceSlog) Trace(e *TraceEvent) {
+
+	level := t.Level
+	if nil != e.Err {
+		level = slog.LevelError
+	}
+
+	ctx := context.Background()
+	if !t.Handler.Enabled(ctx, level) {
+		return
+	}
+
+	r := slog.NewRecord(e.Time, level, "trace", 0)
+	r.AddAttrs(
+		slog.String("bus", e.Bus.String()),
+		slog.String("op", e.Op.String()),
+	)
+	switch e.Bus {
+	case TraceI2C:
+		r.AddAttrs(slog.String("addr", e.Addr.String()))
+	case TraceSPI:
+		if e.Slave >= 0 {
+			r.AddAttrs(slog.Int("slave", e.Slave))
+		} else if nil != e.CS {
+			r.AddAttrs(slog.String("cs", e.CS.String()))
+		}
+	}
+	r.AddAttrs(
+		slog.Bool("start", e.Start),
+		slog.Bool("stop", e.Stop),
+	)
+	if nil != e.Tx {
+		r.AddAttrs(slog.String("tx", fmt.Sprintf("% 02X", e.Tx)))
+	}
+	if nil != e.Rx {
+		r.AddAttrs(slog.String("rx", fmt.Sprintf("% 02X", e.Rx)))
+	}
+	r.AddAttrs(
+		slog.Uint64("count", uint64(e.Count)),
+		slog.Duration("dur", e.Dur),
+	)
+	if nil != e.Err {
+		r.AddAttrs(slog.String("err", e.Err.Error()))
+	}
+
+	t.Handler.Handle(ctx, r)
+}
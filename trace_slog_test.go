@@ -0,0 +1,36 @@
+//go:build go1.21
+// +build go1.21
+
+package ft232h
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestTraceSlog(t *testing.T) {
+
+	var buf bytes.Buffer
+	h := slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+	tr := NewTraceSlog(h)
+	for _, e := range testTraceEvents() {
+		tr.Trace(e)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if 4 != len(lines) {
+		t.Fatalf("unexpected number of records: %d", len(lines))
+	}
+	for i, attrs := range []string{
+		"level=DEBUG msg=trace bus=I2C op=W addr=0x40 start=true stop=false tx=\"01 02\" count=2",
+		"level=ERROR msg=trace bus=I2C op=R addr=0x40 start=true stop=true rx=AB count=0",
+		"level=DEBUG msg=trace bus=SPI op=RW cs=D3 start=true stop=true tx=\"9F 00\" rx=\"FF EF\" count=2",
+		"level=ERROR msg=trace bus=SPI op=W slave=5 start=false stop=false tx=00 count=0",
+	} {
+		if !strings.Contains(lines[i], attrs) {
+			t.Fatalf("unexpected record: %s", lines[i])
+		}
+	}
+}
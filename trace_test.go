@@ -0,0 +1,139 @@
+package ft232h
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testTraceEvents() []*TraceEvent {
+	beg := time.Date(2020, 1, 2, 15, 4, 5, 123456000, time.UTC)
+	return []*TraceEvent{
+		{Time: beg, Dur: 120 * time.Microsecond, Bus: TraceI2C, Op: TraceWrite,
+			Addr: 0x40, Slave: -1, Start: true, Tx: []uint8{0x01, 0x02}, Count: 2},
+		{Time: beg, Dur: 120 * time.Microsecond, Bus: TraceI2C, Op: TraceRead,
+			Addr: 0x40, Slave: -1, Start: true, Stop: true, Rx: []uint8{0xAB}, Err: ErrAddrNACK},
+		{Time: beg, Dur: time.Millisecond, Bus: TraceSPI, Op: TraceSwap, CS: D(3),
+			Slave: -1, Start: true, Stop: true, Tx: []uint8{0x9F, 0x00}, Rx: []uint8{0xFF, 0xEF}, Count: 2},
+		{Time: beg, Dur: time.Millisecond, Bus: TraceSPI, Op: TraceWrite,
+			Slave: 5, Tx: []uint8{0x00}, Err: errors.New("device error")},
+	}
+}
+
+func TestTraceEventString(t *testing.T) {
+
+	for i, str := range []string{
+		"15:04:05.123456 I2C 0x40 W S [01 02] (2 bytes, 120µs)",
+		"15:04:05.123456 I2C 0x40 R S <AB> P (0 bytes, 120µs): " + ErrAddrNACK.Error(),
+		"15:04:05.123456 SPI D3 RW S [9F 00] <FF EF> P (2 bytes, 1ms)",
+		"15:04:05.123456 SPI #5 W [00] (0 bytes, 1ms): device error",
+	} {
+		if s := testTraceEvents()[i].String(); str != s {
+			t.Fatalf("unexpected string: %q != %q", s, str)
+		}
+	}
+}
+
+func TestTraceRing(t *testing.T) {
+
+	events := testTraceEvents()
+	r := NewTraceRing(3)
+	for _, test := range []struct {
+		name   string
+		add    []*TraceEvent
+		expect []*TraceEvent
+	}{
+		{name: "empty", expect: []*TraceEvent{}},
+		{name: "partial", add: events[:2], expect: events[:2]},
+		{name: "full", add: events[2:3], expect: events[:3]},
+		{name: "wrap", add: events[3:], expect: events[1:]},
+	} {
+		t.Run(test.name, func(s *testing.T) {
+			for _, e := range test.add {
+				r.Trace(e)
+			}
+			if ev := r.Events(); !reflect.DeepEqual(test.expect, ev) {
+				s.Fatalf("unexpected events: %v", ev)
+			}
+		})
+	}
+	r.Reset()
+	if ev := r.Events(); 0 != len(ev) {
+		t.Fatalf("unexpected events after reset: %v", ev)
+	}
+}
+
+func TestTraceFile(t *testing.T) {
+
+	var buf bytes.Buffer
+	w, err := NewTraceWriter(&buf)
+	if nil != err {
+		t.Fatalf("NewTraceWriter(): %v", err)
+	}
+	events := testTraceEvents()
+	for _, e := range events {
+		w.Trace(e)
+	}
+	if err := w.Err(); nil != err {
+		t.Fatalf("Trace(): %v", err)
+	}
+
+	r, err := NewTraceReader(&buf)
+	if nil != err {
+		t.Fatalf("NewTraceReader(): %v", err)
+	}
+	for i, expect := range events {
+		e, err := r.Next()
+		if nil != err {
+			t.Fatalf("Next(): %v", err)
+		}
+		if !e.Time.Equal(expect.Time) {
+			t.Fatalf("unexpected time: %s", e.Time)
+		}
+		e.Time = expect.Time
+		if !reflect.DeepEqual(expect, e) {
+			t.Fatalf("unexpected event %d: %+v", i, e)
+		}
+	}
+	if _, err := r.Next(); io.EOF != err {
+		t.Fatalf("expected EOF: %v", err)
+	}
+
+	if _, err := NewTraceReader(bytes.NewReader([]byte("INVALID!\x01\x00"))); nil == err {
+		t.Fatalf("NewTraceReader(): expected error")
+	}
+}
+
+func TestTraceData(t *testing.T) {
+
+	r := NewTraceRing(4)
+	i2c := &I2C{config: i2cConfigDefault(), tracer: r}
+
+	// writing the reserved address 0x00 fails validation, but is still traced
+	w := []uint8{0x01, 0x02}
+	if _, err := i2c.Write(0x00, w, true, true); nil == err {
+		t.Fatalf("expected error for reserved address")
+	}
+	msgs := []I2CMsg{{Addr: 0x40, Data: []uint8{0x03}},
+		{Addr: 0x40, Read: true, Data: []uint8{0x04}}}
+	i2c.traceMsgs(time.Now(), msgs, nil)
+
+	w[0], msgs[0].Data[0], msgs[1].Data[0] = 0xFF, 0xFF, 0xFF
+
+	ev := r.Events()
+	if 3 != len(ev) {
+		t.Fatalf("unexpected events: %v", ev)
+	}
+	for i, exp := range [][]uint8{{0x01, 0x02}, {0x03}, {0x04}} {
+		data := ev[i].Tx
+		if TraceRead == ev[i].Op {
+			data = ev[i].Rx
+		}
+		if !bytes.Equal(exp, data) {
+			t.Fatalf("unexpected data of event %d: %v != %v", i, data, exp)
+		}
+	}
+}
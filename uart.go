@@ -0,0 +1,379 @@
+package ft232h
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// UART stores interface configuration settings for an asynchronous serial port
+// and implements io.ReadWriteCloser.
+// The interface must be initialized by calling either Init or Config (not both)
+// before use. Since UART mode does not use the MPSSE engine, the SPI, I²C, and
+// GPIO interfaces are unavailable until one of them is initialized again.
+type UART struct {
+	device *FT232H
+	config *UARTConfig
+}
+
+// String returns a descriptive string of a UART interface.
+func (uart *UART) String() string {
+	return fmt.Sprintf("{ FT232H: %p, Config: %s }", uart.device, uart.config)
+}
+
+// UARTParity defines the parity bit of each UART frame.
+type UARTParity uint8
+
+// Constants defining the supported parity modes (values equal to D2XX).
+const (
+	UARTParityNone  UARTParity = 0
+	UARTParityOdd   UARTParity = 1
+	UARTParityEven  UARTParity = 2
+	UARTParityMark  UARTParity = 3 // parity bit always 1
+	UARTParitySpace UARTParity = 4 // parity bit always 0
+)
+
+// String returns a descriptive string of a UARTParity.
+func (p UARTParity) String() string {
+	switch p {
+	case UARTParityNone:
+		return "N"
+	case UARTParityOdd:
+		return "O"
+	case UARTParityEven:
+		return "E"
+	case UARTParityMark:
+		return "M"
+	case UARTParitySpace:
+		return "S"
+	}
+	return "(invalid parity)"
+}
+
+// UARTFlow defines the flow control mode of the UART.
+type UARTFlow uint16
+
+// Constants defining the supported flow control modes (values equal to D2XX).
+const (
+	UARTFlowNone    UARTFlow = 0x0000
+	UARTFlowRTSCTS  UARTFlow = 0x0100
+	UARTFlowDTRDSR  UARTFlow = 0x0200
+	UARTFlowXONXOFF UARTFlow = 0x0400
+)
+
+// String returns a descriptive string of a UARTFlow.
+func (f UARTFlow) String() string {
+	switch f {
+	case UARTFlowNone:
+		return "none"
+	case UARTFlowRTSCTS:
+		return "RTS/CTS"
+	case UARTFlowDTRDSR:
+		return "DTR/DSR"
+	case UARTFlowXONXOFF:
+		return "XON/XOFF"
+	}
+	return "(invalid flow control)"
+}
+
+// UARTConfig holds all of the configuration settings for initializing a UART
+// interface.
+type UARTConfig struct {
+	Baud         uint32        // valid range: 183-12000000 (12 Mbaud)
+	DataBits     uint8         // 7 or 8
+	StopBits     uint8         // 1 or 2
+	Parity       UARTParity    // parity bit
+	Flow         UARTFlow      // flow control mode
+	XOn          byte          // XON character (UARTFlowXONXOFF only)
+	XOff         byte          // XOFF character (UARTFlowXONXOFF only)
+	Latency      byte          // 1-255 USB HiSpeed, 2-255 USB FullSpeed
+	ReadTimeout  time.Duration // max time Read waits for data, or 0 to wait forever
+	WriteTimeout time.Duration // max time Write waits to send, or 0 to wait forever
+}
+
+// Constants defining the default configuration settings of a UART interface.
+const (
+	UARTBaudDefault         uint32 = 115200
+	UARTBaudMin             uint32 = 183
+	UARTBaudMax             uint32 = 12000000
+	UARTLatencyDefault      byte   = 2
+	UARTXOnDefault          byte   = 0x11 // DC1
+	UARTXOffDefault         byte   = 0x13 // DC3
+	UARTReadTimeoutDefault         = 100 * time.Millisecond
+	UARTWriteTimeoutDefault        = 1000 * time.Millisecond
+)
+
+// UARTConfigDefault returns the default configuration settings for a UART
+// interface: 115200 baud, 8 data bits, no parity, 1 stop bit (8N1), and no flow
+// control.
+func UARTConfigDefault() *UARTConfig {
+	return &UARTConfig{
+		Baud:         UARTBaudDefault,
+		DataBits:     8,
+		StopBits:     1,
+		Parity:       UARTParityNone,
+		Flow:         UARTFlowNone,
+		XOn:          UARTXOnDefault,
+		XOff:         UARTXOffDefault,
+		Latency:      UARTLatencyDefault,
+		ReadTimeout:  UARTReadTimeoutDefault,
+		WriteTimeout: UARTWriteTimeoutDefault,
+	}
+}
+
+// String returns a descriptive string of a UARTConfig.
+func (c *UARTConfig) String() string {
+	return fmt.Sprintf("{ Baud: %d, Frame: %d%s%d, Flow: %s, Latency: \"%d ms\", "+
+		"ReadTimeout: %s, WriteTimeout: %s }", c.Baud, c.DataBits, c.Parity,
+		c.StopBits, c.Flow, c.Latency, c.ReadTimeout, c.WriteTimeout)
+}
+
+// validate checks that the fields of a UARTConfig are supported by the FT232H.
+func (c *UARTConfig) validate() error {
+	if c.Baud < UARTBaudMin || c.Baud > UARTBaudMax {
+		return fmt.Errorf("invalid baud rate: %d", c.Baud)
+	}
+	if 7 != c.DataBits && 8 != c.DataBits {
+		return fmt.Errorf("invalid data bits: %d", c.DataBits)
+	}
+	if 1 != c.StopBits && 2 != c.StopBits {
+		return fmt.Errorf("invalid stop bits: %d", c.StopBits)
+	}
+	if c.Parity > UARTParitySpace {
+		return fmt.Errorf("invalid parity: %d", c.Parity)
+	}
+	switch c.Flow {
+	case UARTFlowNone, UARTFlowRTSCTS, UARTFlowDTRDSR, UARTFlowXONXOFF:
+	default:
+		return fmt.Errorf("invalid flow control: 0x%04X", uint16(c.Flow))
+	}
+	if c.ReadTimeout < 0 || c.WriteTimeout < 0 {
+		return fmt.Errorf("invalid timeout: %s, %s", c.ReadTimeout, c.WriteTimeout)
+	}
+	return nil
+}
+
+// defaults returns a copy of the receiver c with each zero field replaced by its
+// default value (see UARTConfigDefault), except for ReadTimeout and WriteTimeout,
+// which wait forever if 0. If c is nil, the default configuration is returned.
+func (c *UARTConfig) defaults() *UARTConfig {
+	d := UARTConfigDefault()
+	if nil == c {
+		return d
+	}
+	r := *c
+	if 0 == r.Baud {
+		r.Baud = d.Baud
+	}
+	if 0 == r.DataBits {
+		r.DataBits = d.DataBits
+	}
+	if 0 == r.StopBits {
+		r.StopBits = d.StopBits
+	}
+	if 0 == r.XOn {
+		r.XOn = d.XOn
+	}
+	if 0 == r.XOff {
+		r.XOff = d.XOff
+	}
+	if 0 == r.Latency {
+		r.Latency = d.Latency
+	}
+	return &r
+}
+
+// millis returns the given duration in milliseconds, rounded up, for use as a
+// D2XX timeout (where 0 waits indefinitely).
+func millis(d time.Duration) uint32 {
+	return uint32((d + time.Millisecond - 1) / time.Millisecond)
+}
+
+// GetConfig returns the current configuration settings of the UART interface.
+func (uart *UART) GetConfig() *UARTConfig {
+	c := *uart.config
+	return &c
+}
+
+// Config changes the configuration settings of the UART interface and
+// (re)initializes it.
+// If the given configuration is nil, the default configuration is used (see
+// UARTConfigDefault). Fields of the given configuration equal to zero use their
+// default values, except for ReadTimeout and WriteTimeout.
+func (uart *UART) Config(cfg *UARTConfig) error {
+	c := cfg.defaults()
+	if err := c.validate(); nil != err {
+		return err
+	}
+	uart.config = c
+	return uart.Init()
+}
+
+// Init initializes the UART interface to a state ready for read/write.
+// If Config has not been called, the default configuration is used (see
+// UARTConfigDefault).
+// If the interface is already initialized, it is first closed before
+// initializing the interface.
+func (uart *UART) Init() error {
+	if err := _UART_Init(uart); nil != err {
+		return err
+	}
+	uart.device.mode = ModeUART
+	return nil
+}
+
+// Close closes both the UART interface and the connection to the FT232H device.
+func (uart *UART) Close() error {
+	return uart.device.Close()
+}
+
+// ErrUARTTimeout is returned when a UART read or write does not complete before
+// the configured ReadTimeout or WriteTimeout expires.
+var ErrUARTTimeout = errors.New("uart timeout")
+
+// Read reads up to len(p) bytes into p, returning as soon as any data is
+// available, or ErrUARTTimeout if no data is received within the configured
+// ReadTimeout.
+func (uart *UART) Read(p []byte) (int, error) {
+
+	if 0 == len(p) {
+		return 0, nil
+	}
+
+	n, err := _FT_GetQueueStatus(uart.device.info)
+	if nil != err {
+		return 0, err
+	}
+	if 0 == n {
+		n = 1 // wait for the first byte
+	}
+	if n > uint(len(p)) {
+		n = uint(len(p))
+	}
+
+	data, err := _FT_ReadTimeout(uart.device.info, n)
+	if nil == err && 0 == len(data) {
+		err = ErrUARTTimeout
+	}
+	return copy(p, data), err
+}
+
+// Write writes all of p, returning the number of bytes written and
+// ErrUARTTimeout if they could not be sent within the configured WriteTimeout
+// (e.g., when blocked by flow control).
+func (uart *UART) Write(p []byte) (int, error) {
+	n, err := _FT_Write(uart.device.info, p)
+	if nil == err && n < uint(len(p)) {
+		err = ErrUARTTimeout
+	}
+	return int(n), err
+}
+
+// Buffered returns the number of bytes received and available to Read without
+// waiting.
+func (uart *UART) Buffered() (int, error) {
+	n, err := _FT_GetQueueStatus(uart.device.info)
+	return int(n), err
+}
+
+// Purge discards all data in the receive and transmit buffers.
+func (uart *UART) Purge() error {
+	return _FT_Purge(uart.device.info)
+}
+
+// SetReadTimeout changes the max time Read waits for data, or 0 to wait
+// forever.
+func (uart *UART) SetReadTimeout(d time.Duration) error {
+	if d < 0 {
+		return fmt.Errorf("invalid timeout: %s", d)
+	}
+	if err := _FT_SetTimeouts(uart.device.info,
+		millis(d), millis(uart.config.WriteTimeout)); nil != err {
+		return err
+	}
+	uart.config.ReadTimeout = d
+	return nil
+}
+
+// SetDTR asserts (if set is true) or de-asserts the DTR output.
+func (uart *UART) SetDTR(set bool) error {
+	return _UART_SetDTR(uart, set)
+}
+
+// SetRTS asserts (if set is true) or de-asserts the RTS output. The RTS output
+// is controlled by the device when UARTFlowRTSCTS flow control is enabled.
+func (uart *UART) SetRTS(set bool) error {
+	return _UART_SetRTS(uart, set)
+}
+
+// SetBreak starts (if on is true) or stops sending a break condition, holding
+// the TXD output LOW.
+func (uart *UART) SetBreak(on bool) error {
+	return _UART_SetBreak(uart, on)
+}
+
+// Status returns the current modem and line status of the UART.
+func (uart *UART) Status() (UARTStatus, error) {
+	return _UART_GetModemStatus(uart)
+}
+
+// UARTStatus contains the modem status (lower byte) and line status (upper
+// byte) of a UART, as reported by the D2XX driver. The line status error bits
+// are cleared when read.
+type UARTStatus uint16
+
+// Constants defining the bits of a UARTStatus.
+const (
+	UARTStatusCTS     UARTStatus = 0x0010 // clear to send
+	UARTStatusDSR     UARTStatus = 0x0020 // data set ready
+	UARTStatusRI      UARTStatus = 0x0040 // ring indicator
+	UARTStatusDCD     UARTStatus = 0x0080 // data carrier detect
+	UARTStatusOverrun UARTStatus = 0x0200 // overrun error
+	UARTStatusParity  UARTStatus = 0x0400 // parity error
+	UARTStatusFraming UARTStatus = 0x0800 // framing error
+	UARTStatusBreak   UARTStatus = 0x1000 // break interrupt
+)
+
+// CTS returns true if the CTS input is asserted.
+func (s UARTStatus) CTS() bool { return 0 != s&UARTStatusCTS }
+
+// DSR returns true if the DSR input is asserted.
+func (s UARTStatus) DSR() bool { return 0 != s&UARTStatusDSR }
+
+// RI returns true if the RI input is asserted.
+func (s UARTStatus) RI() bool { return 0 != s&UARTStatusRI }
+
+// DCD returns true if the DCD input is asserted.
+func (s UARTStatus) DCD() bool { return 0 != s&UARTStatusDCD }
+
+// Err returns a non-nil error if any line status error bit is set.
+func (s UARTStatus) Err() error {
+	if 0 != s&(UARTStatusOverrun|UARTStatusParity|UARTStatusFraming|UARTStatusBreak) {
+		return fmt.Errorf("uart line status error: %s", s)
+	}
+	return nil
+}
+
+// String returns a descriptive string of the bits set in a UARTStatus.
+func (s UARTStatus) String() string {
+	var set []string
+	for _, b := range []struct {
+		bit  UARTStatus
+		name string
+	}{
+		{UARTStatusCTS, "CTS"},
+		{UARTStatusDSR, "DSR"},
+		{UARTStatusRI, "RI"},
+		{UARTStatusDCD, "DCD"},
+		{UARTStatusOverrun, "OE"},
+		{UARTStatusParity, "PE"},
+		{UARTStatusFraming, "FE"},
+		{UARTStatusBreak, "BI"},
+	} {
+		if 0 != s&b.bit {
+			set = append(set, b.name)
+		}
+	}
+	return fmt.Sprintf("{ %s }", strings.Join(set, " "))
+}
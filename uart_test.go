@@ -0,0 +1,83 @@
+package ft232h
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUARTConfig(t *testing.T) {
+
+	for _, test := range []struct {
+		name  string
+		mod   func(c *UARTConfig)
+		valid bool
+	}{
+		{name: "default", mod: func(c *UARTConfig) {}, valid: true},
+		{name: "7E2", mod: func(c *UARTConfig) {
+			c.DataBits, c.Parity, c.StopBits = 7, UARTParityEven, 2
+		}, valid: true},
+		{name: "max-baud", mod: func(c *UARTConfig) { c.Baud = UARTBaudMax }, valid: true},
+		{name: "min-baud", mod: func(c *UARTConfig) { c.Baud = UARTBaudMin - 1 }, valid: false},
+		{name: "data-bits", mod: func(c *UARTConfig) { c.DataBits = 9 }, valid: false},
+		{name: "stop-bits", mod: func(c *UARTConfig) { c.StopBits = 0 }, valid: false},
+		{name: "parity", mod: func(c *UARTConfig) { c.Parity = 5 }, valid: false},
+		{name: "flow", mod: func(c *UARTConfig) { c.Flow = 0x0300 }, valid: false},
+		{name: "timeout", mod: func(c *UARTConfig) { c.ReadTimeout = -1 }, valid: false},
+	} {
+		t.Run(test.name, func(s *testing.T) {
+			c := UARTConfigDefault()
+			test.mod(c)
+			if err := c.validate(); test.valid != (nil == err) {
+				s.Fatalf("unexpected result: %v", err)
+			}
+		})
+	}
+
+	if str := UARTConfigDefault().String(); "{ Baud: 115200, Frame: 8N1, Flow: none, "+
+		"Latency: \"2 ms\", ReadTimeout: 100ms, WriteTimeout: 1s }" != str {
+		t.Fatalf("unexpected string: %s", str)
+	}
+
+	if c := (*UARTConfig)(nil).defaults(); *UARTConfigDefault() != *c {
+		t.Fatalf("unexpected default configuration: %s", c)
+	}
+	c := (&UARTConfig{Baud: 9600, Parity: UARTParityOdd}).defaults()
+	if err := c.validate(); nil != err {
+		t.Fatalf("unexpected result: %v", err)
+	}
+	if exp := "{ Baud: 9600, Frame: 8O1, Flow: none, Latency: \"2 ms\", " +
+		"ReadTimeout: 0s, WriteTimeout: 0s }"; exp != c.String() {
+		t.Fatalf("unexpected configuration: %s", c)
+	}
+
+	for d, ms := range map[time.Duration]uint32{
+		0: 0, time.Microsecond: 1, time.Millisecond: 1, 1500 * time.Microsecond: 2, time.Second: 1000,
+	} {
+		if m := millis(d); ms != m {
+			t.Fatalf("unexpected millis(%s): %d", d, m)
+		}
+	}
+}
+
+func TestUARTStatus(t *testing.T) {
+
+	for _, test := range []struct {
+		status UARTStatus
+		str    string
+		err    bool
+	}{
+		{status: 0x0000, str: "{  }", err: false},
+		{status: 0x0031, str: "{ CTS DSR }", err: false},
+		{status: 0x0860, str: "{ DSR RI FE }", err: true},
+	} {
+		if str := test.status.String(); test.str != str {
+			t.Fatalf("unexpected string: %q != %q", str, test.str)
+		}
+		if err := test.status.Err(); test.err != (nil != err) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if s := UARTStatus(0x00B0); !s.CTS() || !s.DSR() || s.RI() || !s.DCD() {
+		t.Fatalf("unexpected modem status: %s", s)
+	}
+}
@@ -15,6 +15,20 @@ var (
 	rng         = rand.New(rand.NewSource(time.Now().UnixNano()))
 )
 
+// waitSpin is the duration below which wait busy-loops instead of sleeping,
+// since the scheduler cannot reliably sleep for such short durations.
+const waitSpin = 2 * time.Millisecond
+
+// wait blocks for at least the given duration d.
+func wait(d time.Duration) {
+	if d >= waitSpin {
+		time.Sleep(d)
+		return
+	}
+	for beg := time.Now(); time.Since(beg) < d; {
+	}
+}
+
 type runeSeq func() rune
 
 func randRune(alpha []rune) func() rune {
@@ -106,6 +120,27 @@ func (s AddrSpace) String() string {
 	return fmt.Sprintf("%d-bit", s.Bits())
 }
 
+// MarshalText returns the string representation of the address space, e.g.
+// "16-bit".
+func (s AddrSpace) MarshalText() ([]byte, error) {
+	if 0 == s.Bits() {
+		return nil, fmt.Errorf("invalid address space: %d", s)
+	}
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText parses the string representation of an address space, e.g.
+// "16-bit".
+func (s *AddrSpace) UnmarshalText(text []byte) error {
+	for _, a := range []AddrSpace{Addr8Bit, Addr16Bit, Addr32Bit, Addr64Bit} {
+		if a.String() == string(text) {
+			*s = a
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid address space: %q", text)
+}
+
 // Bits returns the number of usable bits in an address space.
 func (s AddrSpace) Bits() uint {
 	switch s {
@@ -145,6 +180,30 @@ func (o ByteOrder) String() string {
 	}
 }
 
+// MarshalText returns the string representation of the byte order, "MSB" or
+// "LSB".
+func (o ByteOrder) MarshalText() ([]byte, error) {
+	switch o {
+	case MSB, LSB:
+		return []byte(o.String()), nil
+	}
+	return nil, fmt.Errorf("invalid byte order: %d", o)
+}
+
+// UnmarshalText parses the string representation of a byte order, "MSB" or
+// "LSB".
+func (o *ByteOrder) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case MSB.String():
+		*o = MSB
+	case LSB.String():
+		*o = LSB
+	default:
+		return fmt.Errorf("invalid byte order: %q", text)
+	}
+	return nil
+}
+
 // Bytes converts the given value to an ordered slice of bytes. The receiver
 // value determines ordering, and count (≤ 8) defines slice length (in bytes).
 func (o ByteOrder) Bytes(count uint, value uint64) []uint8 {
@@ -159,7 +218,7 @@ func (o ByteOrder) Bytes(count uint, value uint64) []uint8 {
 		case MSB:
 			b[i] = uint8((value >> ((count - uint(i) - 1) * 8)) & 0xFF)
 		case LSB:
-			b[i] = uint8((value >> (count * 8)) & 0xFF)
+			b[i] = uint8((value >> (uint(i) * 8)) & 0xFF)
 		}
 	}
 	return b
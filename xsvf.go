@@ -0,0 +1,428 @@
+package ft232h
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// XSVFError is returned by an XSVF player when a command fails, identifying the
+// index of the command in the file.
+type XSVFError struct {
+	Index  int    // index (from 1) of the command
+	Offset int64  // byte offset of the command
+	Cmd    string // name of the command (e.g., "XSDRTDO")
+	Err    error  // cause of the failure (e.g., *TDOMismatchError)
+}
+
+// Error returns a descriptive string of an XSVFError.
+func (e *XSVFError) Error() string {
+	return fmt.Sprintf("xsvf: command %d (offset %d): %s: %v",
+		e.Index, e.Offset, e.Cmd, e.Err)
+}
+
+// Constants defining the XSVF command opcodes. See Xilinx application note
+// XAPP503 "SVF and XSVF File Formats for Xilinx Devices" for details.
+const (
+	xsvfComplete    uint8 = 0x00
+	xsvfTDOMask     uint8 = 0x01
+	xsvfSIR         uint8 = 0x02
+	xsvfSDR         uint8 = 0x03
+	xsvfRunTest     uint8 = 0x04
+	xsvfRepeat      uint8 = 0x07
+	xsvfSDRSize     uint8 = 0x08
+	xsvfSDRTDO      uint8 = 0x09
+	xsvfSetSDRMasks uint8 = 0x0A
+	xsvfSDRInc      uint8 = 0x0B
+	xsvfSDRB        uint8 = 0x0C
+	xsvfSDRC        uint8 = 0x0D
+	xsvfSDRE        uint8 = 0x0E
+	xsvfSDRTDOB     uint8 = 0x0F
+	xsvfSDRTDOC     uint8 = 0x10
+	xsvfSDRTDOE     uint8 = 0x11
+	xsvfState       uint8 = 0x12
+	xsvfEndIR       uint8 = 0x13
+	xsvfEndDR       uint8 = 0x14
+	xsvfSIR2        uint8 = 0x15
+	xsvfComment     uint8 = 0x16
+	xsvfWait        uint8 = 0x17
+)
+
+// xsvfName returns the name of an XSVF command opcode.
+func xsvfName(op uint8) string {
+	switch op {
+	case xsvfComplete:
+		return "XCOMPLETE"
+	case xsvfTDOMask:
+		return "XTDOMASK"
+	case xsvfSIR:
+		return "XSIR"
+	case xsvfSDR:
+		return "XSDR"
+	case xsvfRunTest:
+		return "XRUNTEST"
+	case xsvfRepeat:
+		return "XREPEAT"
+	case xsvfSDRSize:
+		return "XSDRSIZE"
+	case xsvfSDRTDO:
+		return "XSDRTDO"
+	case xsvfSetSDRMasks:
+		return "XSETSDRMASKS"
+	case xsvfSDRInc:
+		return "XSDRINC"
+	case xsvfSDRB:
+		return "XSDRB"
+	case xsvfSDRC:
+		return "XSDRC"
+	case xsvfSDRE:
+		return "XSDRE"
+	case xsvfSDRTDOB:
+		return "XSDRTDOB"
+	case xsvfSDRTDOC:
+		return "XSDRTDOC"
+	case xsvfSDRTDOE:
+		return "XSDRTDOE"
+	case xsvfState:
+		return "XSTATE"
+	case xsvfEndIR:
+		return "XENDIR"
+	case xsvfEndDR:
+		return "XENDDR"
+	case xsvfSIR2:
+		return "XSIR2"
+	case xsvfComment:
+		return "XCOMMENT"
+	case xsvfWait:
+		return "XWAIT"
+	}
+	return fmt.Sprintf("(invalid command 0x%02X)", op)
+}
+
+// XSVF plays Xilinx compact Serial Vector Format (XSVF) files on a JTAG scan
+// chain.
+//
+// All commands defined by XAPP503 are supported except the obsolete
+// XSETSDRMASKS and XSDRINC. XRUNTEST is applied as both a number of TCK cycles
+// and a number of microseconds spent in Run-Test/Idle after each XSIR and XSDR
+// ending in Run-Test/Idle. An XSDR or XSDRTDO with mismatched TDO bits is
+// retried up to XREPEAT times, each after pausing and updating the scan and
+// waiting in Run-Test/Idle for 25% longer than the previous XRUNTEST time.
+// Commands fail with an *XSVFError identifying the command, and TDO mismatches
+// are reported as a *TDOMismatchError.
+type XSVF struct {
+	target  JTAGTarget
+	size    uint     // length of DR scans (bits)
+	mask    []uint8  // TDO mask of DR scans
+	tdo     []uint8  // expected TDO of DR scans, or nil
+	runTest uint32   // Run-Test/Idle time (µs) and TCK cycles
+	repeat  uint8    // max number of retries of a DR scan
+	endIR   TAPState // end state of IR scans
+	endDR   TAPState // end state of DR scans
+}
+
+// NewXSVF returns a new XSVF player using the given JTAG target, which must
+// already be initialized.
+func NewXSVF(target JTAGTarget) *XSVF {
+	return &XSVF{
+		target: target,
+		endIR:  TAPIdle,
+		endDR:  TAPIdle,
+	}
+}
+
+// xsvfReader reads the operands of XSVF commands.
+type xsvfReader struct {
+	r   *bufio.Reader
+	off int64
+}
+
+// bytes reads n bytes.
+func (r *xsvfReader) bytes(n uint) ([]uint8, error) {
+	b := make([]uint8, n)
+	k, err := io.ReadFull(r.r, b)
+	r.off += int64(k)
+	if io.EOF == err {
+		err = io.ErrUnexpectedEOF
+	}
+	return b, err
+}
+
+// byte reads a single byte.
+func (r *xsvfReader) byte() (uint8, error) {
+	b, err := r.bytes(1)
+	if nil != err {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// uint32 reads a 4-byte big-endian integer.
+func (r *xsvfReader) uint32() (uint32, error) {
+	b, err := r.bytes(4)
+	if nil != err {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
+
+// bits reads a bit vector of the given length, stored big-endian and padded to
+// whole bytes, and returns it as a bit string (LSB first).
+func (r *xsvfReader) bits(n uint) ([]uint8, error) {
+	b, err := r.bytes((n + 7) / 8)
+	if nil != err {
+		return nil, err
+	}
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return b, nil
+}
+
+// Play reads XSVF commands from r and executes them in order, until either
+// XCOMPLETE, EOF, or a command fails.
+func (x *XSVF) Play(r io.Reader) error {
+	xr := &xsvfReader{r: bufio.NewReader(r)}
+	for i := 1; ; i++ {
+		off := xr.off
+		op, err := xr.byte()
+		if io.ErrUnexpectedEOF == err {
+			return nil
+		}
+		if nil == err {
+			if xsvfComplete == op {
+				return nil
+			}
+			err = x.exec(xr, op)
+		}
+		if nil != err {
+			return &XSVFError{Index: i, Offset: off, Cmd: xsvfName(op), Err: err}
+		}
+	}
+}
+
+// exec reads the operands of and executes a single XSVF command.
+func (x *XSVF) exec(r *xsvfReader, op uint8) error {
+
+	switch op {
+	case xsvfTDOMask:
+		mask, err := r.bits(x.size)
+		if nil != err {
+			return err
+		}
+		x.mask = mask
+
+	case xsvfSIR, xsvfSIR2:
+		var n uint
+		if xsvfSIR == op {
+			b, err := r.byte()
+			if nil != err {
+				return err
+			}
+			n = uint(b)
+		} else {
+			b, err := r.bytes(2)
+			if nil != err {
+				return err
+			}
+			n = uint(binary.BigEndian.Uint16(b))
+		}
+		tdi, err := r.bits(n)
+		if nil != err {
+			return err
+		}
+		if _, err := x.target.ShiftIR(tdi, n, x.endIR); nil != err {
+			return err
+		}
+		return x.idle(x.endIR, x.runTest)
+
+	case xsvfSDR, xsvfSDRTDO:
+		tdi, err := r.bits(x.size)
+		if nil != err {
+			return err
+		}
+		if xsvfSDRTDO == op {
+			if x.tdo, err = r.bits(x.size); nil != err {
+				return err
+			}
+		}
+		return x.sdr(tdi)
+
+	case xsvfSDRB, xsvfSDRC, xsvfSDRE, xsvfSDRTDOB, xsvfSDRTDOC, xsvfSDRTDOE:
+		tdi, err := r.bits(x.size)
+		if nil != err {
+			return err
+		}
+		var tdo []uint8
+		if op >= xsvfSDRTDOB {
+			if tdo, err = r.bits(x.size); nil != err {
+				return err
+			}
+		}
+		end := TAPShiftDR
+		if xsvfSDRE == op || xsvfSDRTDOE == op {
+			end = x.endDR
+		}
+		out, err := x.target.ShiftDR(tdi, x.size, end)
+		if nil != err || nil == tdo {
+			return err
+		}
+		return tdoCompare(out, tdo, x.mask, x.size)
+
+	case xsvfRunTest:
+		n, err := r.uint32()
+		if nil != err {
+			return err
+		}
+		x.runTest = n
+
+	case xsvfRepeat:
+		n, err := r.byte()
+		if nil != err {
+			return err
+		}
+		x.repeat = n
+
+	case xsvfSDRSize:
+		n, err := r.uint32()
+		if nil != err {
+			return err
+		}
+		x.size = uint(n)
+		x.mask = jtagFill(0, x.size)
+		x.tdo = nil
+
+	case xsvfState:
+		b, err := r.byte()
+		if nil != err {
+			return err
+		}
+		s := TAPState(b)
+		if !s.valid() {
+			return fmt.Errorf("invalid state: %d", b)
+		}
+		if TAPReset == s {
+			return x.target.Reset()
+		}
+		return x.target.Goto(s)
+
+	case xsvfEndIR, xsvfEndDR:
+		b, err := r.byte()
+		if nil != err {
+			return err
+		}
+		if b > 1 {
+			return fmt.Errorf("invalid end state: %d", b)
+		}
+		switch {
+		case 0 == b && xsvfEndIR == op:
+			x.endIR = TAPIdle
+		case 0 == b:
+			x.endDR = TAPIdle
+		case xsvfEndIR == op:
+			x.endIR = TAPPauseIR
+		default:
+			x.endDR = TAPPauseDR
+		}
+
+	case xsvfComment:
+		for {
+			b, err := r.byte()
+			if nil != err {
+				return err
+			}
+			if 0 == b {
+				break
+			}
+		}
+
+	case xsvfWait:
+		b, err := r.bytes(2)
+		if nil != err {
+			return err
+		}
+		us, err := r.uint32()
+		if nil != err {
+			return err
+		}
+		wait, end := TAPState(b[0]), TAPState(b[1])
+		if !wait.stable() || !end.stable() {
+			return fmt.Errorf("invalid state: %d, %d", b[0], b[1])
+		}
+		if err := x.target.RunTest(wait, 0, time.Duration(us)*time.Microsecond); nil != err {
+			return err
+		}
+		if end != wait {
+			return x.target.Goto(end)
+		}
+
+	default:
+		return fmt.Errorf("unsupported command")
+	}
+
+	return nil
+}
+
+// sdr shifts the given bits into the data registers, ending in the DR end state,
+// and verifies the bits shifted out of TDO against the expected bits of the
+// last XSDRTDO, retrying up to XREPEAT times on mismatch.
+// Each retry follows XAPP503: the scan is paused (Exit1-DR, Pause-DR), then
+// resumed and updated (Exit2-DR, Shift-DR, Exit1-DR, Update-DR), the XRUNTEST
+// time is increased by 25% and waited in Run-Test/Idle, and the full scan is
+// repeated from Capture-DR.
+func (x *XSVF) sdr(tdi []uint8) error {
+
+	if nil == x.tdo || 0 == x.repeat {
+		out, err := x.target.ShiftDR(tdi, x.size, x.endDR)
+		if nil != err {
+			return err
+		}
+		if err := x.idle(x.endDR, x.runTest); nil != err {
+			return err
+		}
+		if nil == x.tdo {
+			return nil
+		}
+		return tdoCompare(out, x.tdo, x.mask, x.size)
+	}
+
+	runTest := x.runTest
+	for i := uint8(0); ; i++ {
+		out, err := x.target.ShiftDR(tdi, x.size, TAPPauseDR)
+		if nil != err {
+			return err
+		}
+		err = tdoCompare(out, x.tdo, x.mask, x.size)
+		if nil == err || i >= x.repeat {
+			if e := x.target.Goto(x.endDR); nil != e {
+				return e
+			}
+			if e := x.idle(x.endDR, runTest); nil != e {
+				return e
+			}
+			return err
+		}
+		if err := x.target.Goto(TAPShiftDR); nil != err {
+			return err
+		}
+		if err := x.target.Goto(TAPIdle); nil != err {
+			return err
+		}
+		runTest += runTest >> 2
+		if err := x.idle(TAPIdle, runTest); nil != err {
+			return err
+		}
+	}
+}
+
+// idle waits in Run-Test/Idle for the given XRUNTEST time, if the given end
+// state of the preceding scan is Run-Test/Idle.
+func (x *XSVF) idle(end TAPState, runTest uint32) error {
+	if 0 == runTest || TAPIdle != end {
+		return nil
+	}
+	return x.target.RunTest(TAPIdle, uint(runTest),
+		time.Duration(runTest)*time.Microsecond)
+}
@@ -0,0 +1,172 @@
+package ft232h
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestXSVF(t *testing.T) {
+
+	// the simulated chain has IR lengths 5+4+3, with the middle device's DATA
+	// register (8 bits) between two BYPASS registers.
+	prog := []uint8{
+		xsvfState, 0x00,
+		xsvfState, 0x01,
+		xsvfComment, 'x', 's', 'v', 'f', 0x00,
+		xsvfRepeat, 0x00,
+		xsvfRunTest, 0x00, 0x00, 0x00, 0x00,
+		xsvfEndIR, 0x00,
+		xsvfEndDR, 0x00,
+		xsvfSIR, 12, 0x0E, 0x5F, // BYPASS, DATA, BYPASS
+		xsvfSDRSize, 0x00, 0x00, 0x00, 0x0A,
+		xsvfSDR, 0x01, 0x4A, // A5, not verified
+		xsvfTDOMask, 0x01, 0xFE,
+		xsvfRunTest, 0x00, 0x00, 0x00, 0x0A,
+		xsvfSDRTDO, 0x00, 0x79, 0x01, 0x4B, // 3C, ignoring BYPASS bits
+		xsvfSDRSize, 0x00, 0x00, 0x00, 0x05,
+		xsvfSDRTDOB, 0x14, 0x18, // low nibble of 5A, 3C
+		xsvfSDRE, 0x05, // high nibble of 5A
+		xsvfEndDR, 0x01,
+		xsvfWait, 0x01, 0x06, 0x00, 0x00, 0x03, 0xE8,
+		xsvfComplete,
+		xsvfSDR, 0x00, // ignored
+	}
+
+	tap := newSimTAP()
+	if err := NewXSVF(tap).Play(bytes.NewReader(prog)); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if 0x1F != tap.chain[0].ir || simData != tap.chain[1].ir ||
+		0x07 != tap.chain[2].ir || 0x5A != tap.chain[1].data {
+		t.Fatalf("unexpected chain: %+v %+v %+v", *tap.chain[0], *tap.chain[1], *tap.chain[2])
+	}
+	if TAPPauseDR != tap.State() {
+		t.Fatalf("unexpected state: %s", tap.State())
+	}
+	exp := []simRun{
+		{state: TAPIdle, cycles: 10, min: 10 * time.Microsecond},
+		{state: TAPIdle, min: time.Millisecond},
+	}
+	if len(exp) != len(tap.runs) {
+		t.Fatalf("unexpected runs: %v", tap.runs)
+	}
+	for i := range exp {
+		if exp[i] != tap.runs[i] {
+			t.Fatalf("unexpected run: %v", tap.runs[i])
+		}
+	}
+
+	for _, test := range []struct {
+		name     string
+		prog     []uint8
+		index    int
+		shifts   int
+		captures int // passes through Capture-DR
+		tdo      bool
+	}{
+		{
+			name: "mismatch",
+			prog: []uint8{
+				xsvfState, 0x00,
+				xsvfSIR, 12, 0x0E, 0x5F,
+				xsvfSDRSize, 0x00, 0x00, 0x00, 0x0A,
+				xsvfRepeat, 0x02,
+				xsvfSDRTDO, 0x00, 0x00, 0x00, 0x02,
+			},
+			index: 5, shifts: 4, captures: 3, tdo: true,
+		},
+		{
+			name: "truncated",
+			prog: []uint8{
+				xsvfSDRSize, 0x00, 0x00, 0x00, 0x10,
+				xsvfSDR, 0x00,
+			},
+			index: 2,
+		},
+		{
+			name:  "unsupported",
+			prog:  []uint8{xsvfState, 0x00, xsvfSDRInc},
+			index: 2,
+		},
+		{
+			name:  "state",
+			prog:  []uint8{xsvfState, 0x10},
+			index: 1,
+		},
+	} {
+		t.Run(test.name, func(s *testing.T) {
+			tap := newSimTAP()
+			err := NewXSVF(tap).Play(bytes.NewReader(test.prog))
+			e, ok := err.(*XSVFError)
+			if !ok || test.index != e.Index {
+				s.Fatalf("expected error in command %d: %v", test.index, err)
+			}
+			if _, ok := e.Err.(*TDOMismatchError); test.tdo != ok {
+				s.Fatalf("unexpected error: %v", e.Err)
+			}
+			if test.tdo && test.shifts != tap.shifts {
+				s.Fatalf("unexpected number of shifts: %d", tap.shifts)
+			}
+			captures := 0
+			for _, state := range tap.states {
+				if TAPCaptureDR == state {
+					captures++
+				}
+			}
+			if test.tdo && test.captures != captures {
+				s.Fatalf("unexpected number of captures: %d", captures)
+			}
+		})
+	}
+}
+
+func TestXSVFRepeat(t *testing.T) {
+
+	prog := []uint8{
+		xsvfState, 0x00,
+		xsvfSIR, 12, 0x0E, 0x5F,
+		xsvfSDRSize, 0x00, 0x00, 0x00, 0x0A,
+		xsvfRunTest, 0x00, 0x00, 0x00, 0x08,
+		xsvfRepeat, 0x02,
+		xsvfSDRTDO, 0x00, 0x00, 0x00, 0x02, // never matches
+	}
+
+	tap := newSimTAP()
+	err := NewXSVF(tap).Play(bytes.NewReader(prog))
+	if e, ok := err.(*XSVFError); !ok || 6 != e.Index {
+		t.Fatalf("expected error in command 6: %v", err)
+	}
+
+	// each retry pauses, resumes, and updates the scan, waits in Run-Test/Idle
+	// with the XRUNTEST time increased by 25%, and then repeats the full scan.
+	states := []TAPState{
+		TAPIdle, TAPSelectDR, TAPCaptureDR, TAPShiftDR, TAPExit1DR, TAPPauseDR,
+		TAPExit2DR, TAPShiftDR, TAPExit1DR, TAPUpdateDR, TAPIdle,
+		TAPSelectDR, TAPCaptureDR, TAPShiftDR, TAPExit1DR, TAPPauseDR,
+		TAPExit2DR, TAPShiftDR, TAPExit1DR, TAPUpdateDR, TAPIdle,
+		TAPSelectDR, TAPCaptureDR, TAPShiftDR, TAPExit1DR, TAPPauseDR,
+		TAPExit2DR, TAPUpdateDR, TAPIdle,
+	}
+	if len(tap.states) < len(states) {
+		t.Fatalf("unexpected states: %v", tap.states)
+	}
+	for i, s := range tap.states[len(tap.states)-len(states):] {
+		if states[i] != s {
+			t.Fatalf("unexpected state %d: %s != %s", i, s, states[i])
+		}
+	}
+	runs := []simRun{
+		{state: TAPIdle, cycles: 10, min: 10 * time.Microsecond},
+		{state: TAPIdle, cycles: 12, min: 12 * time.Microsecond},
+		{state: TAPIdle, cycles: 12, min: 12 * time.Microsecond},
+	}
+	if len(runs) != len(tap.runs) {
+		t.Fatalf("unexpected runs: %v", tap.runs)
+	}
+	for i := range runs {
+		if runs[i] != tap.runs[i] {
+			t.Fatalf("unexpected run: %v", tap.runs[i])
+		}
+	}
+}